@@ -0,0 +1,140 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// ProblemMediaType is the media type of RFC 7807 problem details,
+// written instead of the usual envelope to clients accepting it.
+const ProblemMediaType = "application/problem+json"
+
+// Codes telling errors apart, more specific than response status.
+const (
+	BadRequest         = "bad_request"
+	InvalidKey         = "invalid_key"
+	MissingContentType = "missing_content_type"
+	ObjectTooLarge     = "object_too_large"
+	Unauthorized       = "unauthorized"
+	Forbidden          = "forbidden"
+	NotFound           = "not_found"
+	KeyNotFound        = "key_not_found"
+	MethodNotAllowed   = "method_not_allowed"
+	Conflict           = "conflict"
+	RateLimited        = "rate_limited"
+	QuotaExceeded      = "quota_exceeded"
+	Internal           = "internal"
+	BadGateway         = "bad_gateway"
+	Unavailable        = "unavailable"
+)
+
+// Error describes a failed request.
+type Error struct {
+	Status    int         `json:"status"`
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+}
+
+// Envelope is the body of error responses.
+type Envelope struct {
+	Error Error `json:"error"`
+}
+
+// Problem is the body of error responses in RFC 7807 format,
+// with code, details and request ID as extension members.
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail"`
+	Instance  string      `json:"instance"`
+	Code      string      `json:"code"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+}
+
+// Write writes error response to r with status, code and message.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteDetails(w, r, status, code, message, nil)
+}
+
+// WriteDetails writes error response to r with status, code and message,
+// along with details if they are not nil. Response is a Problem if
+// the client accepts ProblemMediaType, an Envelope otherwise.
+func WriteDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	requestId := logging.RequestId(r.Context())
+	if strings.Contains(r.Header.Get("Accept"), ProblemMediaType) {
+		writeJson(w, ProblemMediaType, status, Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    message,
+			Instance:  r.URL.RequestURI(),
+			Code:      code,
+			Details:   details,
+			RequestId: requestId,
+		})
+	} else {
+		writeJson(w, "application/json", status, Envelope{Error{
+			Status:    status,
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestId: requestId,
+		}})
+	}
+}
+
+// NotFoundHandler writes error response to requests for unknown paths,
+// for chi routers.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, NotFound, "no such resource")
+}
+
+// MethodNotAllowedHandler writes error response to requests with methods
+// not served under their path, for chi routers.
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, MethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+}
+
+// Recoverer recovers from panics in next, writing error response with
+// code Internal. Panic and its stack trace are added to the access log
+// entry of the request.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
+				logging.Annotate(r.Context(), logging.Fields{"panic": fmt.Sprint(rvr), "stack": string(debug.Stack())})
+				Write(w, r, http.StatusInternalServerError, Internal, "internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteJson writes value in JSON format into body, with code.
+// Values which cannot be encoded are programming errors, so they panic.
+func WriteJson(w http.ResponseWriter, code int, value interface{}) {
+	writeJson(w, "application/json", code, value)
+}
+
+func writeJson(w http.ResponseWriter, contentType string, code int, value interface{}) {
+	if body, err := json.Marshal(value); err == nil {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(code)
+		if _, err := w.Write(body); err != nil {
+			panic(err)
+		}
+	} else {
+		panic(err)
+	}
+}
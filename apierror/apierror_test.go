@@ -0,0 +1,109 @@
+package apierror
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	logger := logging.New(&bytes.Buffer{}, logging.Info)
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteDetails(w, r, http.StatusBadRequest, InvalidKey, "invalid key", map[string]string{"key": "a-b"})
+	}))
+
+	t.Run("envelope", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/objects/a-b", nil)
+		r.Header.Set(logging.RequestIdHeader, "client-id")
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		var envelope Envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		e := envelope.Error
+		details, _ := e.Details.(map[string]interface{})
+		if e.Status != http.StatusBadRequest || e.Code != InvalidKey || e.Message != "invalid key" ||
+			e.RequestId != "client-id" || details["key"] != "a-b" {
+			t.Errorf("unexpected error %s", w.Body.String())
+		}
+	})
+
+	t.Run("problem", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/objects/a-b?wait=1s", nil)
+		r.Header.Set("Accept", ProblemMediaType+", application/json")
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != ProblemMediaType {
+			t.Errorf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		var problem Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if problem.Type != "about:blank" || problem.Title != "Bad Request" || problem.Status != http.StatusBadRequest ||
+			problem.Detail != "invalid key" || problem.Instance != "/api/objects/a-b?wait=1s" ||
+			problem.Code != InvalidKey || problem.RequestId != w.Header().Get(logging.RequestIdHeader) {
+			t.Errorf("unexpected problem %s", w.Body.String())
+		}
+	})
+}
+
+func TestRouterHandlers(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(Recoverer)
+	router.NotFound(NotFoundHandler)
+	router.MethodNotAllowed(MethodNotAllowedHandler)
+	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	})
+	var buf bytes.Buffer
+	handler := logging.New(&buf, logging.Info).Middleware(router)
+
+	dataSets := []struct {
+		method string
+		url    string
+		status int
+		code   string
+	}{
+		{"GET", "/absent", http.StatusNotFound, NotFound},
+		{"POST", "/panic", http.StatusMethodNotAllowed, MethodNotAllowed},
+		{"GET", "/panic", http.StatusInternalServerError, Internal},
+	}
+	for _, dataSet := range dataSets {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(dataSet.method, dataSet.url, nil))
+		var envelope Envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%s %s: invalid body %s", dataSet.method, dataSet.url, w.Body.String())
+		}
+		if w.Code != dataSet.status || envelope.Error.Code != dataSet.code {
+			t.Errorf("%s %s: unexpected response %d %s", dataSet.method, dataSet.url, w.Code, w.Body.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `"panic":"handler failed"`) || !strings.Contains(buf.String(), `"stack":"goroutine`) {
+		t.Errorf("panic not logged: %s", buf.String())
+	}
+}
+
+func TestRecovererAbort(t *testing.T) {
+	handler := Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Error("aborted handler recovered")
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+)
+
+// Entry is a single object in an archive.
+// Archive is a stream of JSON encoded entries, one per line.
+// Object is encoded in base64.
+type Entry struct {
+	Key         string `json:"key"`
+	ContentType string `json:"contentType"`
+	Object      []byte `json:"object"`
+}
+
+// ConflictPolicy decides what happens when imported key
+// is already present in storage.
+type ConflictPolicy int
+
+const (
+	Skip ConflictPolicy = iota
+	Overwrite
+)
+
+// Report summarizes an import.
+type Report struct {
+	Imported int // entries placed in storage
+	Skipped  int // entries skipped because of key conflicts
+}
+
+var InvalidKeyError = errors.New("invalid key")
+
+// Writer writes entries to an archive.
+type Writer struct {
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{json.NewEncoder(w)}
+}
+
+// Write appends entry to the archive.
+func (w *Writer) Write(entry Entry) error {
+	return w.enc.Encode(entry)
+}
+
+// Reader reads entries from an archive.
+type Reader struct {
+	dec *json.Decoder
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{json.NewDecoder(r)}
+}
+
+// Read returns next entry from the archive.
+// Returns io.EOF when there are no more entries.
+func (r *Reader) Read() (Entry, error) {
+	var entry Entry
+	err := r.dec.Decode(&entry)
+	return entry, err
+}
+
+// Export writes all data present in storage to w.
+// Keys deleted during the export are omitted.
+// Returns number of exported entries.
+func Export(dataStorage storage.Storage, w io.Writer) (int, error) {
+	writer := NewWriter(w)
+	exported := 0
+	for _, key := range dataStorage.Keys() {
+		data, err := dataStorage.Get(key)
+		if err == storage.KeyAbsentError {
+			continue
+		} else if err != nil {
+			return exported, err
+		}
+		if err := writer.Write(Entry{key, data.ContentType, data.Object}); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, nil
+}
+
+// Import places all entries read from r in storage,
+// resolving key conflicts according to policy.
+// If validKey is not nil, entry with a key it rejects stops
+// the import with InvalidKeyError. Entries read before
+// the error remain in storage.
+func Import(dataStorage storage.Storage, r io.Reader, policy ConflictPolicy, validKey func(string) bool) (Report, error) {
+	var report Report
+	reader := NewReader(r)
+	for line := 1; ; line++ {
+		entry, err := reader.Read()
+		if err == io.EOF {
+			return report, nil
+		} else if err != nil {
+			return report, fmt.Errorf("entry %d: %v", line, err)
+		}
+		if validKey != nil && !validKey(entry.Key) {
+			return report, fmt.Errorf("entry %d: %v %q", line, InvalidKeyError, entry.Key)
+		}
+		if policy == Skip {
+			if _, err := dataStorage.Get(entry.Key); err == nil {
+				report.Skipped++
+				continue
+			}
+		}
+		if entry.Object == nil {
+			entry.Object = []byte{}
+		}
+		if err := dataStorage.Put(entry.Key, entry.Object, entry.ContentType); err != nil {
+			return report, fmt.Errorf("entry %d: %v", line, err)
+		}
+		report.Imported++
+	}
+}
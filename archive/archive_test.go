@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	dataSets := []map[string]storage.Data{
+		{},
+		{"key": {Object: []byte{}, ContentType: ""}},
+		{
+			"key1": {Object: []byte{0, 1, 2, 255}, ContentType: "type1"},
+			"key2": {Object: []byte("text"), ContentType: "text/plain"},
+		},
+	}
+
+	for i, dataSet := range dataSets {
+		t.Run(fmt.Sprint("set ", i), func(t *testing.T) {
+			original := storage.NewStorage()
+			for key, data := range dataSet {
+				original.Put(key, data.Object, data.ContentType)
+			}
+			var buff bytes.Buffer
+			exported, err := Export(original, &buff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exported != len(dataSet) {
+				t.Errorf("wrong export count: %v", exported)
+			}
+			if lines := strings.Count(buff.String(), "\n"); lines != len(dataSet) {
+				t.Errorf("wrong line count: %v", lines)
+			}
+
+			imported := storage.NewStorage()
+			report, err := Import(imported, &buff, Skip, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Imported != len(dataSet) || report.Skipped != 0 {
+				t.Errorf("wrong report: %v", report)
+			}
+			keys := imported.Keys()
+			if len(keys) != len(dataSet) {
+				t.Errorf("wrong keys: %v", keys)
+			}
+			for key, data := range dataSet {
+				if loaded, err := imported.Get(key); err != nil {
+					t.Errorf("key %v not imported", key)
+				} else if !reflect.DeepEqual(loaded, data) {
+					t.Errorf("data differs: %v", loaded)
+				}
+			}
+		})
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	input := `{"key":"a","contentType":"new","object":"AQI="}
+{"key":"b","contentType":"new","object":""}
+`
+	for _, policy := range []ConflictPolicy{Skip, Overwrite} {
+		t.Run(fmt.Sprint("policy ", policy), func(t *testing.T) {
+			dataStorage := storage.NewStorage()
+			dataStorage.Put("a", []byte{9}, "old")
+
+			report, err := Import(dataStorage, strings.NewReader(input), policy, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := dataStorage.Get("a")
+			if policy == Skip {
+				if report.Imported != 1 || report.Skipped != 1 {
+					t.Errorf("wrong report: %v", report)
+				}
+				if data.ContentType != "old" {
+					t.Errorf("key overwritten: %v", data)
+				}
+			} else {
+				if report.Imported != 2 || report.Skipped != 0 {
+					t.Errorf("wrong report: %v", report)
+				}
+				if data.ContentType != "new" || !bytes.Equal(data.Object, []byte{1, 2}) {
+					t.Errorf("key not overwritten: %v", data)
+				}
+			}
+			keys := dataStorage.Keys()
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+				t.Errorf("wrong keys: %v", keys)
+			}
+		})
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	validKey := func(key string) bool {
+		return key != "" && !strings.Contains(key, "-")
+	}
+	inputs := []string{
+		`{"key":"a-b","contentType":"","object":""}`,
+		`{"key":"","contentType":"","object":""}`,
+		`{"key":"a","contentType":"","object":"not base64!"}`,
+		`not json`,
+	}
+
+	for i, input := range inputs {
+		t.Run(fmt.Sprint("input ", i), func(t *testing.T) {
+			dataStorage := storage.NewStorage()
+			if _, err := Import(dataStorage, strings.NewReader(input), Overwrite, validKey); err == nil {
+				t.Error("invalid archive imported")
+			}
+			if keys := dataStorage.Keys(); len(keys) != 0 {
+				t.Errorf("invalid storage state: %v", keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// bootstrapKeySuffix is appended to name of the database file
+// to get name of the file with created admin API key.
+const bootstrapKeySuffix = ".admin-key"
+
+// jwtFlags configure validation of JWTs.
+type jwtFlags struct {
+	jwks     string
+	key      string
+	secret   string
+	issuer   string
+	audience string
+	claim    string
+}
+
+func (j jwtFlags) enabled() bool {
+	return j.jwks != "" || j.key != "" || j.secret != ""
+}
+
+// verifier returns JWT verifier accepting tokens signed with
+// all configured keys.
+func (j jwtFlags) verifier() (*auth.JWTVerifier, error) {
+	var keys []auth.JWTKey
+	if j.jwks != "" {
+		jwks, err := auth.LoadJWKS(j.jwks)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+	if j.key != "" {
+		key, err := auth.LoadPublicKey(j.key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if j.secret != "" {
+		key, err := auth.LoadSecret(j.secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewJWTVerifier(keys, j.issuer, j.audience, j.claim), nil
+}
+
+// startAuth creates authenticator accepting API keys stored
+// in db file, if apiKeys, JWTs if configured and client
+// certificates with identities from identitiesFile, if it is
+// not empty.
+// Returned handler manages API keys, it is nil without them. If there
+// are no keys, an admin key is created and written to a file next to
+// db, readable only by the owner. Only its ID is logged.
+func startAuth(db string, apiKeys bool, jwt jwtFlags, identitiesFile string) (*auth.Authenticator, http.Handler, error) {
+	var verifiers []auth.Verifier
+	var keysHandler http.Handler
+	if apiKeys {
+		keys, err := auth.NewKeyStore(persistence.NewMetaStore(db))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(keys.Credentials()) == 0 {
+			key, credential, err := keys.Create(context.Background(), "bootstrap", true, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			file := db + bootstrapKeySuffix
+			if err := writeBootstrapKey(file, key); err != nil {
+				if err := keys.Revoke(context.Background(), credential.Id); err != nil {
+					logger.Error("Failed to revoke admin API key", logging.Fields{"id": credential.Id, "error": err})
+				}
+				return nil, nil, err
+			}
+			logger.Warn("Created admin API key", logging.Fields{"id": credential.Id, "file": file})
+		}
+		keysHandler = keys.Handler()
+		verifiers = append(verifiers, keys)
+	}
+	if jwt.enabled() {
+		verifier, err := jwt.verifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		verifiers = append(verifiers, verifier)
+	}
+	authenticator := auth.NewAuthenticator(verifiers...)
+	if identitiesFile != "" {
+		identities, err := auth.LoadCertificateIdentities(identitiesFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		authenticator.AcceptCertificates(identities)
+	}
+	return authenticator, keysHandler, nil
+}
+
+// writeBootstrapKey writes key to a new file readable only
+// by the owner, replacing an old one left from removed database.
+func writeBootstrapKey(name, key string) error {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, key); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadToken reads bearer token from file, ignoring
+// surrounding whitespace.
+func loadToken(fileName string) (string, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", fmt.Errorf("empty token in %s", fileName)
+	}
+	return token, nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"strings"
+)
+
+// Permission allows a kind of access to objects.
+type Permission string
+
+const (
+	Read   Permission = "read"
+	Write  Permission = "write"
+	Delete Permission = "delete"
+)
+
+// Grant gives permissions to objects with keys starting with Prefix
+// in Namespace, the default one if it is empty.
+type Grant struct {
+	Namespace   string       `json:"namespace,omitempty"`
+	Prefix      string       `json:"prefix"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Identity is an authenticated client.
+// Admin identities are allowed everything, including
+// management of credentials.
+type Identity struct {
+	// Id tells the credential apart from all others, unlike Name.
+	// It is empty if the credential has no unique ID.
+	Id     string  `json:"-"`
+	Name   string  `json:"name"`
+	Admin  bool    `json:"admin"`
+	Grants []Grant `json:"grants"`
+}
+
+// Allowed reports whether identity has permission to all keys
+// starting with prefix in the default namespace, a single key
+// being its own prefix.
+func (i *Identity) Allowed(permission Permission, prefix string) bool {
+	return i.AllowedIn(namespace.Default, permission, prefix)
+}
+
+// AllowedIn works like Allowed for keys in namespace ns.
+func (i *Identity) AllowedIn(ns string, permission Permission, prefix string) bool {
+	if i.Admin {
+		return true
+	}
+	for _, grant := range i.Grants {
+		grantNs := grant.Namespace
+		if grantNs == "" {
+			grantNs = namespace.Default
+		}
+		if grantNs != ns || !strings.HasPrefix(prefix, grant.Prefix) {
+			continue
+		}
+		for _, granted := range grant.Permissions {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithIdentity returns ctx carrying identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// IdentityFrom returns identity carried by ctx, if any.
+func IdentityFrom(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok
+}
+
+// Allowed reports whether identity carried by ctx has permission
+// to keys starting with prefix. Contexts without identity come from
+// servers without authentication and are allowed everything.
+func Allowed(ctx context.Context, permission Permission, prefix string) bool {
+	if identity, ok := IdentityFrom(ctx); ok {
+		return identity.Allowed(permission, prefix)
+	}
+	return true
+}
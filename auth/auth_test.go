@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"testing"
+)
+
+func TestIdentity_Allowed(t *testing.T) {
+	identity := &Identity{Grants: []Grant{
+		{Prefix: "ab", Permissions: []Permission{Read}},
+		{Prefix: "abc", Permissions: []Permission{Write, Delete}},
+	}}
+	dataSets := []struct {
+		permission Permission
+		prefix     string
+		allowed    bool
+	}{
+		{Read, "ab", true},
+		{Read, "abx", true},
+		{Read, "a", false},
+		{Read, "", false},
+		{Write, "abc", true},
+		{Write, "abcd", true},
+		{Write, "abd", false},
+		{Delete, "abc1", true},
+		{Delete, "ab", false},
+	}
+	for _, dataSet := range dataSets {
+		if allowed := identity.Allowed(dataSet.permission, dataSet.prefix); allowed != dataSet.allowed {
+			t.Errorf("wrong result for %v %v: %v", dataSet.permission, dataSet.prefix, allowed)
+		}
+	}
+
+	admin := &Identity{Admin: true}
+	if !admin.Allowed(Delete, "") {
+		t.Error("admin not allowed")
+	}
+}
+
+func TestIdentity_AllowedIn(t *testing.T) {
+	identity := &Identity{Grants: []Grant{
+		{Prefix: "ab", Permissions: []Permission{Read}},
+		{Namespace: "team", Prefix: "", Permissions: []Permission{Write}},
+	}}
+	dataSets := []struct {
+		namespace  string
+		permission Permission
+		prefix     string
+		allowed    bool
+	}{
+		{namespace.Default, Read, "ab", true},
+		{"team", Read, "ab", false},
+		{"team", Write, "ab", true},
+		{namespace.Default, Write, "ab", false},
+		{"other", Write, "ab", false},
+	}
+	for _, dataSet := range dataSets {
+		if allowed := identity.AllowedIn(dataSet.namespace, dataSet.permission, dataSet.prefix); allowed != dataSet.allowed {
+			t.Errorf("wrong result for %v %v %v: %v", dataSet.namespace, dataSet.permission, dataSet.prefix, allowed)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	if !Allowed(context.Background(), Write, "key") {
+		t.Error("context without identity not allowed")
+	}
+	ctx := WithIdentity(context.Background(), &Identity{})
+	if Allowed(ctx, Read, "key") {
+		t.Error("identity without grants allowed")
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// CertificateIdentities maps subjects of client certificates,
+// formatted like "CN=client,O=Example", to their identities.
+type CertificateIdentities map[string]*Identity
+
+// LoadCertificateIdentities reads CertificateIdentities from
+// a JSON file, an object with subjects as keys and identities
+// as values. Identities without name are named after subjects.
+func LoadCertificateIdentities(fileName string) (CertificateIdentities, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var identities CertificateIdentities
+	if err := json.Unmarshal(contents, &identities); err != nil {
+		return nil, err
+	}
+	for subject, identity := range identities {
+		if identity == nil {
+			identity = &Identity{}
+			identities[subject] = identity
+		}
+		if identity.Name == "" {
+			identity.Name = subject
+		}
+	}
+	return identities, nil
+}
+
+// Identity returns identity of cert's subject, if any,
+// with Id made of cert's fingerprint.
+func (c CertificateIdentities) Identity(cert *x509.Certificate) (*Identity, bool) {
+	identity, ok := c[cert.Subject.String()]
+	if !ok {
+		return nil, false
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	certIdentity := *identity
+	certIdentity.Id = "cert " + hex.EncodeToString(fingerprint[:])
+	return &certIdentity, true
+}
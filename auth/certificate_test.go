@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCertificateIdentities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "GWP_certificate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "identities.json")
+	contents := `{
+		"CN=admin": {"name": "operator", "admin": true},
+		"CN=client,O=Example": {"grants": [{"prefix": "ab", "permissions": ["read"]}]}
+	}`
+	if err := ioutil.WriteFile(fileName, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := LoadCertificateIdentities(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CertificateIdentities{
+		"CN=admin": {Name: "operator", Admin: true},
+		"CN=client,O=Example": {Name: "CN=client,O=Example", Grants: []Grant{
+			{Prefix: "ab", Permissions: []Permission{Read}},
+		}},
+	}
+	if !reflect.DeepEqual(identities, expected) {
+		t.Errorf("wrong identities: %v", identities)
+	}
+
+	cert := &x509.Certificate{Raw: []byte{1}, Subject: pkix.Name{CommonName: "client", Organization: []string{"Example"}}}
+	identity, ok := identities.Identity(cert)
+	if !ok || identity.Name != "CN=client,O=Example" || identity.Id != "cert 4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a" {
+		t.Errorf("wrong identity: %+v %v", identity, ok)
+	}
+	other := &x509.Certificate{Raw: []byte{2}, Subject: cert.Subject}
+	if otherIdentity, _ := identities.Identity(other); otherIdentity.Id == identity.Id {
+		t.Error("certificates not told apart")
+	}
+	cert.Subject.CommonName = "other"
+	if _, ok := identities.Identity(cert); ok {
+		t.Error("identity of unknown subject")
+	}
+}
+
+func TestMiddlewareCertificates(t *testing.T) {
+	keys := newKeyStore(t, newMemStore())
+	apiKey, _, _ := keys.Create(context.Background(), "key", false, nil)
+	authenticator := NewAuthenticator(keys)
+	authenticator.AcceptCertificates(CertificateIdentities{
+		"CN=client": {Name: "client", Grants: []Grant{{Prefix: "ab", Permissions: []Permission{Read}}}},
+	})
+	var name string
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFrom(r.Context())
+		name = identity.Name
+	}))
+	withCert := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	dataSets := []struct {
+		url           string
+		state         *tls.ConnectionState
+		authorization string
+		code          int
+		name          string
+	}{
+		{"/abc", withCert("client"), "", http.StatusOK, "client"},
+		{"/xyz", withCert("client"), "", http.StatusForbidden, ""},
+		{"/abc", withCert("other"), "", http.StatusUnauthorized, ""},
+		{"/abc", &tls.ConnectionState{}, "", http.StatusUnauthorized, ""},
+		// Bearer token takes precedence.
+		{"/abc", withCert("client"), "Bearer " + apiKey, http.StatusForbidden, ""},
+	}
+	for i, dataSet := range dataSets {
+		name = ""
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", router.ObjectsUrl+dataSet.url, nil)
+		r.TLS = dataSet.state
+		if dataSet.authorization != "" {
+			r.Header.Set("Authorization", dataSet.authorization)
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != dataSet.code || name != dataSet.name {
+			t.Errorf("wrong result for request %d: %v %v", i, w.Code, name)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	keys := newKeyStore(t, newMemStore())
+	apiKey, _, _ := keys.Create(context.Background(), "key", false, nil)
+	authenticator := NewAuthenticator(keys)
+	authenticator.AcceptCertificates(CertificateIdentities{"CN=client": {Name: "client"}})
+	chain := func(commonName string) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}
+	}
+
+	dataSets := []struct {
+		token  string
+		chains [][]*x509.Certificate
+		name   string
+	}{
+		{apiKey, nil, "key"},
+		{"invalid", chain("client"), ""},
+		{"", chain("client"), "client"},
+		{"", chain("other"), ""},
+		{"", nil, ""},
+	}
+	for i, dataSet := range dataSets {
+		identity, ok := authenticator.Identify(dataSet.token, dataSet.chains)
+		if ok != (dataSet.name != "") || (ok && identity.Name != dataSet.name) {
+			t.Errorf("wrong identity for request %d: %v %v", i, identity, ok)
+		}
+	}
+}
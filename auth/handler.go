@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+const Url = "/api/auth"
+
+// Maximal size of a key creation request.
+const maxRequestSize = 10000
+
+// Valid prefixes of keys in grants.
+var prefixRegex = regexp.MustCompile("^[0-9a-zA-Z]{0,100}$")
+
+// Valid namespaces in grants.
+var namespaceRegex = regexp.MustCompile(namespace.NamePattern)
+
+// KeyRequest describes an API key to create.
+type KeyRequest struct {
+	Name   string  `json:"name"`
+	Admin  bool    `json:"admin"`
+	Grants []Grant `json:"grants"`
+}
+
+// CreatedKey is the response to a key creation request,
+// the only one holding the key.
+type CreatedKey struct {
+	Key string `json:"key"`
+	Credential
+}
+
+// Handler returns handler managing API keys, to be mounted under Url.
+func (k *KeyStore) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/keys", k.getKeys)
+	router.Post("/keys", k.postKey)
+	router.Delete("/keys/{id}", k.deleteKey)
+	return router
+}
+
+// getKeys writes credentials, without hashes, into body in JSON format.
+func (k *KeyStore) getKeys(w http.ResponseWriter, _ *http.Request) {
+	credentials := k.Credentials()
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].Created.Before(credentials[j].Created)
+	})
+	apierror.WriteJson(w, http.StatusOK, credentials)
+}
+
+// postKey creates an API key described by request's body,
+// writing it along with its credential and code http.StatusCreated.
+// If the description is invalid, writes code http.StatusBadRequest.
+func (k *KeyStore) postKey(w http.ResponseWriter, r *http.Request) {
+	var request KeyRequest
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid key description: "+err.Error())
+		return
+	}
+	if !validGrants(request.Grants) {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid grants")
+		return
+	}
+	if key, credential, err := k.Create(r.Context(), request.Name, request.Admin, request.Grants); err == nil {
+		credential.Hash = ""
+		apierror.WriteJson(w, http.StatusCreated, CreatedKey{key, credential})
+	} else {
+		panic(err)
+	}
+}
+
+// deleteKey revokes API key with request's id parameter,
+// writing code http.StatusNoContent, or http.StatusNotFound
+// if there is no such key.
+func (k *KeyStore) deleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := k.Revoke(r.Context(), chi.URLParam(r, "id")); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+	} else if err == CredentialAbsentError {
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, err.Error())
+	} else {
+		panic(err)
+	}
+}
+
+func validGrants(grants []Grant) bool {
+	for _, grant := range grants {
+		if !prefixRegex.MatchString(grant.Prefix) {
+			return false
+		}
+		if grant.Namespace != "" && !namespaceRegex.MatchString(grant.Namespace) {
+			return false
+		}
+		for _, permission := range grant.Permissions {
+			if permission != Read && permission != Write && permission != Delete {
+				return false
+			}
+		}
+	}
+	return true
+}
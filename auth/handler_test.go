@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpoints(t *testing.T) {
+	keys := newKeyStore(t, newMemStore())
+	handler := keys.Handler()
+
+	invalid := []string{
+		`{"name": "client", "grants": [{"prefix": "a-b", "permissions": ["read"]}]}`,
+		`{"name": "client", "grants": [{"prefix": "ab", "permissions": ["admin"]}]}`,
+		`{"name":`,
+	}
+	for _, body := range invalid {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/keys", bytes.NewBufferString(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong code for %v: %v", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	body := `{"name": "client", "grants": [{"prefix": "ab", "permissions": ["read", "delete"]}]}`
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/keys", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("wrong code: %v", w.Code)
+	}
+	var created CreatedKey
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Hash != "" || created.Name != "client" || len(created.Grants) != 1 {
+		t.Errorf("wrong credential: %+v", created)
+	}
+	if identity, err := keys.Verify(created.Key); err != nil || !identity.Allowed(Delete, "abc") {
+		t.Errorf("wrong identity of created key: %+v %v", identity, err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/keys", nil))
+	var credentials []Credential
+	if err := json.Unmarshal(w.Body.Bytes(), &credentials); err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 1 || credentials[0].Id != created.Id || credentials[0].Hash != "" {
+		t.Errorf("wrong credentials: %v", credentials)
+	}
+
+	for _, code := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/keys/"+created.Id, nil))
+		if w.Code != code {
+			t.Errorf("wrong code: %v", w.Code)
+		}
+	}
+}
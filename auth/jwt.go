@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+// DefaultClaim holds permissions of JWT subject as "<permission>:<prefix>"
+// entries or "admin", either space separated or in an array.
+const DefaultClaim = "scope"
+
+// Allowed difference between clocks of token issuer and server.
+const leeway = 1 * time.Minute
+
+var (
+	MalformedTokenError = errors.New("malformed token")
+	UnknownKeyError     = errors.New("no key for token")
+	SignatureError      = errors.New("invalid token signature")
+	ExpiredTokenError   = errors.New("token expired or not yet valid")
+	IssuerError         = errors.New("wrong token issuer")
+	AudienceError       = errors.New("wrong token audience")
+)
+
+// JWTKey is a key verifying JWT signatures, *rsa.PublicKey for RS256,
+// *ecdsa.PublicKey for ES256 and secret []byte for HS256.
+// Tokens with key ID in their header are verified only with key
+// of the same Id.
+type JWTKey struct {
+	Id        string
+	Algorithm string
+	Key       interface{}
+}
+
+// JWTVerifier validates signed JWTs, mapping their claims to identities.
+type JWTVerifier struct {
+	keys     []JWTKey
+	issuer   string
+	audience string
+	claim    string
+	now      func() time.Time
+}
+
+// NewJWTVerifier creates a verifier accepting tokens signed with keys.
+// If issuer or audience is not empty, tokens must have a matching
+// iss or aud claim. Permissions are read from claim.
+func NewJWTVerifier(keys []JWTKey, issuer, audience, claim string) *JWTVerifier {
+	return &JWTVerifier{keys: keys, issuer: issuer, audience: audience, claim: claim, now: time.Now}
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+// Verify validates token signature, expiry, issuer and audience,
+// returning identity with name from sub claim and grants from
+// permissions claim.
+func (v *JWTVerifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, MalformedTokenError
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, MalformedTokenError
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, MalformedTokenError
+	}
+	if err := v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, MalformedTokenError
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claimsIdentity(claims, v.claim), nil
+}
+
+// verifySignature checks signature of signed with any key
+// matching the header.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed, signature []byte) error {
+	found := false
+	for _, key := range v.keys {
+		if key.Algorithm != header.Algorithm || (header.KeyId != "" && key.Id != "" && key.Id != header.KeyId) {
+			continue
+		}
+		found = true
+		if verifyWithKey(key, signed, signature) {
+			return nil
+		}
+	}
+	if !found {
+		return UnknownKeyError
+	}
+	return SignatureError
+}
+
+func verifyWithKey(key JWTKey, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch publicKey := key.Key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, digest[:], r, s)
+	case []byte:
+		mac := hmac.New(sha256.New, publicKey)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	default:
+		return false
+	}
+}
+
+// checkClaims validates registered claims of a token.
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return ExpiredTokenError
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return ExpiredTokenError
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return IssuerError
+	}
+	if v.audience != "" && !containsString(claims["aud"], v.audience) {
+		return AudienceError
+	}
+	return nil
+}
+
+// claimsIdentity maps claims to identity. Entries of permissions
+// claim are "admin" or "<permission>:<prefix>", where prefix may be empty
+// and may be preceded by "<namespace>/".
+func claimsIdentity(claims map[string]interface{}, claim string) *Identity {
+	identity := &Identity{Grants: []Grant{}}
+	identity.Name, _ = claims["sub"].(string)
+	if identity.Name != "" {
+		issuer, _ := claims["iss"].(string)
+		identity.Id = fmt.Sprintf("jwt %q %q", issuer, identity.Name)
+	}
+	var entries []string
+	switch value := claims[claim].(type) {
+	case string:
+		entries = strings.Fields(value)
+	case []interface{}:
+		for _, entry := range value {
+			if entry, ok := entry.(string); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	for _, entry := range entries {
+		if entry == "admin" {
+			identity.Admin = true
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		permission := Permission(parts[0])
+		if permission != Read && permission != Write && permission != Delete {
+			continue
+		}
+		grant := Grant{Permissions: []Permission{permission}}
+		if len(parts) == 2 {
+			grant.Prefix = parts[1]
+			if i := strings.Index(grant.Prefix, "/"); i >= 0 {
+				grant.Namespace, grant.Prefix = grant.Prefix[:i], grant.Prefix[i+1:]
+			}
+		}
+		identity.Grants = append(identity.Grants, grant)
+	}
+	return identity
+}
+
+// containsString reports whether value is s or an array containing s.
+func containsString(value interface{}, s string) bool {
+	switch value := value.(type) {
+	case string:
+		return value == s
+	case []interface{}:
+		for _, element := range value {
+			if element == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, value)
+}
+
+// jwk is a single key of a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS reads signing keys from a JSON Web Key Set file.
+// Keys of unsupported types or not meant for signatures are skipped.
+func LoadJWKS(fileName string) ([]JWTKey, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(contents, &set); err != nil {
+		return nil, err
+	}
+	var keys []JWTKey
+	for i, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		jwtKey, err := key.parse()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i, err)
+		}
+		if jwtKey.Key != nil {
+			keys = append(keys, jwtKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys in %s", fileName)
+	}
+	return keys, nil
+}
+
+// parse returns key described by jwk, with nil Key if its type
+// is not supported.
+func (j jwk) parse() (JWTKey, error) {
+	key := JWTKey{Id: j.Kid}
+	var err error
+	switch {
+	case j.Kty == "RSA":
+		var n, e *big.Int
+		if n, err = decodeInt(j.N); err == nil {
+			e, err = decodeInt(j.E)
+		}
+		if err == nil {
+			key.Algorithm = RS256
+			key.Key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		}
+	case j.Kty == "EC" && j.Crv == "P-256":
+		var x, y *big.Int
+		if x, err = decodeInt(j.X); err == nil {
+			y, err = decodeInt(j.Y)
+		}
+		if err == nil {
+			key.Algorithm = ES256
+			key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	case j.Kty == "oct":
+		var secret []byte
+		if secret, err = base64.RawURLEncoding.DecodeString(j.K); err == nil {
+			key.Algorithm = HS256
+			key.Key = secret
+		}
+	}
+	return key, err
+}
+
+func decodeInt(segment string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+// LoadPublicKey reads an RSA or P-256 ECDSA public key
+// from a PEM file.
+func LoadPublicKey(fileName string) (JWTKey, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return JWTKey{}, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return JWTKey{}, fmt.Errorf("no PEM data in %s", fileName)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return JWTKey{}, err
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWTKey{Algorithm: RS256, Key: publicKey}, nil
+	case *ecdsa.PublicKey:
+		if publicKey.Curve != elliptic.P256() {
+			return JWTKey{}, fmt.Errorf("unsupported curve in %s", fileName)
+		}
+		return JWTKey{Algorithm: ES256, Key: publicKey}, nil
+	default:
+		return JWTKey{}, fmt.Errorf("unsupported key type in %s", fileName)
+	}
+}
+
+// LoadSecret reads an HS256 secret from a file,
+// ignoring surrounding whitespace.
+func LoadSecret(fileName string) (JWTKey, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return JWTKey{}, err
+	}
+	secret := strings.TrimSpace(string(contents))
+	if secret == "" {
+		return JWTKey{}, fmt.Errorf("empty secret in %s", fileName)
+	}
+	return JWTKey{Algorithm: HS256, Key: []byte(secret)}, nil
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// signToken creates a JWT signed with private key, an *rsa.PrivateKey,
+// *ecdsa.PrivateKey or []byte.
+func signToken(t *testing.T, header map[string]string, claims map[string]interface{}, privateKey interface{}) string {
+	encode := func(value interface{}) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	var err error
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err == nil {
+			// Both halves are padded to 32 bytes.
+			signature = make([]byte, 64)
+			copy(signature[32-len(r.Bytes()):32], r.Bytes())
+			copy(signature[64-len(s.Bytes()):], s.Bytes())
+		}
+	case []byte:
+		mac := hmac.New(sha256.New, privateKey)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+type testKeys struct {
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+	secret []byte
+}
+
+func generateKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsaKey, ecKey, []byte("secret")}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	keys := generateKeys(t)
+	verifier := NewJWTVerifier([]JWTKey{
+		{Id: "rsa", Algorithm: RS256, Key: &keys.rsa.PublicKey},
+		{Id: "ec", Algorithm: ES256, Key: &keys.ec.PublicKey},
+		{Algorithm: HS256, Key: keys.secret},
+	}, "https://issuer", "gwp", DefaultClaim)
+	now := time.Unix(1600000000, 0)
+	verifier.now = func() time.Time {
+		return now
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "client",
+			"iss":   "https://issuer",
+			"aud":   []string{"other", "gwp"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "read:user write:user delete: unknown:x",
+		}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	dataSets := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"RS256", signToken(t, map[string]string{"alg": RS256, "kid": "rsa"}, valid(), keys.rsa), nil},
+		{"RS256 without kid", signToken(t, map[string]string{"alg": RS256}, valid(), keys.rsa), nil},
+		{"ES256", signToken(t, map[string]string{"alg": ES256, "kid": "ec"}, valid(), keys.ec), nil},
+		{"HS256", signToken(t, map[string]string{"alg": HS256}, valid(), keys.secret), nil},
+		{"audience string", signToken(t, map[string]string{"alg": HS256}, with("aud", "gwp"), keys.secret), nil},
+		{"expiry within leeway", signToken(t, map[string]string{"alg": HS256}, with("exp", now.Add(-30*time.Second).Unix()), keys.secret), nil},
+		{"wrong kid", signToken(t, map[string]string{"alg": RS256, "kid": "ec"}, valid(), keys.rsa), UnknownKeyError},
+		{"none", signToken(t, map[string]string{"alg": "none"}, valid(), nil), UnknownKeyError},
+		{"wrong secret", signToken(t, map[string]string{"alg": HS256}, valid(), []byte("other")), SignatureError},
+		{"expired", signToken(t, map[string]string{"alg": HS256}, with("exp", now.Add(-time.Hour).Unix()), keys.secret), ExpiredTokenError},
+		{"no expiry", signToken(t, map[string]string{"alg": HS256}, with("exp", nil), keys.secret), ExpiredTokenError},
+		{"not yet valid", signToken(t, map[string]string{"alg": HS256}, with("nbf", now.Add(time.Hour).Unix()), keys.secret), ExpiredTokenError},
+		{"wrong issuer", signToken(t, map[string]string{"alg": HS256}, with("iss", "https://other"), keys.secret), IssuerError},
+		{"wrong audience", signToken(t, map[string]string{"alg": HS256}, with("aud", "other"), keys.secret), AudienceError},
+		{"no audience", signToken(t, map[string]string{"alg": HS256}, with("aud", nil), keys.secret), AudienceError},
+		{"malformed", "abc.def", MalformedTokenError},
+		{"API key", "gwp_0_0", MalformedTokenError},
+	}
+	for _, dataSet := range dataSets {
+		t.Run(dataSet.name, func(t *testing.T) {
+			identity, err := verifier.Verify(dataSet.token)
+			if err != dataSet.err {
+				t.Fatalf("wrong error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			expected := &Identity{Id: `jwt "https://issuer" "client"`, Name: "client", Grants: []Grant{
+				{Prefix: "user", Permissions: []Permission{Read}},
+				{Prefix: "user", Permissions: []Permission{Write}},
+				{Prefix: "", Permissions: []Permission{Delete}},
+			}}
+			if !reflect.DeepEqual(identity, expected) {
+				t.Errorf("wrong identity: %+v", identity)
+			}
+		})
+	}
+
+	token := signToken(t, map[string]string{"alg": HS256}, with("scope", []string{"admin"}), keys.secret)
+	if identity, err := verifier.Verify(token); err != nil || !identity.Admin {
+		t.Errorf("wrong identity: %+v %v", identity, err)
+	}
+	token = signToken(t, map[string]string{"alg": HS256}, with("scope", "read:team/user write:team/"), keys.secret)
+	expected := []Grant{
+		{Namespace: "team", Prefix: "user", Permissions: []Permission{Read}},
+		{Namespace: "team", Prefix: "", Permissions: []Permission{Write}},
+	}
+	if identity, err := verifier.Verify(token); err != nil || !reflect.DeepEqual(identity.Grants, expected) {
+		t.Errorf("wrong namespace grants: %+v %v", identity, err)
+	}
+	token = signToken(t, map[string]string{"alg": HS256}, valid(), keys.secret)
+	if _, err := verifier.Verify(token[:len(token)-2] + "AA"); err != SignatureError {
+		t.Errorf("tampered token accepted: %v", err)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	keys := generateKeys(t)
+	dir, err := ioutil.TempDir("", "GWP_jwt_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	encodeInt := func(n interface{ Bytes() []byte }) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": "%s", "e": "AQAB"},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "%s", "y": "%s"},
+		{"kty": "oct", "kid": "hmac", "k": "%s"},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "%s", "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"}
+	]}`, encodeInt(keys.rsa.N), encodeInt(keys.ec.X), encodeInt(keys.ec.Y),
+		base64.RawURLEncoding.EncodeToString(keys.secret), encodeInt(keys.rsa.N))
+	jwksFile := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(jwksFile, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadJWKS(jwksFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JWTKey{
+		{Id: "rsa", Algorithm: RS256, Key: &keys.rsa.PublicKey},
+		{Id: "ec", Algorithm: ES256, Key: &keys.ec.PublicKey},
+		{Id: "hmac", Algorithm: HS256, Key: keys.secret},
+	}
+	if len(loaded) != len(expected) {
+		t.Fatalf("wrong keys: %v", loaded)
+	}
+	for i := range expected {
+		if loaded[i].Id != expected[i].Id || loaded[i].Algorithm != expected[i].Algorithm {
+			t.Errorf("wrong key: %+v", loaded[i])
+		}
+	}
+	if !reflect.DeepEqual(loaded[0].Key, expected[0].Key) || !reflect.DeepEqual(loaded[2].Key, expected[2].Key) {
+		t.Error("wrong key material")
+	}
+	ecKey := loaded[1].Key.(*ecdsa.PublicKey)
+	if ecKey.X.Cmp(keys.ec.X) != 0 || ecKey.Y.Cmp(keys.ec.Y) != 0 {
+		t.Error("wrong EC key")
+	}
+
+	for _, privateKey := range []crypto.Signer{keys.rsa, keys.ec} {
+		der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pemFile := filepath.Join(dir, "key.pem")
+		if err := ioutil.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadPublicKey(pemFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(key.Key, privateKey.Public()) {
+			t.Errorf("wrong key loaded: %+v", key)
+		}
+	}
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := LoadSecret(secretFile); err != nil || key.Algorithm != HS256 || string(key.Key.([]byte)) != "secret" {
+		t.Errorf("wrong secret: %+v %v", key, err)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keysBucket = "GWP_api_keys"
+	keyPrefix  = "gwp_"
+)
+
+var (
+	InvalidKeyError       = errors.New("invalid API key")
+	CredentialAbsentError = errors.New("API key not found")
+)
+
+// Store persists credentials, implemented by persistence.MetaStore.
+type Store interface {
+	Load(bucketName string) (map[string][]byte, error)
+	Put(ctx context.Context, bucketName, key string, record []byte) error
+	Delete(ctx context.Context, bucketName, key string) error
+}
+
+// Credential describes an API key. The key itself is not stored,
+// only its SHA-256 Hash.
+type Credential struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash,omitempty"`
+	Admin   bool      `json:"admin"`
+	Grants  []Grant   `json:"grants"`
+	Created time.Time `json:"created"`
+}
+
+// KeyStore manages API keys of the form gwp_<id>_<secret>.
+type KeyStore struct {
+	store       Store
+	mut         sync.RWMutex
+	credentials map[string]Credential
+}
+
+// NewKeyStore loads credentials from store.
+func NewKeyStore(store Store) (*KeyStore, error) {
+	records, err := store.Load(keysBucket)
+	if err != nil {
+		return nil, err
+	}
+	k := &KeyStore{store: store, credentials: make(map[string]Credential)}
+	for id, record := range records {
+		var credential Credential
+		if err := json.Unmarshal(record, &credential); err != nil {
+			return nil, fmt.Errorf("API key %s: %v", id, err)
+		}
+		k.credentials[id] = credential
+	}
+	return k, nil
+}
+
+// Create generates a new API key, returning it along with its credential.
+// The key cannot be retrieved later.
+func (k *KeyStore) Create(ctx context.Context, name string, admin bool, grants []Grant) (string, Credential, error) {
+	id := randomHex(8)
+	key := keyPrefix + id + "_" + randomHex(32)
+	if grants == nil {
+		grants = []Grant{}
+	}
+	credential := Credential{Id: id, Name: name, Hash: hash(key), Admin: admin, Grants: grants, Created: time.Now().UTC()}
+	record, err := json.Marshal(credential)
+	if err != nil {
+		panic(err)
+	}
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if err := k.store.Put(ctx, keysBucket, id, record); err != nil {
+		return "", Credential{}, err
+	}
+	k.credentials[id] = credential
+	return key, credential, nil
+}
+
+// Revoke removes credential with id.
+func (k *KeyStore) Revoke(ctx context.Context, id string) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if _, ok := k.credentials[id]; !ok {
+		return CredentialAbsentError
+	}
+	if err := k.store.Delete(ctx, keysBucket, id); err != nil {
+		return err
+	}
+	delete(k.credentials, id)
+	return nil
+}
+
+// Credentials returns all credentials, without hashes.
+func (k *KeyStore) Credentials() []Credential {
+	k.mut.RLock()
+	defer k.mut.RUnlock()
+	credentials := make([]Credential, 0, len(k.credentials))
+	for _, credential := range k.credentials {
+		credential.Hash = ""
+		credentials = append(credentials, credential)
+	}
+	return credentials
+}
+
+// Verify returns identity of API key,
+// or InvalidKeyError if the key is not valid.
+func (k *KeyStore) Verify(key string) (*Identity, error) {
+	parts := strings.Split(strings.TrimPrefix(key, keyPrefix), "_")
+	if !strings.HasPrefix(key, keyPrefix) || len(parts) != 2 {
+		return nil, InvalidKeyError
+	}
+	k.mut.RLock()
+	credential, ok := k.credentials[parts[0]]
+	k.mut.RUnlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(hash(key)), []byte(credential.Hash)) != 1 {
+		return nil, InvalidKeyError
+	}
+	return &Identity{Id: "key " + credential.Id, Name: credential.Name, Admin: credential.Admin, Grants: credential.Grants}, nil
+}
+
+// API keys are random, so a fast hash is enough.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
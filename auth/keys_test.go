@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memStore is a Store keeping records in memory.
+type memStore struct {
+	mut     sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (m *memStore) Load(bucketName string) (map[string][]byte, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	records := make(map[string][]byte)
+	for key, record := range m.buckets[bucketName] {
+		records[key] = record
+	}
+	return records, nil
+}
+
+func (m *memStore) Put(_ context.Context, bucketName, key string, record []byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.buckets[bucketName] == nil {
+		m.buckets[bucketName] = make(map[string][]byte)
+	}
+	m.buckets[bucketName][key] = record
+	return nil
+}
+
+func (m *memStore) Delete(_ context.Context, bucketName, key string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.buckets[bucketName], key)
+	return nil
+}
+
+func newKeyStore(t *testing.T, store Store) *KeyStore {
+	keys, err := NewKeyStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestKeyStore(t *testing.T) {
+	store := newMemStore()
+	keys := newKeyStore(t, store)
+	grants := []Grant{{Prefix: "ab", Permissions: []Permission{Read}}}
+	key, credential, err := keys.Create(context.Background(), "client", false, grants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "gwp_"+credential.Id+"_") || credential.Name != "client" {
+		t.Errorf("wrong key or credential: %v %+v", key, credential)
+	}
+	if record := store.buckets[keysBucket][credential.Id]; strings.Contains(string(record), key) {
+		t.Error("key stored in plain text")
+	}
+
+	// Keys survive restart.
+	keys = newKeyStore(t, store)
+	identity, err := keys.Verify(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Id != "key "+credential.Id || identity.Name != "client" || identity.Admin || len(identity.Grants) != 1 || identity.Grants[0].Prefix != "ab" {
+		t.Errorf("wrong identity: %+v", identity)
+	}
+	credentials := keys.Credentials()
+	if len(credentials) != 1 || credentials[0].Id != credential.Id || credentials[0].Hash != "" {
+		t.Errorf("wrong credentials: %v", credentials)
+	}
+
+	invalid := []string{"", "gwp_", key + "0", strings.TrimPrefix(key, "gwp_"), "gwp_" + credential.Id + "_00"}
+	for _, key := range invalid {
+		if _, err := keys.Verify(key); err != InvalidKeyError {
+			t.Errorf("wrong error for %v: %v", key, err)
+		}
+	}
+
+	if err := keys.Revoke(context.Background(), credential.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Verify(key); err != InvalidKeyError {
+		t.Errorf("revoked key valid: %v", err)
+	}
+	if err := keys.Revoke(context.Background(), credential.Id); err != CredentialAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if len(store.buckets[keysBucket]) != 0 {
+		t.Error("revoked key not removed from store")
+	}
+}
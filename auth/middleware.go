@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"net/http"
+	"strings"
+)
+
+const Realm = "gwp"
+
+// Rule decides whether identity is allowed to perform request.
+type Rule func(identity *Identity, r *http.Request) bool
+
+type pathRule struct {
+	path string
+	rule Rule
+}
+
+// Verifier returns identity of a bearer token.
+// Implemented by KeyStore and JWTVerifier.
+type Verifier interface {
+	Verify(token string) (*Identity, error)
+}
+
+// Authenticator authenticates requests with bearer tokens
+// or client certificates and authorizes them with rules
+// chosen by request path.
+type Authenticator struct {
+	verifiers    []Verifier
+	certificates CertificateIdentities
+	rules        []pathRule
+}
+
+// NewAuthenticator creates an Authenticator accepting tokens
+// valid for any of verifiers, with rules for objects, events
+// and namespaces endpoints. Other requests require an admin identity, unless
+// given a rule with Authorize.
+func NewAuthenticator(verifiers ...Verifier) *Authenticator {
+	a := &Authenticator{verifiers: verifiers}
+	a.Authorize(router.ObjectsUrl, objectsRule)
+	a.Authorize(events.Url, eventsRule)
+	a.Authorize(namespace.Url, namespacesRule)
+	return a
+}
+
+// AcceptCertificates makes requests without bearer token
+// authenticated with verified client certificates of subjects
+// present in identities.
+func (a *Authenticator) AcceptCertificates(identities CertificateIdentities) {
+	a.certificates = identities
+}
+
+// Authorize sets rule for requests to path and paths under it.
+func (a *Authenticator) Authorize(path string, rule Rule) {
+	a.rules = append(a.rules, pathRule{path, rule})
+}
+
+// Authenticated is a Rule allowing all authenticated identities,
+// for handlers authorizing requests on their own with Allowed.
+func Authenticated(*Identity, *http.Request) bool {
+	return true
+}
+
+// Middleware stops requests without valid token or certificate with code
+// http.StatusUnauthorized and requests not allowed by rules with
+// code http.StatusForbidden, setting WWW-Authenticate header.
+// Identity of allowed requests is passed in their context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var identity *Identity
+		authorization := r.Header.Get("Authorization")
+		if strings.HasPrefix(authorization, "Bearer ") {
+			var ok bool
+			identity, ok = a.verify(strings.TrimPrefix(authorization, "Bearer "))
+			if !ok {
+				challenge(w, r, http.StatusUnauthorized, "invalid_token")
+				return
+			}
+		} else if certIdentity, ok := a.certificateIdentity(r); ok {
+			identity = certIdentity
+		} else {
+			challenge(w, r, http.StatusUnauthorized, "")
+			return
+		}
+		logging.Annotate(r.Context(), logging.Fields{"identity": identity.Name})
+		if !a.rule(r.URL.Path)(identity, r) {
+			challenge(w, r, http.StatusForbidden, "insufficient_scope")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+func (a *Authenticator) verify(token string) (*Identity, bool) {
+	for _, verifier := range a.verifiers {
+		if identity, err := verifier.Verify(token); err == nil {
+			return identity, true
+		}
+	}
+	return nil, false
+}
+
+// certificateIdentity returns identity of request's verified
+// client certificate, if it is accepted.
+func (a *Authenticator) certificateIdentity(r *http.Request) (*Identity, bool) {
+	if r.TLS == nil {
+		return nil, false
+	}
+	return a.chainIdentity(r.TLS.VerifiedChains)
+}
+
+func (a *Authenticator) chainIdentity(verifiedChains [][]*x509.Certificate) (*Identity, bool) {
+	if a.certificates == nil || len(verifiedChains) == 0 {
+		return nil, false
+	}
+	return a.certificates.Identity(verifiedChains[0][0])
+}
+
+// Identify returns identity of bearer token or, if it is empty, of client
+// certificate verified with verifiedChains, so that servers other than
+// HTTP ones can authenticate clients. Such servers authorize requests
+// on their own, with Allowed.
+func (a *Authenticator) Identify(token string, verifiedChains [][]*x509.Certificate) (*Identity, bool) {
+	if token != "" {
+		return a.verify(token)
+	}
+	return a.chainIdentity(verifiedChains)
+}
+
+// rule returns rule for path, the one for admin identities if none is set.
+func (a *Authenticator) rule(path string) Rule {
+	for _, pathRule := range a.rules {
+		if path == pathRule.path || strings.HasPrefix(path, pathRule.path+"/") {
+			return pathRule.rule
+		}
+	}
+	return func(identity *Identity, _ *http.Request) bool {
+		return identity.Admin
+	}
+}
+
+// challenge writes error response with code and WWW-Authenticate
+// header, including error if it is not empty.
+func challenge(w http.ResponseWriter, r *http.Request, code int, error string) {
+	value := fmt.Sprintf(`Bearer realm="%s"`, Realm)
+	if error != "" {
+		value += fmt.Sprintf(`, error="%s"`, error)
+	}
+	w.Header().Set("WWW-Authenticate", value)
+	switch error {
+	case "":
+		apierror.Write(w, r, code, apierror.Unauthorized, "authentication required")
+	case "invalid_token":
+		apierror.Write(w, r, code, apierror.Unauthorized, "invalid token")
+	default:
+		apierror.Write(w, r, code, apierror.Forbidden, "insufficient permissions")
+	}
+}
+
+// objectsRule requires read permission to all keys for listing them,
+// and permission matching request method to the requested key.
+func objectsRule(identity *Identity, r *http.Request) bool {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, router.ObjectsUrl), "/")
+	return objectsAllowed(identity, r.Method, namespace.Default, key)
+}
+
+// namespacesRule applies objectsRule to objects of namespaces.
+// Other requests require an admin identity.
+func namespacesRule(identity *Identity, r *http.Request) bool {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, namespace.Url), "/")
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 2 || parts[1] != "objects" {
+		return identity.Admin
+	}
+	var key string
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+	return objectsAllowed(identity, r.Method, parts[0], key)
+}
+
+// objectsAllowed reports whether identity is allowed request with method
+// to key in namespace ns, or listing all keys if key is empty.
+func objectsAllowed(identity *Identity, method, ns, key string) bool {
+	if key == "" {
+		return identity.AllowedIn(ns, Read, "")
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return identity.AllowedIn(ns, Read, key)
+	case http.MethodPut:
+		return identity.AllowedIn(ns, Write, key)
+	case http.MethodDelete:
+		return identity.AllowedIn(ns, Delete, key)
+	default:
+		return true
+	}
+}
+
+// eventsRule requires read permission to keys with the requested prefix.
+func eventsRule(identity *Identity, r *http.Request) bool {
+	return identity.Allowed(Read, r.URL.Query().Get("prefix"))
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	keys := newKeyStore(t, newMemStore())
+	adminKey, _, _ := keys.Create(context.Background(), "admin", true, nil)
+	clientKey, _, _ := keys.Create(context.Background(), "client", false, []Grant{
+		{Prefix: "ab", Permissions: []Permission{Read, Write}},
+		{Namespace: "team", Prefix: "", Permissions: []Permission{Read}},
+	})
+	authenticator := NewAuthenticator(keys)
+	authenticator.Authorize("/api/open", Authenticated)
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := IdentityFrom(r.Context()); !ok {
+			t.Error("identity not passed")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	dataSets := []struct {
+		method        string
+		url           string
+		authorization string
+		code          int
+		challenge     string
+	}{
+		{"GET", router.ObjectsUrl + "/abc", "", http.StatusUnauthorized, `Bearer realm="gwp"`},
+		{"GET", router.ObjectsUrl + "/abc", "Basic abc", http.StatusUnauthorized, `Bearer realm="gwp"`},
+		{"GET", router.ObjectsUrl + "/abc", "Bearer gwp_0_0", http.StatusUnauthorized, `Bearer realm="gwp", error="invalid_token"`},
+		{"GET", router.ObjectsUrl + "/abc", "Bearer " + clientKey, http.StatusOK, ""},
+		{"PUT", router.ObjectsUrl + "/abc", "Bearer " + clientKey, http.StatusOK, ""},
+		{"DELETE", router.ObjectsUrl + "/abc", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", router.ObjectsUrl + "/xyz", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", router.ObjectsUrl, "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", router.ObjectsUrl, "Bearer " + adminKey, http.StatusOK, ""},
+		{"GET", events.Url + "?prefix=abc", "Bearer " + clientKey, http.StatusOK, ""},
+		{"GET", events.Url, "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", "/api/open", "Bearer " + clientKey, http.StatusOK, ""},
+		{"GET", namespace.Url + "/team/objects", "Bearer " + clientKey, http.StatusOK, ""},
+		{"GET", namespace.Url + "/team/objects/xyz", "Bearer " + clientKey, http.StatusOK, ""},
+		{"PUT", namespace.Url + "/team/objects/ab", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", namespace.Url + "/other/objects/ab", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"PUT", namespace.Url + "/default/objects/ab", "Bearer " + clientKey, http.StatusOK, ""},
+		{"GET", namespace.Url + "/team", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"PUT", namespace.Url + "/team", "Bearer " + adminKey, http.StatusOK, ""},
+		{"GET", Url + "/keys", "Bearer " + clientKey, http.StatusForbidden, `Bearer realm="gwp", error="insufficient_scope"`},
+		{"GET", Url + "/keys", "Bearer " + adminKey, http.StatusOK, ""},
+	}
+	for _, dataSet := range dataSets {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(dataSet.method, dataSet.url, nil)
+		if dataSet.authorization != "" {
+			r.Header.Set("Authorization", dataSet.authorization)
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != dataSet.code {
+			t.Errorf("wrong code for %v %v: %v", dataSet.method, dataSet.url, w.Code)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); challenge != dataSet.challenge {
+			t.Errorf("wrong challenge for %v %v: %v", dataSet.method, dataSet.url, challenge)
+		}
+	}
+}
+
+func TestMiddlewareVerifiers(t *testing.T) {
+	keys := newKeyStore(t, newMemStore())
+	apiKey, _, _ := keys.Create(context.Background(), "client", true, nil)
+	secret := []byte("secret")
+	jwtVerifier := NewJWTVerifier([]JWTKey{{Algorithm: HS256, Key: secret}}, "", "", DefaultClaim)
+	claims := map[string]interface{}{"sub": "jwt", "exp": time.Now().Add(time.Hour).Unix(), "scope": "read:ab"}
+	token := signToken(t, map[string]string{"alg": HS256}, claims, secret)
+
+	var name string
+	handler := NewAuthenticator(keys, jwtVerifier).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFrom(r.Context())
+		name = identity.Name
+	}))
+	for bearer, expected := range map[string]string{apiKey: "client", token: "jwt"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", router.ObjectsUrl+"/abc", nil)
+		r.Header.Set("Authorization", "Bearer "+bearer)
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || name != expected {
+			t.Errorf("wrong result for %v: %v %v", expected, w.Code, name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetries = 3                      // retries of a failed request
+	InitialBackoff = 100 * time.Millisecond // delay before the first retry
+	MaxBackoff     = 10 * time.Second       // maximal delay between retries
+)
+
+// Errors returned for responses with these codes are the errors
+// of the storage package, so that code written against storage.Storage
+// can compare them the same way.
+var (
+	KeyAbsentError     = storage.KeyAbsentError
+	UnavailableError   = storage.UnavailableError
+	QuotaExceededError = storage.QuotaExceededError
+	NotModifiedError   = errors.New("object not modified")
+)
+
+// Error is an error response of the server other than
+// the ones reported with errors of the storage package.
+type Error apierror.Error
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+	if e.RequestId != "" {
+		message += " (request " + e.RequestId + ")"
+	}
+	return message
+}
+
+// Client talks to HTTP API of the server at address url,
+// e.g. http://127.0.0.1:8080. Requests are bounded by their
+// contexts only, since blocking queries may take minutes.
+// Fields may be changed before the first request.
+type Client struct {
+	HttpClient *http.Client
+	// Token is sent in Authorization header, if not empty.
+	Token string
+	// Retries is number of retries of requests failing with
+	// http.StatusTooManyRequests or a server error meant to be
+	// temporary. Requests with bodies which cannot be read again
+	// are not retried.
+	Retries int
+
+	url            string
+	objectsUrl     string
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func New(url string) *Client {
+	url = strings.TrimSuffix(url, "/")
+	return &Client{
+		HttpClient:     &http.Client{},
+		Retries:        DefaultRetries,
+		url:            url,
+		objectsUrl:     url + router.ObjectsUrl,
+		initialBackoff: InitialBackoff,
+		maxBackoff:     MaxBackoff,
+	}
+}
+
+// Namespace returns copy of the client accessing objects
+// of namespace name instead of the default one.
+func (c *Client) Namespace(name string) *Client {
+	namespaced := *c
+	namespaced.objectsUrl = c.url + namespace.Url + "/" + name + "/objects"
+	return &namespaced
+}
+
+// retryable tells whether request failing with code may succeed later.
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends request, retrying with exponential backoff or after time
+// given in Retry-After header. Returns response with code expected,
+// with body to be closed by the caller, or an error chosen
+// by responseError.
+func (c *Client) do(request *http.Request, expected int) (*http.Response, error) {
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	backoff := c.initialBackoff
+	for attempt := 0; ; attempt++ {
+		response, err := c.HttpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == expected {
+			return response, nil
+		}
+		err = responseError(response)
+		if !retryable(response.StatusCode) || attempt == c.Retries ||
+			(request.Body != nil && request.GetBody == nil) {
+			return nil, err
+		}
+
+		delay := backoff
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+		if request.GetBody != nil {
+			if request.Body, err = request.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// responseError reads and closes body of an error response,
+// returning error of the storage package for its code, if there
+// is one, or *Error.
+func responseError(response *http.Response) error {
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	var envelope apierror.Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error.Code == "" {
+		// Not from the server, e.g. from a proxy.
+		return &Error{
+			Status:  response.StatusCode,
+			Code:    strings.ToLower(strings.Replace(http.StatusText(response.StatusCode), " ", "_", -1)),
+			Message: strings.TrimSpace(string(body)),
+		}
+	}
+	switch envelope.Error.Code {
+	case apierror.KeyNotFound:
+		return KeyAbsentError
+	case apierror.Unavailable:
+		return UnavailableError
+	case apierror.QuotaExceeded:
+		return QuotaExceededError
+	default:
+		e := Error(envelope.Error)
+		return &e
+	}
+}
+
+// newRequest creates request with context ctx and body, which
+// can be read again for retries if it is an io.Seeker supporting
+// seeks, unlike e.g. *os.File of a pipe.
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	r := body
+	if _, ok := body.(io.Closer); ok {
+		// Closing it is left to the caller.
+		r = ioutil.NopCloser(body)
+	}
+	request, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok || request.GetBody != nil {
+		return request.WithContext(ctx), nil
+	}
+	if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+		request.GetBody = func() (io.ReadCloser, error) {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(body), nil
+		}
+	}
+	return request.WithContext(ctx), nil
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers requests with codes in turn,
+// recording bodies of the requests.
+type scriptedServer struct {
+	codes  []int
+	bodies []string
+	header http.Header
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	s.header = r.Header
+	code := s.codes[0]
+	if len(s.codes) > 1 {
+		s.codes = s.codes[1:]
+	}
+	switch code {
+	case http.StatusCreated:
+		w.WriteHeader(code)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Retry-After", "0")
+		apierror.Write(w, r, code, apierror.RateLimited, "too many requests")
+	case http.StatusBadGateway:
+		http.Error(w, "proxy down", code)
+	case http.StatusServiceUnavailable:
+		apierror.Write(w, r, code, apierror.Unavailable, "storage unavailable")
+	default:
+		apierror.Write(w, r, code, apierror.Internal, "internal server error")
+	}
+}
+
+func newScriptedClient(codes ...int) (*Client, *scriptedServer, func()) {
+	script := &scriptedServer{codes: codes}
+	server := httptest.NewServer(script)
+	c := New(server.URL + "/")
+	c.initialBackoff = time.Millisecond
+	c.maxBackoff = 4 * time.Millisecond
+	return c, script, server.Close
+}
+
+func TestRetries(t *testing.T) {
+	c, script, stop := newScriptedClient(http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusCreated)
+	defer stop()
+	if err := c.Put(context.Background(), "key", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"data", "data", "data"}
+	if strings.Join(script.bodies, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected bodies %v, got %v", expected, script.bodies)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	c, script, stop := newScriptedClient(http.StatusBadGateway)
+	defer stop()
+	c.Retries = 2
+	err := c.Put(context.Background(), "key", bytes.NewReader([]byte("data")), "text/plain")
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusBadGateway || e.Code != "bad_gateway" || e.Message != "proxy down" {
+		t.Errorf("expected bad gateway error, got %v", err)
+	}
+	if len(script.bodies) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(script.bodies))
+	}
+}
+
+func TestNoRetries(t *testing.T) {
+	c, script, stop := newScriptedClient(http.StatusInternalServerError, http.StatusCreated)
+	defer stop()
+	// Body which cannot be read again.
+	body := ioutil.NopCloser(strings.NewReader("data"))
+	err := c.Put(context.Background(), "key", body, "text/plain")
+	if e, ok := err.(*Error); !ok || e.Code != apierror.Internal {
+		t.Errorf("expected internal error, got %v", err)
+	}
+	if len(script.bodies) != 1 {
+		t.Errorf("expected 1 attempt, got %d", len(script.bodies))
+	}
+
+	c, script, stop = newScriptedClient(http.StatusInsufficientStorage, http.StatusCreated)
+	defer stop()
+	if err := c.Put(context.Background(), "key", strings.NewReader("data"), "text/plain"); err == nil {
+		t.Error("expected error")
+	}
+	if len(script.bodies) != 1 {
+		t.Errorf("expected 1 attempt, got %d", len(script.bodies))
+	}
+}
+
+func TestRetriesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "GWP_client_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "object")
+	if err := ioutil.WriteFile(fileName, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	c, script, stop := newScriptedClient(http.StatusServiceUnavailable, http.StatusCreated)
+	defer stop()
+	if err := c.Put(context.Background(), "key", file, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if len(script.bodies) != 2 || script.bodies[1] != "data" {
+		t.Errorf("expected the file sent twice, got %v", script.bodies)
+	}
+
+	// Pipes cannot be read again.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		w.Write([]byte("data"))
+		w.Close()
+	}()
+	c, script, stop = newScriptedClient(http.StatusServiceUnavailable, http.StatusCreated)
+	defer stop()
+	if err := c.Put(context.Background(), "key", r, "text/plain"); err != UnavailableError {
+		t.Errorf("expected %v, got %v", UnavailableError, err)
+	}
+	if len(script.bodies) != 1 {
+		t.Errorf("expected 1 attempt, got %d", len(script.bodies))
+	}
+}
+
+func TestRetriesCancelled(t *testing.T) {
+	c, _, stop := newScriptedClient(http.StatusServiceUnavailable)
+	defer stop()
+	c.initialBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Delete(ctx, "key"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	c, script, stop := newScriptedClient(http.StatusCreated)
+	defer stop()
+	c.Token = "secret"
+	if err := c.Put(context.Background(), "key", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if authorization := script.header.Get("Authorization"); authorization != "Bearer secret" {
+		t.Errorf("expected bearer token, got %q", authorization)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Status: 400, Code: apierror.InvalidKey, Message: "key must match", RequestId: "abc"}
+	if expected := "400 invalid_key: key must match (request abc)"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Object is an object read from the server.
+// Body has to be closed by the caller.
+type Object struct {
+	ContentType string
+	// Version is version of the key, the sequence number
+	// of its last mutation, or 0 if the server does not report it.
+	Version uint64
+	Body    io.ReadCloser
+}
+
+func (c *Client) objectUrl(key string) string {
+	return c.objectsUrl + "/" + url.PathEscape(key)
+}
+
+// Put stores object read from body under key, along with contentType.
+// Body is streamed to the server and not closed. Put is retried
+// only if body is an io.Seeker, e.g. *bytes.Reader or *os.File.
+func (c *Client) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	request, err := newRequest(ctx, http.MethodPut, c.objectUrl(key), body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	response, err := c.do(request, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// Get returns object under key, or KeyAbsentError.
+func (c *Client) Get(ctx context.Context, key string) (*Object, error) {
+	return c.get(ctx, c.objectUrl(key))
+}
+
+// GetIfNewer returns object under key if its version is greater
+// than version. Otherwise, waits up to wait for it to change, as long
+// as router.MaxWait at most, and returns NotModifiedError if it does
+// not. Servers not reporting versions never answer with NotModifiedError.
+func (c *Client) GetIfNewer(ctx context.Context, key string, version uint64, wait time.Duration) (*Object, error) {
+	objectUrl := c.objectUrl(key)
+	if wait > 0 {
+		query := url.Values{}
+		query.Set("wait", wait.String())
+		query.Set("after", strconv.FormatUint(version, 10))
+		objectUrl += "?" + query.Encode()
+	}
+	object, err := c.get(ctx, objectUrl)
+	if err != nil {
+		return nil, err
+	}
+	if object.Version != 0 && object.Version <= version {
+		object.Body.Close()
+		return nil, NotModifiedError
+	}
+	return object, nil
+}
+
+func (c *Client) get(ctx context.Context, objectUrl string) (*Object, error) {
+	request, err := newRequest(ctx, http.MethodGet, objectUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.do(request, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	object := &Object{ContentType: response.Header.Get("Content-Type"), Body: response.Body}
+	if version := response.Header.Get(router.VersionHeader); version != "" {
+		if object.Version, err = strconv.ParseUint(version, 10, 64); err != nil {
+			response.Body.Close()
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+// Delete deletes object under key, or returns KeyAbsentError.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	request, err := newRequest(ctx, http.MethodDelete, c.objectUrl(key), nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(request, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// List returns keys of all objects.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	request, err := newRequest(ctx, http.MethodGet, c.objectsUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.do(request, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var keys []string
+	if err := json.NewDecoder(response.Body).Decode(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
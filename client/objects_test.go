@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient() (*Client, *storage.ObservableStorage, func()) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	server := httptest.NewServer(router.NewRouter(dataStorage))
+	return New(server.URL), dataStorage, server.Close
+}
+
+func assertObjectEqual(t *testing.T, object *Object, data, contentType string, version uint64) {
+	defer object.Body.Close()
+	body, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != data || object.ContentType != contentType || object.Version != version {
+		t.Errorf("expected %q of type %q in version %d, got %q of type %q in version %d",
+			data, contentType, version, body, object.ContentType, object.Version)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	c, _, stop := newTestClient()
+	defer stop()
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "first", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, "second", bytes.NewReader([]byte{1, 2}), "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	object, err := c.Get(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertObjectEqual(t, object, "data", "text/plain", 1)
+
+	keys, err := c.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if expected := []string{"first", "second"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	if err := c.Delete(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "first"); err != KeyAbsentError {
+		t.Errorf("expected %v, got %v", KeyAbsentError, err)
+	}
+	if err := c.Delete(ctx, "first"); err != KeyAbsentError {
+		t.Errorf("expected %v, got %v", KeyAbsentError, err)
+	}
+}
+
+func TestObjectErrors(t *testing.T) {
+	c, _, stop := newTestClient()
+	defer stop()
+	ctx := context.Background()
+
+	err := c.Put(ctx, "invalid-key", strings.NewReader("data"), "text/plain")
+	if e, ok := err.(*Error); !ok || e.Status != 400 || e.Code != apierror.InvalidKey {
+		t.Errorf("expected invalid key error, got %v", err)
+	}
+	err = c.Put(ctx, "key", strings.NewReader("data"), "")
+	if e, ok := err.(*Error); !ok || e.Code != apierror.MissingContentType {
+		t.Errorf("expected missing content type error, got %v", err)
+	}
+	err = c.Put(ctx, "key", bytes.NewReader(make([]byte, router.MaxObjectSize+1)), "text/plain")
+	if e, ok := err.(*Error); !ok || e.Code != apierror.ObjectTooLarge {
+		t.Errorf("expected object too large error, got %v", err)
+	}
+}
+
+func TestGetIfNewer(t *testing.T) {
+	c, dataStorage, stop := newTestClient()
+	defer stop()
+	ctx := context.Background()
+	dataStorage.Put("key", []byte("first"), "text/plain")
+
+	if _, err := c.GetIfNewer(ctx, "key", 1, 0); err != NotModifiedError {
+		t.Errorf("expected %v, got %v", NotModifiedError, err)
+	}
+	if _, err := c.GetIfNewer(ctx, "key", 1, 20*time.Millisecond); err != NotModifiedError {
+		t.Errorf("expected %v, got %v", NotModifiedError, err)
+	}
+	object, err := c.GetIfNewer(ctx, "key", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertObjectEqual(t, object, "first", "text/plain", 1)
+
+	done := make(chan *Object)
+	go func() {
+		object, err := c.GetIfNewer(ctx, "key", 1, 10*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- object
+	}()
+	select {
+	case <-done:
+		t.Fatal("returned before change")
+	case <-time.After(50 * time.Millisecond):
+	}
+	dataStorage.Put("key", []byte("second"), "text/plain")
+	assertObjectEqual(t, <-done, "second", "text/plain", 2)
+}
+
+func TestNamespace(t *testing.T) {
+	c := New("http://127.0.0.1:8080").Namespace("team")
+	if url := c.objectUrl("key"); url != "http://127.0.0.1:8080/api/namespaces/team/objects/key" {
+		t.Errorf("wrong url: %v", url)
+	}
+}
@@ -0,0 +1,278 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/go-chi/chi"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Url               = "/api/events"
+	DefaultLogSize    = 1024
+	HeartbeatInterval = 15 * time.Second
+)
+
+const (
+	// Number of events queued for a client before it is disconnected
+	// as too slow. Client can then resume with Last-Event-ID.
+	clientBuffer = 256
+	// Number of mutations queued for the feed itself.
+	storageBuffer = 4096
+)
+
+// Event type sent when client cannot be given all mutations
+// after its Last-Event-ID, either because they are no longer
+// in the log or because the storage contents were replaced.
+// Client should read the storage again.
+const eventReset = "reset"
+
+// Event describes a single mutation, sent as data
+// of a Server-Sent Event. Version is the sequence number
+// of the mutation, also used as the event ID.
+type Event struct {
+	Key         string     `json:"key"`
+	Op          storage.Op `json:"op"`
+	ContentType string     `json:"contentType,omitempty"`
+	Version     uint64     `json:"version"`
+	Time        time.Time  `json:"time"`
+}
+
+// client is a single stream of events.
+// Once events channel is closed, reset tells if the client
+// has missed some events and resetSeq what it should resume from.
+type client struct {
+	prefix   string
+	events   chan Event
+	reset    bool
+	resetSeq uint64
+}
+
+// Feed keeps a bounded log of recent mutations of storage
+// and streams them to clients as Server-Sent Events.
+type Feed struct {
+	storage   *storage.ObservableStorage
+	size      int
+	heartbeat time.Duration
+	mut       sync.Mutex
+	log       []Event // oldest first
+	floor     uint64  // all mutations after floor are in log
+	clients   map[*client]struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFeed starts recording mutations of storage,
+// keeping up to size most recent ones.
+func NewFeed(dataStorage *storage.ObservableStorage, size int) *Feed {
+	feed := &Feed{
+		storage:   dataStorage,
+		size:      size,
+		heartbeat: HeartbeatInterval,
+		clients:   make(map[*client]struct{}),
+		closed:    make(chan struct{}),
+	}
+	seq, subscription := dataStorage.SubscribeWithSeq(storageBuffer)
+	feed.floor = seq
+	go feed.run(subscription)
+	return feed
+}
+
+// Handler returns handler serving the event stream,
+// to be mounted under Url.
+func (f *Feed) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/", f.serveEvents)
+	return router
+}
+
+// Close stops recording mutations and disconnects all clients.
+// Should be called when server shuts down, since streams
+// never finish on their own.
+func (f *Feed) Close() {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+	})
+}
+
+func (f *Feed) run(subscription *storage.Subscription) {
+	for {
+		select {
+		case event, ok := <-subscription.Events():
+			if ok {
+				f.append(Event{
+					Key:         event.Key,
+					Op:          event.Op,
+					ContentType: event.Data.ContentType,
+					Version:     event.Seq,
+					Time:        event.Time,
+				})
+			} else {
+				// Some mutations were not observed,
+				// log has to start over.
+				var seq uint64
+				seq, subscription = f.storage.SubscribeWithSeq(storageBuffer)
+				f.restart(seq)
+			}
+		case <-f.closed:
+			subscription.Close()
+			return
+		}
+	}
+}
+
+// append adds event to the log and sends it to interested clients.
+// Clients not keeping up are disconnected.
+func (f *Feed) append(event Event) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.log = append(f.log, event)
+	if len(f.log) > f.size {
+		f.floor = f.log[0].Version
+		f.log = f.log[1:]
+	}
+	for c := range f.clients {
+		if !strings.HasPrefix(event.Key, c.prefix) {
+			continue
+		}
+		select {
+		case c.events <- event:
+		default:
+			f.disconnect(c, false)
+		}
+	}
+}
+
+// restart empties the log, disconnecting all clients with a reset.
+func (f *Feed) restart(seq uint64) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.log = nil
+	f.floor = seq
+	for c := range f.clients {
+		f.disconnect(c, true)
+	}
+}
+
+// register adds a client interested in keys with given prefix.
+// If lastEventId is given, returns logged events after it.
+// If these events are not available, returns true instead,
+// along with the sequence number client starts from.
+func (f *Feed) register(prefix, lastEventId string) (*client, []Event, bool, uint64) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	c := &client{prefix: prefix, events: make(chan Event, clientBuffer)}
+	f.clients[c] = struct{}{}
+
+	seq := f.floor
+	if len(f.log) > 0 {
+		seq = f.log[len(f.log)-1].Version
+	}
+	if lastEventId == "" {
+		return c, nil, false, seq
+	}
+	last, err := strconv.ParseUint(lastEventId, 10, 64)
+	if err != nil || last < f.floor || last > seq {
+		return c, nil, true, seq
+	}
+	var replay []Event
+	for _, event := range f.log[last-f.floor:] {
+		if strings.HasPrefix(event.Key, prefix) {
+			replay = append(replay, event)
+		}
+	}
+	return c, replay, false, seq
+}
+
+func (f *Feed) unregister(c *client) {
+	f.mut.Lock()
+	f.disconnect(c, false)
+	f.mut.Unlock()
+}
+
+// disconnect must be called with mut held.
+func (f *Feed) disconnect(c *client, reset bool) {
+	if _, ok := f.clients[c]; ok {
+		delete(f.clients, c)
+		c.reset = reset
+		c.resetSeq = f.floor
+		close(c.events)
+	}
+}
+
+// serveEvents streams events of mutations of keys with prefix
+// given in query, starting after the one given in Last-Event-ID
+// header or from the current moment.
+func (f *Feed) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.Internal, "streaming not supported")
+		return
+	}
+
+	c, replay, reset, seq := f.register(r.URL.Query().Get("prefix"), r.Header.Get("Last-Event-ID"))
+	defer f.unregister(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if reset {
+		if err := writeReset(w, seq); err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(f.heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case event, ok := <-c.events:
+			if !ok {
+				if c.reset {
+					if writeReset(w, c.resetSeq) == nil {
+						flusher.Flush()
+					}
+				}
+				return
+			}
+			err = writeEvent(w, event)
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-f.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Version, event.Op, data)
+	return err
+}
+
+func writeReset(w http.ResponseWriter, seq uint64) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {\"version\":%d}\n\n", seq, eventReset, seq)
+	return err
+}
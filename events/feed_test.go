@@ -0,0 +1,224 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sse is a single Server-Sent Event read by a test client.
+type sse struct {
+	id    string
+	event string
+	data  string
+}
+
+type stream struct {
+	response *http.Response
+	reader   *bufio.Reader
+}
+
+func openStream(t *testing.T, url, lastEventId string) *stream {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response code: %v", response.StatusCode)
+	}
+	if ct := response.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("wrong content type: %v", ct)
+	}
+	return &stream{response: response, reader: bufio.NewReader(response.Body)}
+}
+
+// next reads the next event, skipping comments.
+func (s *stream) next(t *testing.T) sse {
+	var event sse
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event != (sse{}) {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (s *stream) nextEvent(t *testing.T) Event {
+	var event Event
+	if err := json.Unmarshal([]byte(s.next(t).data), &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func (s *stream) close() {
+	s.response.Body.Close()
+}
+
+func newServer(size int) (*storage.ObservableStorage, *Feed, *httptest.Server) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	feed := NewFeed(dataStorage, size)
+	return dataStorage, feed, httptest.NewServer(feed.Handler())
+}
+
+// waitForClients polls feed until it has given number of clients.
+func waitForClients(t *testing.T, feed *Feed, count int) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		feed.mut.Lock()
+		clients := len(feed.clients)
+		feed.mut.Unlock()
+		if clients == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("clients not connected in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFeed_Stream(t *testing.T) {
+	dataStorage, feed, server := newServer(DefaultLogSize)
+	defer server.Close()
+	defer feed.Close()
+
+	all := openStream(t, server.URL, "")
+	defer all.close()
+	filtered := openStream(t, server.URL+"?prefix=ab", "")
+	defer filtered.close()
+	waitForClients(t, feed, 2)
+
+	dataStorage.Put("abc", []byte{1}, "type")
+	dataStorage.Put("xyz", []byte{2}, "")
+	dataStorage.Delete("abc")
+
+	put := all.next(t)
+	if put.id != "1" || put.event != "put" {
+		t.Errorf("wrong event: %v", put)
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(put.data), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Key != "abc" || event.Op != storage.OpPut || event.ContentType != "type" || event.Version != 1 || event.Time.IsZero() {
+		t.Errorf("wrong event data: %v", event)
+	}
+	if event := all.nextEvent(t); event.Key != "xyz" || event.Version != 2 {
+		t.Errorf("wrong event: %v", event)
+	}
+	if event := all.nextEvent(t); event.Key != "abc" || event.Op != storage.OpDelete || event.Version != 3 {
+		t.Errorf("wrong event: %v", event)
+	}
+
+	if event := filtered.nextEvent(t); event.Version != 1 {
+		t.Errorf("wrong event: %v", event)
+	}
+	if event := filtered.nextEvent(t); event.Version != 3 {
+		t.Errorf("wrong event: %v", event)
+	}
+}
+
+func TestFeed_Resume(t *testing.T) {
+	dataStorage, feed, server := newServer(2)
+	defer server.Close()
+	defer feed.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		dataStorage.Put(key, []byte{}, "")
+	}
+	waitForEvents := func() {
+		deadline := time.Now().Add(time.Second)
+		for {
+			feed.mut.Lock()
+			done := len(feed.log) == 2 && feed.floor == 1
+			feed.mut.Unlock()
+			if done {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("events not logged in time")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitForEvents()
+
+	resumed := openStream(t, server.URL, "1")
+	if event := resumed.nextEvent(t); event.Key != "b" || event.Version != 2 {
+		t.Errorf("wrong event: %v", event)
+	}
+	if event := resumed.nextEvent(t); event.Key != "c" || event.Version != 3 {
+		t.Errorf("wrong event: %v", event)
+	}
+	resumed.close()
+
+	for _, lastEventId := range []string{"0", "4", "invalid"} {
+		stale := openStream(t, server.URL, lastEventId)
+		if reset := stale.next(t); reset.event != eventReset || reset.id != "3" {
+			t.Errorf("wrong event for %v: %v", lastEventId, reset)
+		}
+		stale.close()
+	}
+}
+
+func TestFeed_Restore(t *testing.T) {
+	dataStorage, feed, server := newServer(DefaultLogSize)
+	defer server.Close()
+	defer feed.Close()
+
+	dataStorage.Put("a", []byte{}, "")
+	client := openStream(t, server.URL, "")
+	defer client.close()
+	waitForClients(t, feed, 1)
+
+	dataStorage.Restore(map[string]storage.Data{})
+	if reset := client.next(t); reset.event != eventReset || reset.id != "2" {
+		t.Errorf("wrong event: %v", reset)
+	}
+
+	resumed := openStream(t, server.URL, "2")
+	defer resumed.close()
+	dataStorage.Put("b", []byte{}, "")
+	if event := resumed.nextEvent(t); event.Key != "b" || event.Version != 3 {
+		t.Errorf("wrong event: %v", event)
+	}
+}
+
+func TestFeed_Close(t *testing.T) {
+	_, feed, server := newServer(DefaultLogSize)
+	defer server.Close()
+
+	client := openStream(t, server.URL, "")
+	defer client.close()
+	waitForClients(t, feed, 1)
+	feed.Close()
+	if _, err := client.reader.ReadString('\n'); err == nil {
+		t.Error("stream not finished")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+	"os"
+)
+
+// exportData writes contents of a database or a running server
+// to an archive, as described by args.
+// Returns exit code: 0 on success, 1 on failure, 2 on usage errors.
+func exportData(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	db := flags.String("db", dbName, "database to export")
+	url := flags.String("url", "", "address of a running server to export instead of a database")
+	output := flags.String("o", "-", "archive file, - for standard output")
+	ns := flags.String("namespace", namespace.Default, "namespace to export")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [-db file | -url address] [-namespace name] [-o file]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var source storage.Storage
+	var remote *remoteStorage
+	if *url != "" {
+		remote = newRemoteStorage(*url, *ns)
+		source = remote
+	} else {
+		local := storage.NewStorage()
+		var err error
+		if *ns == namespace.Default {
+			err = persistence.ReadFromDb(local, *db)
+		} else {
+			err = persistence.ReadNamespaceFromDb(local, *db, *ns)
+		}
+		if err != nil && err != persistence.BucketAbsentError {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		source = local
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *output != "-" {
+		var err error
+		if file, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w = file
+	}
+
+	exported, err := archive.Export(source, w)
+	if err == nil && remote != nil {
+		err = remote.err
+	}
+	if file != nil {
+		// Write errors may be reported only on close.
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d objects\n", exported)
+	return 0
+}
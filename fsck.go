@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	"os"
+)
+
+// fsck verifies the database given in args, optionally repairing it.
+// Returns exit code: 0 if the database is consistent or was repaired,
+// 1 if corrupt records were found, 2 on usage or I/O errors.
+func fsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "quarantine corrupt records and migrate legacy ones")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fsck [-repair] [db]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	name := dbName
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+	}
+
+	var report persistence.Report
+	var err error
+	if *repair {
+		report, err = persistence.RepairDb(name)
+	} else {
+		report, err = persistence.CheckDb(name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	for _, corrupt := range report.Corrupt {
+		if *repair {
+			fmt.Printf("quarantined %v\n", corrupt)
+		} else {
+			fmt.Println(corrupt)
+		}
+	}
+	fmt.Printf("%d valid records (%d in legacy format), %d corrupt\n",
+		report.Loaded, report.Legacy, len(report.Corrupt))
+	if len(report.Corrupt) > 0 && !*repair {
+		return 1
+	}
+	return 0
+}
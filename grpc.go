@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/tls"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/grpcapi"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+)
+
+// startGrpc serves objects on addr in the background, with TLS
+// if tlsConfig is not nil and authenticating calls with authenticator
+// if it is not nil. The returned server has to be stopped.
+func startGrpc(objects *grpcapi.Server, addr string, tlsConfig *tls.Config, authenticator *auth.Authenticator) (*grpc.Server, error) {
+	options := grpcapi.Interceptors(logger, authenticator)
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig.Clone())))
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc.NewServer(options...)
+	grpcapi.RegisterObjectsServer(grpcServer, objects)
+	logger.Info("Serving gRPC", logging.Fields{"addr": listener.Addr().String(), "tls": tlsConfig != nil})
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Error("gRPC server failed", logging.Fields{"error": err})
+		}
+	}()
+	return grpcServer, nil
+}
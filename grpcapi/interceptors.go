@@ -0,0 +1,155 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/x509"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// requestIdMetadata carries ID of a call, like logging.RequestIdHeader.
+const requestIdMetadata = "x-request-id"
+
+// Interceptors returns server options logging each call with logger, like
+// logging.Logger.Middleware does, and, if authenticator is not nil,
+// authenticating calls with bearer tokens sent in "authorization" metadata
+// or verified client certificates. Authenticated calls are authorized
+// by the server, with identities carried by their contexts.
+func Interceptors(logger *logging.Logger, authenticator *auth.Authenticator) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{logUnary(logger)}
+	stream := []grpc.StreamServerInterceptor{logStream(logger)}
+	if authenticator != nil {
+		unary = append(unary, authUnary(authenticator))
+		stream = append(stream, authStream(authenticator))
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// contextStream replaces context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func firstMetadata(ctx context.Context, name string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func logUnary(logger *logging.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := logCall(ctx, logger, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+func logStream(logger *logging.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return logCall(ss.Context(), logger, info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// logCall logs call of method with its ID, code, latency and annotations.
+// Calls failing with codes.Internal or codes.Unknown are logged at Error level.
+func logCall(ctx context.Context, logger *logging.Logger, method string, call func(ctx context.Context) error) error {
+	start := time.Now()
+	ctx, annotations := logging.Track(ctx, firstMetadata(ctx, requestIdMetadata))
+	id := logging.RequestId(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIdMetadata, id))
+	err := call(ctx)
+
+	code := status.Code(err)
+	fields := logging.Fields{
+		"request_id": id,
+		"method":     method,
+		"code":       code.String(),
+		"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["remote"] = p.Addr.String()
+	}
+	for name, value := range annotations() {
+		fields[name] = value
+	}
+	level := logging.Info
+	if code == codes.Internal || code == codes.Unknown {
+		level = logging.Error
+	}
+	logger.Log(level, "call", fields)
+	return err
+}
+
+func authUnary(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authStream(authenticator *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate returns ctx carrying identity of the caller,
+// or error with codes.Unauthenticated.
+func authenticate(ctx context.Context, authenticator *auth.Authenticator) (context.Context, error) {
+	var token string
+	if authorization := firstMetadata(ctx, "authorization"); authorization != "" {
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return nil, status.Error(codes.Unauthenticated, "bearer token expected")
+		}
+		token = strings.TrimPrefix(authorization, "Bearer ")
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+	}
+	var verifiedChains [][]*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			verifiedChains = info.State.VerifiedChains
+		}
+	}
+	identity, ok := authenticator.Identify(token, verifiedChains)
+	if !ok {
+		if token != "" {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Unauthenticated, "credentials required")
+	}
+	logging.Annotate(ctx, logging.Fields{"identity": identity.Name})
+	return auth.WithIdentity(ctx, identity), nil
+}
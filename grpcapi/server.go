@@ -0,0 +1,217 @@
+// Package grpcapi serves objects over gRPC, as described in gwp.proto.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gwp.proto
+
+import (
+	"context"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const watchBuffer = 256 // events queued for a slow watcher
+
+// Server implements ObjectsServer over storage. Requests are
+// authorized with identity carried by their contexts, if any.
+type Server struct {
+	UnimplementedObjectsServer
+	storage   storage.Storage
+	readOnly  bool
+	keyRegex  *regexp.Regexp
+	buffer    int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServer creates a server for storage. If readOnly, Put and Delete
+// fail with codes.FailedPrecondition, as storage must not be modified
+// directly, e.g. on a follower. Watch is available if storage
+// is a *storage.ObservableStorage.
+func NewServer(dataStorage storage.Storage, readOnly bool) *Server {
+	return &Server{
+		storage:  dataStorage,
+		readOnly: readOnly,
+		keyRegex: regexp.MustCompile(router.KeyPattern),
+		buffer:   watchBuffer,
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close ends all watches with codes.Unavailable.
+// Should be called before grpc.Server.GracefulStop,
+// which waits for them otherwise.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// checkKey returns error with codes.InvalidArgument if key is not valid,
+// or codes.PermissionDenied if it is not allowed permission to key.
+func (s *Server) checkKey(ctx context.Context, permission auth.Permission, key string) error {
+	if !s.keyRegex.MatchString(key) {
+		return status.Error(codes.InvalidArgument, "key must match "+router.KeyPattern)
+	}
+	return checkAllowed(ctx, permission, key)
+}
+
+func checkAllowed(ctx context.Context, permission auth.Permission, prefix string) error {
+	if !auth.Allowed(ctx, permission, prefix) {
+		return status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+	return nil
+}
+
+// storageError returns error with code describing err returned by storage,
+// like the HTTP API does. Unexpected errors are logged.
+func storageError(ctx context.Context, err error) error {
+	switch err {
+	case nil:
+		return nil
+	case storage.KeyAbsentError:
+		return status.Error(codes.NotFound, err.Error())
+	case storage.UnavailableError:
+		return status.Error(codes.Unavailable, err.Error())
+	case storage.QuotaExceededError:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		logging.Annotate(ctx, logging.Fields{"error": err})
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+func (s *Server) Put(ctx context.Context, request *PutRequest) (*PutResponse, error) {
+	if err := s.checkKey(ctx, auth.Write, request.Key); err != nil {
+		return nil, err
+	}
+	if s.readOnly {
+		return nil, status.Error(codes.FailedPrecondition, "writes are not accepted by this server")
+	}
+	if request.ContentType == "" {
+		return nil, status.Error(codes.InvalidArgument, "content type is required")
+	}
+	if len(request.Object) > router.MaxObjectSize {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("object must not exceed %d bytes", router.MaxObjectSize))
+	}
+	err := s.storage.Put(request.Key, request.Object, request.ContentType)
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+	return &PutResponse{}, nil
+}
+
+// Get returns object with its version if storage is a storage.Watcher.
+func (s *Server) Get(ctx context.Context, request *GetRequest) (*Object, error) {
+	if err := s.checkKey(ctx, auth.Read, request.Key); err != nil {
+		return nil, err
+	}
+	var data storage.Data
+	var version uint64
+	var err error
+	if watcher, ok := s.storage.(storage.Watcher); ok {
+		data, version, err = watcher.GetWithVersion(request.Key)
+	} else {
+		data, err = s.storage.Get(request.Key)
+	}
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+	return &Object{Key: request.Key, Object: data.Object, ContentType: data.ContentType, Version: version}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, request *DeleteRequest) (*DeleteResponse, error) {
+	if err := s.checkKey(ctx, auth.Delete, request.Key); err != nil {
+		return nil, err
+	}
+	if s.readOnly {
+		return nil, status.Error(codes.FailedPrecondition, "writes are not accepted by this server")
+	}
+	if err := s.storage.Delete(request.Key); err != nil {
+		return nil, storageError(ctx, err)
+	}
+	return &DeleteResponse{}, nil
+}
+
+// List requires read permission to keys with the requested prefix.
+func (s *Server) List(request *ListRequest, stream Objects_ListServer) error {
+	if err := checkAllowed(stream.Context(), auth.Read, request.Prefix); err != nil {
+		return err
+	}
+	keys := s.storage.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, request.Prefix) {
+			continue
+		}
+		if err := stream.Send(&ListResponse{Key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch requires read permission to keys with the requested prefix.
+// After storage contents are replaced with a restore, sends an event
+// with Event_OP_RESET and continues.
+func (s *Server) Watch(request *WatchRequest, stream Objects_WatchServer) error {
+	if err := checkAllowed(stream.Context(), auth.Read, request.Prefix); err != nil {
+		return err
+	}
+	observable, ok := s.storage.(*storage.ObservableStorage)
+	if !ok {
+		return status.Error(codes.Unimplemented, "watching is not available on this server")
+	}
+	subscription := observable.Subscribe(s.buffer)
+	defer func() {
+		subscription.Close()
+	}()
+	// Headers are sent, so that clients know the watch has started.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		var event *Event
+		select {
+		case mutation, ok := <-subscription.Events():
+			if ok && !strings.HasPrefix(mutation.Key, request.Prefix) {
+				continue
+			}
+			if ok {
+				event = &Event{
+					Op:          Event_OP_PUT,
+					Key:         mutation.Key,
+					Object:      mutation.Data.Object,
+					ContentType: mutation.Data.ContentType,
+					Version:     mutation.Seq,
+					Time:        timestamppb.New(mutation.Time),
+				}
+				if mutation.Op == storage.OpDelete {
+					event.Op = Event_OP_DELETE
+				}
+			} else if subscription.Err() == storage.RestoredError {
+				subscription = observable.Subscribe(s.buffer)
+				event = &Event{Op: Event_OP_RESET}
+			} else {
+				return status.Error(codes.ResourceExhausted, subscription.Err().Error())
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.closed:
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	t      *testing.T
+	server *Server
+	client ObjectsClient
+	logs   *bytes.Buffer
+}
+
+// newTestServer serves dataStorage on an in-process listener.
+func newTestServer(t *testing.T, dataStorage storage.Storage, readOnly bool, authenticator *auth.Authenticator) (*testServer, func()) {
+	logs := &bytes.Buffer{}
+	service := NewServer(dataStorage, readOnly)
+	grpcServer := grpc.NewServer(Interceptors(logging.New(logs, logging.Info), authenticator)...)
+	RegisterObjectsServer(grpcServer, service)
+	listener := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{t: t, server: service, client: NewObjectsClient(conn), logs: logs}
+	return s, func() {
+		conn.Close()
+		service.Close()
+		grpcServer.GracefulStop()
+	}
+}
+
+func (s *testServer) assertCode(err error, code codes.Code) {
+	s.t.Helper()
+	if actual := status.Code(err); actual != code {
+		s.t.Errorf("expected code %v, got %v", code, err)
+	}
+}
+
+func (s *testServer) list(ctx context.Context, prefix string) ([]string, error) {
+	stream, err := s.client.List(ctx, &ListRequest{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return keys, nil
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, response.Key)
+	}
+}
+
+// failingStorage fails all writes with an unexpected error.
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) Put(string, []byte, string) error {
+	return errors.New("disk failure")
+}
+
+func TestObjects(t *testing.T) {
+	s, stop := newTestServer(t, storage.NewObservableStorage(storage.NewStorage()), false, nil)
+	defer stop()
+	ctx := context.Background()
+
+	for _, key := range []string{"user2", "user1", "admin"} {
+		_, err := s.client.Put(ctx, &PutRequest{Key: key, Object: []byte(key), ContentType: "text/plain"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	object, err := s.client.Get(ctx, &GetRequest{Key: "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Key != "user1" || string(object.Object) != "user1" || object.ContentType != "text/plain" || object.Version != 2 {
+		t.Errorf("wrong object: %v", object)
+	}
+
+	keys, err := s.list(ctx, "")
+	if err != nil || !reflect.DeepEqual(keys, []string{"admin", "user1", "user2"}) {
+		t.Errorf("wrong keys: %v, %v", keys, err)
+	}
+	keys, err = s.list(ctx, "user")
+	if err != nil || !reflect.DeepEqual(keys, []string{"user1", "user2"}) {
+		t.Errorf("wrong keys: %v, %v", keys, err)
+	}
+
+	if _, err := s.client.Delete(ctx, &DeleteRequest{Key: "user1"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.client.Get(ctx, &GetRequest{Key: "user1"})
+	s.assertCode(err, codes.NotFound)
+	_, err = s.client.Delete(ctx, &DeleteRequest{Key: "user1"})
+	s.assertCode(err, codes.NotFound)
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	s, stop := newTestServer(t, storage.NewStorage(), false, nil)
+	defer stop()
+
+	_, err := s.client.Put(ctx, &PutRequest{Key: "in-valid", ContentType: "text/plain"})
+	s.assertCode(err, codes.InvalidArgument)
+	_, err = s.client.Get(ctx, &GetRequest{Key: ""})
+	s.assertCode(err, codes.InvalidArgument)
+	_, err = s.client.Put(ctx, &PutRequest{Key: "abc"})
+	s.assertCode(err, codes.InvalidArgument)
+	_, err = s.client.Put(ctx, &PutRequest{Key: "abc", Object: make([]byte, router.MaxObjectSize+1), ContentType: "text/plain"})
+	s.assertCode(err, codes.InvalidArgument)
+	stream, err := s.client.Watch(ctx, &WatchRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	s.assertCode(err, codes.Unimplemented)
+
+	readOnly, stop := newTestServer(t, storage.NewStorage(), true, nil)
+	defer stop()
+	_, err = readOnly.client.Put(ctx, &PutRequest{Key: "abc", ContentType: "text/plain"})
+	readOnly.assertCode(err, codes.FailedPrecondition)
+	_, err = readOnly.client.Delete(ctx, &DeleteRequest{Key: "abc"})
+	readOnly.assertCode(err, codes.FailedPrecondition)
+
+	failing, stop := newTestServer(t, failingStorage{storage.NewStorage()}, false, nil)
+	defer stop()
+	_, err = failing.client.Put(ctx, &PutRequest{Key: "abc", ContentType: "text/plain"})
+	failing.assertCode(err, codes.Internal)
+	if strings.Contains(err.Error(), "disk failure") {
+		t.Errorf("internal error exposed: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	s, stop := newTestServer(t, dataStorage, false, nil)
+	defer stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := s.client.Watch(ctx, &WatchRequest{Prefix: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Waits until the watch is started.
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	dataStorage.Put("admin", []byte("skipped"), "text/plain")
+	dataStorage.Put("user1", []byte("data"), "text/plain")
+	dataStorage.Delete("user1")
+	dataStorage.Restore(map[string]storage.Data{})
+
+	expected := []*Event{
+		{Op: Event_OP_PUT, Key: "user1", Object: []byte("data"), ContentType: "text/plain", Version: 2},
+		{Op: Event_OP_DELETE, Key: "user1", Version: 3},
+		{Op: Event_OP_RESET},
+	}
+	for _, expectedEvent := range expected {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expectedEvent.Op != Event_OP_RESET && event.Time.AsTime().IsZero() {
+			t.Errorf("time not set: %v", event)
+		}
+		event.Time = nil
+		if event.String() != expectedEvent.String() {
+			t.Errorf("expected %v, got %v", expectedEvent, event)
+		}
+	}
+
+	dataStorage.Put("user2", []byte("data"), "text/plain")
+	if event, err := stream.Recv(); err != nil || event.Key != "user2" {
+		t.Errorf("wrong event after reset: %v, %v", event, err)
+	}
+	s.server.Close()
+	_, err = stream.Recv()
+	s.assertCode(err, codes.Unavailable)
+}
+
+func TestWatchOverflow(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	s, stop := newTestServer(t, dataStorage, false, nil)
+	defer stop()
+	s.server.buffer = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := s.client.Watch(ctx, &WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		dataStorage.Put("abc", make([]byte, 1000), "text/plain")
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	s.assertCode(err, codes.ResourceExhausted)
+}
+
+// verifier accepts tokens found in it.
+type verifier map[string]*auth.Identity
+
+func (v verifier) Verify(token string) (*auth.Identity, error) {
+	if identity, ok := v[token]; ok {
+		return identity, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestAuth(t *testing.T) {
+	reader := &auth.Identity{Name: "reader", Grants: []auth.Grant{{Prefix: "public", Permissions: []auth.Permission{auth.Read}}}}
+	authenticator := auth.NewAuthenticator(verifier{"admin": {Name: "admin", Admin: true}, "reader": reader})
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	dataStorage.Put("public1", []byte("data"), "text/plain")
+	s, stop := newTestServer(t, dataStorage, false, authenticator)
+	defer stop()
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err := s.client.Get(context.Background(), &GetRequest{Key: "public1"})
+	s.assertCode(err, codes.Unauthenticated)
+	_, err = s.client.Get(withToken("invalid"), &GetRequest{Key: "public1"})
+	s.assertCode(err, codes.Unauthenticated)
+	_, err = s.list(context.Background(), "")
+	s.assertCode(err, codes.Unauthenticated)
+
+	_, err = s.client.Get(withToken("reader"), &GetRequest{Key: "public1"})
+	s.assertCode(err, codes.OK)
+	_, err = s.client.Put(withToken("reader"), &PutRequest{Key: "public1", ContentType: "text/plain"})
+	s.assertCode(err, codes.PermissionDenied)
+	_, err = s.client.Get(withToken("reader"), &GetRequest{Key: "private"})
+	s.assertCode(err, codes.PermissionDenied)
+	keys, err := s.list(withToken("reader"), "public")
+	if err != nil || !reflect.DeepEqual(keys, []string{"public1"}) {
+		t.Errorf("wrong keys: %v, %v", keys, err)
+	}
+	_, err = s.list(withToken("reader"), "")
+	s.assertCode(err, codes.PermissionDenied)
+
+	_, err = s.client.Put(withToken("admin"), &PutRequest{Key: "private", ContentType: "text/plain"})
+	s.assertCode(err, codes.OK)
+}
+
+func TestLogging(t *testing.T) {
+	s, stop := newTestServer(t, failingStorage{storage.NewStorage()}, false, nil)
+	defer stop()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIdMetadata, "client-id")
+
+	dataSets := []struct {
+		call     func() error
+		expected map[string]interface{}
+	}{
+		{func() error {
+			var header metadata.MD
+			_, err := s.client.Get(ctx, &GetRequest{Key: "abc"}, grpc.Header(&header))
+			if id := header.Get(requestIdMetadata); len(id) != 1 || id[0] != "client-id" {
+				t.Errorf("wrong request ID returned: %v", id)
+			}
+			return err
+		}, map[string]interface{}{
+			"level": "info", "msg": "call", "request_id": "client-id",
+			"method": "/gwp.v1.Objects/Get", "code": "NotFound",
+		}},
+		{func() error {
+			_, err := s.client.Put(context.Background(), &PutRequest{Key: "abc", ContentType: "text/plain"})
+			return err
+		}, map[string]interface{}{
+			"level": "error", "method": "/gwp.v1.Objects/Put", "code": "Internal", "error": "disk failure",
+		}},
+		{func() error {
+			_, err := s.list(context.Background(), "")
+			return err
+		}, map[string]interface{}{
+			"level": "info", "method": "/gwp.v1.Objects/List", "code": "OK",
+		}},
+	}
+	for _, dataSet := range dataSets {
+		s.logs.Reset()
+		dataSet.call()
+		var entry map[string]interface{}
+		if err := json.Unmarshal(s.logs.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid entry %s: %v", s.logs.String(), err)
+		}
+		for name, value := range dataSet.expected {
+			if entry[name] != value {
+				t.Errorf("expected %v=%v, got %v", name, value, entry[name])
+			}
+		}
+		for _, name := range []string{"request_id", "latency_ms", "remote"} {
+			if _, ok := entry[name]; !ok {
+				t.Errorf("%v not logged: %v", name, entry)
+			}
+		}
+	}
+}
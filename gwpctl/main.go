@@ -0,0 +1,172 @@
+// Command gwpctl manages objects of a running server over its HTTP API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/client"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Exit codes.
+const (
+	exitOk       = 0
+	exitFailure  = 1 // server, network and local I/O errors
+	exitUsage    = 2
+	exitNotFound = 3
+	exitRejected = 4 // requests rejected by the server, e.g. with invalid keys
+)
+
+const defaultUrl = "http://127.0.0.1:8080"
+
+// ctl runs commands with client, writing results
+// to stdout in JSON format if json is set.
+type ctl struct {
+	client  *client.Client
+	json    bool
+	timeout time.Duration
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+type command struct {
+	usage string
+	// run parses args with flags, printing usage of the command.
+	run func(c *ctl, flags *flag.FlagSet, args []string) int
+}
+
+var commands = map[string]command{
+	"get":    {"get [-o file] key", get},
+	"put":    {"put [-type content-type] key [file]", put},
+	"delete": {"delete key...", remove},
+	"list":   {"list [-prefix prefix] [-match pattern] [-l]", list},
+	"copy":   {"copy source destination", copyObject},
+	"sync":   {"sync [-prefix prefix] [-delete] [-n] directory", sync},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs command given in args and returns its exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gwpctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	url := flags.String("url", env("GWP_URL", defaultUrl), "address of the server, defaults to $GWP_URL")
+	token := flags.String("token", os.Getenv("GWP_TOKEN"), "API key or JWT, defaults to $GWP_TOKEN")
+	namespace := flags.String("namespace", "", "namespace of objects instead of the default one")
+	jsonOutput := flags.Bool("json", false, "write results and errors in JSON format")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each request")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gwpctl [-url address] [-token token] [-namespace name] [-json] command [arguments]")
+		fmt.Fprintln(stderr, "Commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(stderr, "  "+commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "Exit codes: 0 on success, 1 on server or network errors, 2 on usage errors,")
+		fmt.Fprintln(stderr, "3 if an object is not found, 4 if the server rejects the request.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		return exitUsage
+	}
+
+	c := &ctl{
+		client:  client.New(*url),
+		json:    *jsonOutput,
+		timeout: *timeout,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+	c.client.Token = *token
+	if *namespace != "" {
+		c.client = c.client.Namespace(*namespace)
+	}
+	return cmd.run(c, c.flags(flags.Arg(0), cmd.usage), flags.Args()[1:])
+}
+
+func env(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// flags returns flag set of command called name,
+// printing usage on errors.
+func (c *ctl) flags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: gwpctl "+usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// context returns context of a request, bounded by the timeout.
+func (c *ctl) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// print writes value in JSON format if it is set,
+// or human-readable text otherwise.
+func (c *ctl) print(value interface{}, text string) {
+	if c.json {
+		if err := json.NewEncoder(c.stdout).Encode(value); err != nil {
+			panic(err)
+		}
+	} else if text != "" {
+		fmt.Fprintln(c.stdout, text)
+	}
+}
+
+// fail writes err to stderr, as the server does in JSON format,
+// and returns exit code describing it.
+func (c *ctl) fail(err error) int {
+	code := exitFailure
+	e, ok := err.(*client.Error)
+	if err == client.KeyAbsentError {
+		code = exitNotFound
+	} else if ok && e.Status < 500 {
+		code = exitRejected
+	}
+
+	if !c.json {
+		fmt.Fprintln(c.stderr, "gwpctl:", err)
+		return code
+	}
+	var envelope apierror.Envelope
+	if ok {
+		envelope.Error = apierror.Error(*e)
+	} else {
+		envelope.Error.Message = err.Error()
+		if code == exitNotFound {
+			envelope.Error.Status = http.StatusNotFound
+			envelope.Error.Code = apierror.KeyNotFound
+		}
+	}
+	if err := json.NewEncoder(c.stderr).Encode(envelope); err != nil {
+		panic(err)
+	}
+	return code
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testCtl struct {
+	t           *testing.T
+	url         string
+	dataStorage storage.Storage
+}
+
+func newTestCtl(t *testing.T) (*testCtl, func()) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	server := httptest.NewServer(router.NewRouter(dataStorage))
+	return &testCtl{t: t, url: server.URL, dataStorage: dataStorage}, server.Close
+}
+
+// run runs gwpctl with args and stdin, checking its exit code
+// and returning its output.
+func (c *testCtl) run(code int, stdin string, args ...string) (string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-url", c.url, "-token", ""}, args...)
+	if actual := run(args, strings.NewReader(stdin), &stdout, &stderr); actual != code {
+		c.t.Errorf("%v: expected exit code %d, got %d: %s", args, code, actual, stderr.String())
+	}
+	return stdout.String(), stderr.String()
+}
+
+func (c *testCtl) assertStored(key, object, contentType string) {
+	data, err := c.dataStorage.Get(key)
+	if err != nil {
+		c.t.Fatalf("%s: %v", key, err)
+	}
+	if string(data.Object) != object || data.ContentType != contentType {
+		c.t.Errorf("%s: expected %q of type %q, got %q of type %q", key, object, contentType, data.Object, data.ContentType)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "GWP_gwpctl_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPutGet(t *testing.T) {
+	c, stop := newTestCtl(t)
+	defer stop()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(file, []byte("<p>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout, _ := c.run(exitOk, "data", "put", "first"); stdout != "put first\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	c.assertStored("first", "data", defaultContentType)
+	c.run(exitOk, "", "put", "-type", "text/plain", "second", "-")
+	c.assertStored("second", "", "text/plain")
+	c.run(exitOk, "", "put", "third", file)
+	c.assertStored("third", "<p>", "text/html; charset=utf-8")
+
+	if stdout, _ := c.run(exitOk, "", "get", "first"); stdout != "data" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	output := filepath.Join(dir, "output")
+	c.run(exitOk, "", "get", "-o", output, "third")
+	if data, err := ioutil.ReadFile(output); err != nil || string(data) != "<p>" {
+		t.Errorf("wrong file contents: %q, %v", data, err)
+	}
+
+	stdout, _ := c.run(exitOk, "", "-json", "get", "first")
+	var info objectInfo
+	if err := json.Unmarshal([]byte(stdout), &info); err != nil {
+		t.Fatal(err)
+	}
+	expected := objectInfo{Key: "first", ContentType: defaultContentType, Version: 1, Size: 4, Object: []byte("data")}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	c, stop := newTestCtl(t)
+	defer stop()
+
+	c.run(exitUsage, "", "unknown")
+	c.run(exitUsage, "", "get")
+	c.run(exitUsage, "", "list", "-match", "[")
+	if _, stderr := c.run(exitNotFound, "", "get", "absent"); stderr != "gwpctl: key not in storage\n" {
+		t.Errorf("wrong error: %q", stderr)
+	}
+	c.run(exitNotFound, "", "delete", "absent")
+	_, stderr := c.run(exitRejected, "", "-json", "put", "invalid-key")
+	if !strings.Contains(stderr, `"code":"invalid_key"`) {
+		t.Errorf("wrong error: %q", stderr)
+	}
+	_, stderr = c.run(exitNotFound, "", "-json", "get", "absent")
+	if !strings.Contains(stderr, `"code":"key_not_found"`) {
+		t.Errorf("wrong error: %q", stderr)
+	}
+
+	stop()
+	c.run(exitFailure, "", "list")
+}
+
+func TestList(t *testing.T) {
+	c, stop := newTestCtl(t)
+	defer stop()
+	for _, key := range []string{"user2", "user1", "admin", "users"} {
+		c.dataStorage.Put(key, []byte(key), "text/plain")
+	}
+
+	if stdout, _ := c.run(exitOk, "", "list"); stdout != "admin\nuser1\nuser2\nusers\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	if stdout, _ := c.run(exitOk, "", "list", "-prefix", "user", "-match", "*[0-9]"); stdout != "user1\nuser2\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	if stdout, _ := c.run(exitOk, "", "-json", "list", "-prefix", "none"); stdout != "[]\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	stdout, _ := c.run(exitOk, "", "list", "-l", "-prefix", "admin")
+	if expected := "KEY    CONTENT TYPE  SIZE  VERSION\nadmin  text/plain    5     3\n"; stdout != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout)
+	}
+}
+
+func TestCopyDelete(t *testing.T) {
+	c, stop := newTestCtl(t)
+	defer stop()
+	c.dataStorage.Put("source", []byte("data"), "text/plain")
+
+	stdout, _ := c.run(exitOk, "", "-json", "copy", "source", "destination")
+	if stdout != `{"op":"copy","key":"destination","source":"source"}`+"\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	c.assertStored("destination", "data", "text/plain")
+	c.run(exitNotFound, "", "copy", "absent", "destination")
+
+	if stdout, _ := c.run(exitOk, "", "delete", "source", "destination"); stdout != "deleted source\ndeleted destination\n" {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	if keys := c.dataStorage.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+func TestSync(t *testing.T) {
+	c, stop := newTestCtl(t)
+	defer stop()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	files := map[string]string{"new": "new", "same": "same", "changed": "changed", "in-valid": "skipped"}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	c.dataStorage.Put("dirsame", []byte("same"), defaultContentType)
+	c.dataStorage.Put("dirchanged", []byte("old"), defaultContentType)
+	c.dataStorage.Put("dirremoved", []byte("removed"), defaultContentType)
+	c.dataStorage.Put("other", []byte("other"), defaultContentType)
+	// Objects of skipped files are not deleted.
+	c.dataStorage.Put("dirsub", []byte("sub"), defaultContentType)
+
+	stdout, _ := c.run(exitOk, "", "-json", "sync", "-prefix", "dir", "-delete", "-n", dir)
+	var report syncReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatal(err)
+	}
+	expected := syncReport{
+		Uploaded:  []string{"dirchanged", "dirnew"},
+		Unchanged: []string{"dirsame"},
+		Deleted:   []string{"dirremoved"},
+		Skipped:   []string{"in-valid", "sub"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+	c.assertStored("dirchanged", "old", defaultContentType)
+
+	stdout, _ = c.run(exitOk, "", "sync", "-prefix", "dir", "-delete", dir)
+	if !strings.HasSuffix(stdout, "uploaded 2, unchanged 1, deleted 1, skipped 2\n") {
+		t.Errorf("wrong output: %q", stdout)
+	}
+	c.assertStored("dirchanged", "changed", defaultContentType)
+	c.assertStored("dirnew", "new", defaultContentType)
+	c.assertStored("other", "other", defaultContentType)
+	c.assertStored("dirsub", "sub", defaultContentType)
+	if _, err := c.dataStorage.Get("dirremoved"); err != storage.KeyAbsentError {
+		t.Errorf("expected %v, got %v", storage.KeyAbsentError, err)
+	}
+}
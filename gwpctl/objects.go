@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/client"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultContentType = "application/octet-stream"
+
+// objectInfo describes an object in JSON output.
+type objectInfo struct {
+	Key         string `json:"key"`
+	ContentType string `json:"contentType"`
+	Version     uint64 `json:"version,omitempty"`
+	Size        int64  `json:"size"`
+	Object      []byte `json:"object,omitempty"`
+}
+
+// mutation describes a change made by a command in JSON output.
+type mutation struct {
+	Op     string `json:"op"`
+	Key    string `json:"key"`
+	Source string `json:"source,omitempty"`
+}
+
+// get writes object under key to standard output or a file.
+// In JSON format, writes it along with its metadata, base64 encoded,
+// or only the metadata if it is written to a file.
+func get(c *ctl, flags *flag.FlagSet, args []string) int {
+	output := flags.String("o", "-", "file to write the object to, - for standard output")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	key := flags.Arg(0)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	object, err := c.client.Get(ctx, key)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer object.Body.Close()
+	info := objectInfo{Key: key, ContentType: object.ContentType, Version: object.Version}
+
+	if *output == "-" && c.json {
+		if info.Object, err = ioutil.ReadAll(object.Body); err != nil {
+			return c.fail(err)
+		}
+		info.Size = int64(len(info.Object))
+		c.print(info, "")
+		return exitOk
+	}
+	w := c.stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if info.Size, err = io.Copy(w, object.Body); err != nil {
+		return c.fail(err)
+	}
+	if *output != "-" {
+		c.print(info, "")
+	}
+	return exitOk
+}
+
+// put stores contents of a file or standard input under key. Content
+// type defaults to the one registered for extension of the file.
+func put(c *ctl, flags *flag.FlagSet, args []string) int {
+	contentType := flags.String("type", "", "content type of the object, guessed from file extension by default")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	key, input := flags.Arg(0), flags.Arg(1)
+
+	r := c.stdin
+	if input != "" && input != "-" {
+		// Files are read again if the request is retried.
+		file, err := os.Open(input)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer file.Close()
+		r = file
+		if *contentType == "" {
+			*contentType = contentTypeOf(input)
+		}
+	}
+	if *contentType == "" {
+		*contentType = defaultContentType
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	if err := c.client.Put(ctx, key, r, *contentType); err != nil {
+		return c.fail(err)
+	}
+	c.print(mutation{Op: "put", Key: key}, "put "+key)
+	return exitOk
+}
+
+func contentTypeOf(fileName string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+	return defaultContentType
+}
+
+// remove deletes objects under keys, stopping at the first failure.
+func remove(c *ctl, flags *flag.FlagSet, args []string) int {
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	for _, key := range flags.Args() {
+		ctx, cancel := c.context()
+		err := c.client.Delete(ctx, key)
+		cancel()
+		if err != nil {
+			return c.fail(err)
+		}
+		c.print(mutation{Op: "delete", Key: key}, "deleted "+key)
+	}
+	return exitOk
+}
+
+// keys returns sorted keys starting with prefix
+// and matching pattern, if it is not empty.
+func (c *ctl) keys(prefix, pattern string) ([]string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	all, err := c.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if matched, _ := path.Match(pattern, key); pattern != "" && !matched {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// list writes sorted keys, with content types, sizes and versions
+// of their objects in the long format.
+func list(c *ctl, flags *flag.FlagSet, args []string) int {
+	prefix := flags.String("prefix", "", "list only keys starting with prefix")
+	pattern := flags.String("match", "", "list only keys matching shell pattern, e.g. 'user*'")
+	long := flags.Bool("l", false, "describe objects, reading each of them")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if _, err := path.Match(*pattern, ""); err != nil || flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	keys, err := c.keys(*prefix, *pattern)
+	if err != nil {
+		return c.fail(err)
+	}
+	if !*long {
+		c.print(keys, strings.Join(keys, "\n"))
+		return exitOk
+	}
+
+	infos := make([]objectInfo, 0, len(keys))
+	for _, key := range keys {
+		info, err := c.describe(key)
+		if err == client.KeyAbsentError {
+			// Deleted since listed.
+			continue
+		} else if err != nil {
+			return c.fail(err)
+		}
+		infos = append(infos, info)
+	}
+	if c.json {
+		c.print(infos, "")
+		return exitOk
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tCONTENT TYPE\tSIZE\tVERSION")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", info.Key, info.ContentType, info.Size, info.Version)
+	}
+	if err := w.Flush(); err != nil {
+		panic(err)
+	}
+	return exitOk
+}
+
+// describe reads object under key, returning its metadata.
+func (c *ctl) describe(key string) (objectInfo, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	object, err := c.client.Get(ctx, key)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	defer object.Body.Close()
+	size, err := io.Copy(ioutil.Discard, object.Body)
+	return objectInfo{Key: key, ContentType: object.ContentType, Version: object.Version, Size: size}, err
+}
+
+// copyObject stores object under source key under destination key.
+func copyObject(c *ctl, flags *flag.FlagSet, args []string) int {
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	source, destination := flags.Arg(0), flags.Arg(1)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	object, err := c.client.Get(ctx, source)
+	if err != nil {
+		return c.fail(err)
+	}
+	// Objects are small, read whole so that put can be retried.
+	data, err := ioutil.ReadAll(object.Body)
+	object.Body.Close()
+	if err != nil {
+		return c.fail(err)
+	}
+	if err := c.client.Put(ctx, destination, bytes.NewReader(data), object.ContentType); err != nil {
+		return c.fail(err)
+	}
+	c.print(mutation{Op: "copy", Key: destination, Source: source}, "copied "+source+" to "+destination)
+	return exitOk
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/client"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+)
+
+// syncReport describes changes made by sync, with keys
+// of objects and names of skipped files.
+type syncReport struct {
+	Uploaded  []string `json:"uploaded"`
+	Unchanged []string `json:"unchanged"`
+	Deleted   []string `json:"deleted"`
+	Skipped   []string `json:"skipped"`
+}
+
+// sync uploads regular files of a directory under keys made of prefix
+// and their names, skipping unchanged objects and files which cannot
+// be stored: too large or with names not forming valid keys.
+// With -delete, also deletes objects under prefix without files,
+// keeping those of skipped files.
+func sync(c *ctl, flags *flag.FlagSet, args []string) int {
+	prefix := flags.String("prefix", "", "prefix of keys")
+	deleteMissing := flags.Bool("delete", false, "delete objects under prefix without files, skipped or not")
+	dryRun := flags.Bool("n", false, "only report what would be done")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	dir := flags.Arg(0)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return c.fail(err)
+	}
+	keys, err := c.keys(*prefix, "")
+	if err != nil {
+		return c.fail(err)
+	}
+	remote := make(map[string]bool)
+	for _, key := range keys {
+		remote[key] = true
+	}
+
+	validKey := regexp.MustCompile(router.KeyPattern).MatchString
+	report := syncReport{Uploaded: []string{}, Unchanged: []string{}, Deleted: []string{}, Skipped: []string{}}
+	local := make(map[string]bool)
+	for _, file := range files {
+		key := *prefix + file.Name()
+		// Files still exist even if skipped, e.g. when
+		// grown too large, so their objects are kept.
+		local[key] = true
+		if !file.Mode().IsRegular() || file.Size() > router.MaxObjectSize || !validKey(key) {
+			report.Skipped = append(report.Skipped, file.Name())
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return c.fail(err)
+		}
+		contentType := contentTypeOf(file.Name())
+		if remote[key] {
+			unchanged, err := c.unchanged(key, data, contentType)
+			if err != nil {
+				return c.fail(err)
+			}
+			if unchanged {
+				report.Unchanged = append(report.Unchanged, key)
+				continue
+			}
+		}
+		if !*dryRun {
+			ctx, cancel := c.context()
+			err := c.client.Put(ctx, key, bytes.NewReader(data), contentType)
+			cancel()
+			if err != nil {
+				return c.fail(err)
+			}
+		}
+		report.Uploaded = append(report.Uploaded, key)
+	}
+
+	if *deleteMissing {
+		for _, key := range keys {
+			if local[key] {
+				continue
+			}
+			if !*dryRun {
+				ctx, cancel := c.context()
+				err := c.client.Delete(ctx, key)
+				cancel()
+				if err != nil {
+					return c.fail(err)
+				}
+			}
+			report.Deleted = append(report.Deleted, key)
+		}
+	}
+
+	c.print(report, report.text(*dryRun))
+	return exitOk
+}
+
+// unchanged tells whether object under key holds data of contentType.
+// Absent objects are changed.
+func (c *ctl) unchanged(key string, data []byte, contentType string) (bool, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	object, err := c.client.Get(ctx, key)
+	if err == client.KeyAbsentError {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer object.Body.Close()
+	current, err := ioutil.ReadAll(object.Body)
+	return object.ContentType == contentType && bytes.Equal(current, data), err
+}
+
+func (r syncReport) text(dryRun bool) string {
+	var text bytes.Buffer
+	for _, key := range r.Uploaded {
+		fmt.Fprintln(&text, "put "+key)
+	}
+	for _, key := range r.Deleted {
+		fmt.Fprintln(&text, "deleted "+key)
+	}
+	for _, name := range r.Skipped {
+		fmt.Fprintln(&text, "skipped "+name)
+	}
+	fmt.Fprintf(&text, "uploaded %d, unchanged %d, deleted %d, skipped %d", len(r.Uploaded), len(r.Unchanged), len(r.Deleted), len(r.Skipped))
+	if dryRun {
+		text.WriteString(" (dry run)")
+	}
+	return text.String()
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"net/http"
+)
+
+// Probes serves liveness probe under HealthUrl and readiness probe
+// under ReadyUrl, passing other requests to next. Probes are meant
+// to be served before authentication and rate limiting.
+func (h *Health) Probes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case HealthUrl:
+			getHealth(w, r)
+		case ReadyUrl:
+			h.getReady(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// getHealth writes code http.StatusOK while the process is running.
+func getHealth(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := w.Write([]byte("ok\n")); err != nil {
+		panic(err)
+	}
+}
+
+// getReady writes results of readiness checks into body in JSON format,
+// with code http.StatusOK if the server is ready and
+// http.StatusServiceUnavailable otherwise.
+func (h *Health) getReady(w http.ResponseWriter, _ *http.Request) {
+	ready, checks := h.describeChecks()
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	apierror.WriteJson(w, code, struct {
+		Ready  bool              `json:"ready"`
+		Checks map[string]string `json:"checks"`
+	}{ready, checks})
+}
+
+// StatusHandler returns handler writing Status into body in JSON format,
+// to be mounted under StatusUrl.
+func (h *Health) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJson(w, http.StatusOK, h.Status())
+	})
+}
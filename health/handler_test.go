@@ -0,0 +1,69 @@
+package health
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbes(t *testing.T) {
+	h := newTestHealth(t, storage.NewStorage(), nil)
+	handler := h.Probes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	serve := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	ready := func() (bool, map[string]string) {
+		var body struct {
+			Ready  bool              `json:"ready"`
+			Checks map[string]string `json:"checks"`
+		}
+		w := serve(ReadyUrl)
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid body %s: %v", w.Body.String(), err)
+		}
+		if body.Ready != (w.Code == http.StatusOK) {
+			t.Errorf("code %d does not match body %s", w.Code, w.Body.String())
+		}
+		return body.Ready, body.Checks
+	}
+
+	if w := serve(HealthUrl); w.Code != http.StatusOK {
+		t.Errorf("expected code %d, got %d", http.StatusOK, w.Code)
+	}
+	if isReady, checks := ready(); isReady || checks["load"] != NotLoadedError.Error() {
+		t.Errorf("ready before load: %v", checks)
+	}
+	h.Loaded(h.now(), nil)
+	if isReady, checks := ready(); !isReady || checks["load"] != "ok" || checks["shutdown"] != "ok" {
+		t.Errorf("not ready after load: %v", checks)
+	}
+	h.ShutDown()
+	if isReady, _ := ready(); isReady {
+		t.Error("ready while shutting down")
+	}
+	if w := serve(HealthUrl); w.Code != http.StatusOK {
+		t.Error("not alive while shutting down")
+	}
+	if w := serve("/api/objects"); w.Code != http.StatusTeapot {
+		t.Error("request not passed")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	h := newTestHealth(t, storage.NewStorage(), nil)
+	w := httptest.NewRecorder()
+	h.StatusHandler().ServeHTTP(w, httptest.NewRequest("GET", StatusUrl, nil))
+	var status Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || status.Version != "1.0.0" || status.Ready {
+		t.Errorf("unexpected status %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,218 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"sync"
+	"time"
+)
+
+const (
+	HealthUrl = "/healthz"
+	ReadyUrl  = "/readyz"
+	StatusUrl = "/status"
+)
+
+const (
+	statusBucket = "GWP_status"
+	lastSaveKey  = "lastSave"
+)
+
+var (
+	NotLoadedError    = errors.New("data not loaded")
+	ShuttingDownError = errors.New("server shutting down")
+)
+
+// Store persists result of the last successful save,
+// implemented by persistence.MetaStore.
+type Store interface {
+	Load(bucketName string) (map[string][]byte, error)
+	Put(ctx context.Context, bucketName, key string, record []byte) error
+}
+
+// Result describes a load or save of data.
+type Result struct {
+	Time       time.Time `json:"time"`
+	DurationMs float64   `json:"durationMs"`
+	Objects    int       `json:"objects"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status describes the server.
+type Status struct {
+	Ready         bool              `json:"ready"`
+	Checks        map[string]string `json:"checks"`
+	Version       string            `json:"version"`
+	Started       time.Time         `json:"started"`
+	UptimeSeconds float64           `json:"uptimeSeconds"`
+	Objects       int               `json:"objects"`
+	Bytes         int               `json:"bytes"`
+	Load          *Result           `json:"load"`
+	LastSave      *Result           `json:"lastSave"`
+}
+
+type check struct {
+	name string
+	fn   func() error
+}
+
+// Health tracks readiness of the server to serve requests:
+// data must be loaded, checks added with AddCheck must pass
+// and the server must not be shutting down.
+type Health struct {
+	version     string
+	dataStorage storage.Storage
+	store       Store
+	started     time.Time
+	now         func() time.Time
+
+	mut          sync.Mutex
+	checks       []check
+	load         *Result
+	lastSave     *Result
+	shuttingDown bool
+}
+
+// New creates Health of server with version serving dataStorage.
+// Result of the last successful save is kept in store, if it is not nil.
+func New(version string, dataStorage storage.Storage, store Store) (*Health, error) {
+	h := &Health{
+		version:     version,
+		dataStorage: dataStorage,
+		store:       store,
+		now:         time.Now,
+	}
+	h.started = h.now()
+	if store != nil {
+		records, err := store.Load(statusBucket)
+		if err != nil {
+			return nil, err
+		}
+		if record, ok := records[lastSaveKey]; ok {
+			var lastSave Result
+			if err := json.Unmarshal(record, &lastSave); err != nil {
+				return nil, err
+			}
+			h.lastSave = &lastSave
+		}
+	}
+	return h, nil
+}
+
+// AddCheck adds check of readiness called name.
+func (h *Health) AddCheck(name string, fn func() error) {
+	h.mut.Lock()
+	h.checks = append(h.checks, check{name, fn})
+	h.mut.Unlock()
+}
+
+// Loaded records result of loading data started at start.
+// Server is not ready until data is loaded successfully.
+func (h *Health) Loaded(start time.Time, err error) {
+	result := h.result(start, err)
+	h.mut.Lock()
+	h.load = &result
+	h.mut.Unlock()
+}
+
+// Saved records result of saving data started at start, if it succeeded,
+// and keeps it in store. Failed saves are not recorded.
+func (h *Health) Saved(start time.Time, err error) error {
+	if err != nil {
+		return nil
+	}
+	result := h.result(start, nil)
+	h.mut.Lock()
+	h.lastSave = &result
+	h.mut.Unlock()
+	if h.store == nil {
+		return nil
+	}
+	if record, err := json.Marshal(result); err == nil {
+		return h.store.Put(context.Background(), statusBucket, lastSaveKey, record)
+	} else {
+		return err
+	}
+}
+
+func (h *Health) result(start time.Time, err error) Result {
+	end := h.now()
+	objects, _ := storage.Total(h.dataStorage)
+	result := Result{
+		Time:       end.UTC(),
+		DurationMs: float64(end.Sub(start)) / float64(time.Millisecond),
+		Objects:    int(objects),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ShutDown marks the server as shutting down, so that it is not ready
+// and load balancers stop sending it requests.
+func (h *Health) ShutDown() {
+	h.mut.Lock()
+	h.shuttingDown = true
+	h.mut.Unlock()
+}
+
+// Check runs checks of readiness, returning their errors by name.
+// Server is ready if all errors are nil.
+func (h *Health) Check() map[string]error {
+	h.mut.Lock()
+	results := make(map[string]error, len(h.checks)+2)
+	if h.load == nil {
+		results["load"] = NotLoadedError
+	} else if h.load.Error != "" {
+		results["load"] = errors.New(h.load.Error)
+	} else {
+		results["load"] = nil
+	}
+	if h.shuttingDown {
+		results["shutdown"] = ShuttingDownError
+	} else {
+		results["shutdown"] = nil
+	}
+	checks := h.checks
+	h.mut.Unlock()
+	for _, check := range checks {
+		results[check.name] = check.fn()
+	}
+	return results
+}
+
+// Status returns status of the server.
+func (h *Health) Status() Status {
+	status := Status{
+		Version: h.version,
+		Started: h.started.UTC(),
+	}
+	status.Ready, status.Checks = h.describeChecks()
+	status.UptimeSeconds = h.now().Sub(h.started).Seconds()
+	objects, bytes := storage.Total(h.dataStorage)
+	status.Objects, status.Bytes = int(objects), int(bytes)
+	h.mut.Lock()
+	status.Load = h.load
+	status.LastSave = h.lastSave
+	h.mut.Unlock()
+	return status
+}
+
+// describeChecks runs checks of readiness, describing their
+// results as "ok" or errors.
+func (h *Health) describeChecks() (bool, map[string]string) {
+	ready := true
+	descriptions := make(map[string]string)
+	for name, err := range h.Check() {
+		if err == nil {
+			descriptions[name] = "ok"
+		} else {
+			ready = false
+			descriptions[name] = err.Error()
+		}
+	}
+	return ready, descriptions
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"testing"
+	"time"
+)
+
+type memoryStore map[string]map[string][]byte
+
+func (m memoryStore) Load(bucketName string) (map[string][]byte, error) {
+	records := make(map[string][]byte)
+	for key, record := range m[bucketName] {
+		records[key] = record
+	}
+	return records, nil
+}
+
+func (m memoryStore) Put(_ context.Context, bucketName, key string, record []byte) error {
+	if m[bucketName] == nil {
+		m[bucketName] = make(map[string][]byte)
+	}
+	m[bucketName][key] = record
+	return nil
+}
+
+// newTestHealth creates Health with clock advancing by a second
+// on each reading.
+func newTestHealth(t *testing.T, dataStorage storage.Storage, store Store) *Health {
+	h, err := New("1.0.0", dataStorage, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.started = now
+	h.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return h
+}
+
+func TestCheck(t *testing.T) {
+	h := newTestHealth(t, storage.NewStorage(), nil)
+	var writable error
+	h.AddCheck("persistence", func() error {
+		return writable
+	})
+	ready := func() bool {
+		for _, err := range h.Check() {
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	if checks := h.Check(); checks["load"] != NotLoadedError || len(checks) != 3 {
+		t.Errorf("unexpected checks before load: %v", checks)
+	}
+	h.Loaded(h.now(), errors.New("corrupt"))
+	if ready() {
+		t.Error("ready after failed load")
+	}
+	h.Loaded(h.now(), nil)
+	if !ready() {
+		t.Errorf("not ready: %v", h.Check())
+	}
+	writable = errors.New("read-only")
+	if h.Check()["persistence"] != writable {
+		t.Error("failed check not reported")
+	}
+	writable = nil
+	h.ShutDown()
+	if h.Check()["shutdown"] != ShuttingDownError {
+		t.Error("ready while shutting down")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dataStorage := storage.NewStorage()
+	dataStorage.Put("a", []byte("abc"), "text/plain")
+	dataStorage.Put("b", []byte("de"), "text/plain")
+	store := make(memoryStore)
+	h := newTestHealth(t, dataStorage, store)
+	h.Loaded(h.now().Add(-time.Second), nil)
+
+	status := h.Status()
+	if !status.Ready || status.Version != "1.0.0" || status.Objects != 2 || status.Bytes != 5 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.UptimeSeconds != 3 {
+		t.Errorf("expected uptime 3s, got %v", status.UptimeSeconds)
+	}
+	if status.Load == nil || status.Load.DurationMs != 2000 || status.Load.Objects != 2 || status.Load.Error != "" {
+		t.Errorf("unexpected load %+v", status.Load)
+	}
+	if status.LastSave != nil {
+		t.Errorf("unexpected save %+v", status.LastSave)
+	}
+
+	if err := h.Saved(h.now(), errors.New("disk full")); err != nil {
+		t.Fatal(err)
+	}
+	if h.Status().LastSave != nil {
+		t.Error("failed save recorded")
+	}
+	start := h.now()
+	if err := h.Saved(start, nil); err != nil {
+		t.Fatal(err)
+	}
+	lastSave := h.Status().LastSave
+	if lastSave == nil || !lastSave.Time.Equal(start.Add(time.Second)) || lastSave.Objects != 2 {
+		t.Errorf("unexpected save %+v", lastSave)
+	}
+
+	// Last save survives restart.
+	restarted := newTestHealth(t, dataStorage, store)
+	if status := restarted.Status(); status.LastSave == nil || !status.LastSave.Time.Equal(lastSave.Time) {
+		t.Errorf("save not restored: %+v", status.LastSave)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	GWPRouter "github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+	"os"
+	"regexp"
+)
+
+// importData places contents of an archive in a database
+// or a running server, as described by args.
+// Database must not be used by a running server at the same time,
+// since the server overwrites it at shutdown.
+// Returns exit code: 0 on success, 1 on failure, 2 on usage errors.
+func importData(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	db := flags.String("db", dbName, "database to import into")
+	url := flags.String("url", "", "address of a running server to import into instead of a database")
+	input := flags.String("i", "-", "archive file, - for standard input")
+	conflict := flags.String("conflict", "skip", "what to do with keys already present: skip or overwrite")
+	ns := flags.String("namespace", namespace.Default, "existing namespace to import into")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import [-db file | -url address] [-namespace name] [-conflict skip|overwrite] [-i file]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var policy archive.ConflictPolicy
+	switch *conflict {
+	case "skip":
+		policy = archive.Skip
+	case "overwrite":
+		policy = archive.Overwrite
+	default:
+		flags.Usage()
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var target storage.Storage
+	var remote *remoteStorage
+	var namespaces *namespace.Manager
+	if *url != "" {
+		remote = newRemoteStorage(*url, *ns)
+		target = remote
+	} else if *ns != namespace.Default {
+		// Manager checks that the namespace exists
+		// and enforces its quotas.
+		quotas := storage.NewQuotaStorage(storage.NewStorage())
+		var err error
+		namespaces, err = namespace.NewManager(persistence.NewNamespaceStore(*db), quotas, storage.NewObservableStorage(quotas))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		local, ok := namespaces.Storage(*ns)
+		if !ok {
+			fmt.Fprintln(os.Stderr, namespace.NamespaceAbsentError)
+			return 1
+		}
+		target = local
+	} else {
+		local := storage.NewStorage()
+		if _, err := os.Stat(*db); err == nil {
+			if err := persistence.LoadFromDb(local, *db); err != nil && err != persistence.BucketAbsentError {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		target = local
+	}
+
+	validKey := regexp.MustCompile(GWPRouter.KeyPattern).MatchString
+	report, err := archive.Import(target, r, policy, validKey)
+	if err == nil && remote != nil {
+		err = remote.err
+	}
+	if err == nil && namespaces != nil {
+		err = namespaces.Save()
+	} else if err == nil && remote == nil {
+		err = persistence.SaveToDb(target, *db)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "imported %d objects, skipped %d\n", report.Imported, report.Skipped)
+	return 0
+}
@@ -0,0 +1,115 @@
+package limit
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultBurst = 20
+
+// Interval of removing buckets of idle clients.
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter limits rate of requests of each client with a token bucket,
+// refilled with rate tokens per second up to burst tokens.
+type Limiter struct {
+	rate      float64
+	burst     float64
+	mut       sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+	exempt    func(*http.Request) bool
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from client's bucket. If there is none,
+// returns false and time after which a token will be available.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	now := l.now()
+	l.prune(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// prune removes buckets refilled completely, since they are
+// equivalent to absent ones. Must be called with mut held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Exempt makes Middleware pass requests for which fn
+// returns true, without taking tokens.
+func (l *Limiter) Exempt(fn func(*http.Request) bool) {
+	l.exempt = fn
+}
+
+// Middleware stops requests of clients over the limit with code
+// http.StatusTooManyRequests, setting Retry-After header.
+// Authenticated clients are told apart by IDs of their credentials,
+// others, and those of credentials without IDs, by their IP addresses.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.exempt != nil && l.exempt(r) {
+			next.ServeHTTP(w, r)
+		} else if ok, wait := l.Allow(client(r)); ok {
+			next.ServeHTTP(w, r)
+		} else {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			apierror.WriteDetails(w, r, http.StatusTooManyRequests, apierror.RateLimited,
+				"too many requests", map[string]int{"retryAfter": seconds})
+		}
+	})
+}
+
+// client returns ID of request's identity if it is authenticated
+// and has one, its IP address otherwise.
+func client(r *http.Request) string {
+	if identity, ok := auth.IdentityFrom(r.Context()); ok && identity.Id != "" {
+		return "identity " + identity.Id
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
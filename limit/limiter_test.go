@@ -0,0 +1,84 @@
+package limit
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *time.Time) {
+	now := time.Unix(1000, 0)
+	limiter := NewLimiter(rate, burst)
+	limiter.now = func() time.Time {
+		return now
+	}
+	return limiter, &now
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter, now := newTestLimiter(2, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	if ok, wait := limiter.Allow("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("wrong result over burst: %v %v", ok, wait)
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("other client rejected")
+	}
+	*now = now.Add(250 * time.Millisecond)
+	if ok, wait := limiter.Allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("wrong result before refill: %v %v", ok, wait)
+	}
+	*now = now.Add(250 * time.Millisecond)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Error("request after refill rejected")
+	}
+
+	*now = now.Add(pruneInterval)
+	limiter.Allow("c")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("idle buckets not pruned: %v", limiter.buckets)
+	}
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	limiter, _ := newTestLimiter(0.5, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	dataSets := []struct {
+		remoteAddr    string
+		authenticated bool
+		identity      string
+		code          int
+	}{
+		{"10.0.0.1:1000", false, "", http.StatusOK},
+		{"10.0.0.1:1001", false, "", http.StatusTooManyRequests},
+		{"10.0.0.2:1000", false, "", http.StatusOK},
+		{"10.0.0.1:1002", true, "key 1", http.StatusOK},
+		{"10.0.0.3:1000", true, "key 1", http.StatusTooManyRequests},
+		{"10.0.0.3:1001", true, "key 2", http.StatusOK},
+		{"10.0.0.2:1001", true, "", http.StatusTooManyRequests},
+	}
+	for i, dataSet := range dataSets {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = dataSet.remoteAddr
+		if dataSet.authenticated {
+			r = r.WithContext(auth.WithIdentity(r.Context(), &auth.Identity{Id: dataSet.identity, Name: "client"}))
+		}
+		handler.ServeHTTP(w, r)
+		if w.Code != dataSet.code {
+			t.Errorf("wrong code of request %d: %v", i, w.Code)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("wrong Retry-After of request %d: %v", i, w.Header().Get("Retry-After"))
+		}
+	}
+}
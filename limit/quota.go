@@ -0,0 +1,35 @@
+package limit
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+)
+
+const Url = "/api/usage"
+
+// LoadQuotas reads quotas from a JSON file, an array of storage.Quota.
+func LoadQuotas(fileName string) ([]storage.Quota, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var quotas []storage.Quota
+	if err := json.Unmarshal(contents, &quotas); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// Handler returns handler describing usage of quotas,
+// to be mounted under Url.
+func Handler(quotas *storage.QuotaStorage) http.Handler {
+	router := chi.NewRouter()
+	router.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJson(w, http.StatusOK, quotas.Usage())
+	})
+	return router
+}
@@ -0,0 +1,58 @@
+package limit
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadQuotas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "GWP_quota_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "quotas.json")
+	contents := `[{"prefix": "user", "maxBytes": 1000}, {"prefix": "", "maxObjects": 10}]`
+	if err := ioutil.WriteFile(fileName, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	quotas, err := LoadQuotas(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []storage.Quota{{Prefix: "user", MaxBytes: 1000}, {Prefix: "", MaxObjects: 10}}
+	if !reflect.DeepEqual(quotas, expected) {
+		t.Errorf("wrong quotas: %v", quotas)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dataStorage := storage.NewQuotaStorage(storage.NewStorage())
+	dataStorage.SetQuotas([]storage.Quota{{Prefix: "user", MaxBytes: 1000}})
+	if err := dataStorage.Put("user1", []byte("data"), "type"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	Handler(dataStorage).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong code: %v", w.Code)
+	}
+	var usage []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]interface{}{
+		{"prefix": "user", "maxBytes": 1000.0, "maxObjects": 0.0, "bytes": 4.0, "objects": 1.0},
+	}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("wrong usage: %v", usage)
+	}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// RequestIdHeader carries ID of a request, taken from the client
+// if it sends a valid one, and returned in the response.
+const RequestIdHeader = "X-Request-ID"
+
+var requestIdRegex = regexp.MustCompile("^[0-9a-zA-Z._-]{1,128}$")
+
+type contextKey struct{}
+
+// request holds attributes of a request logged by Middleware.
+type request struct {
+	id     string
+	mut    sync.Mutex
+	fields Fields
+}
+
+// RequestId returns ID of request with ctx,
+// empty if it is not logged by Middleware.
+func RequestId(ctx context.Context) string {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		return req.id
+	}
+	return ""
+}
+
+// Annotate adds fields to access log entry of request with ctx,
+// for handlers knowing more about the request, e.g. its identity.
+func Annotate(ctx context.Context, fields Fields) {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		req.mut.Lock()
+		for name, value := range fields {
+			req.fields[name] = value
+		}
+		req.mut.Unlock()
+	}
+}
+
+// Track returns ctx carrying request with id, replaced with a new one
+// if it is not valid, so that the request can be annotated. Returned
+// function reads the annotations. For servers other than HTTP ones,
+// logging their requests on their own.
+func Track(ctx context.Context, id string) (context.Context, func() Fields) {
+	req := &request{id: id, fields: make(Fields)}
+	if !requestIdRegex.MatchString(req.id) {
+		req.id = newRequestId()
+	}
+	return context.WithValue(ctx, contextKey{}, req), func() Fields {
+		req.mut.Lock()
+		defer req.mut.Unlock()
+		fields := make(Fields)
+		for name, value := range req.fields {
+			fields[name] = value
+		}
+		return fields
+	}
+}
+
+// Response describes a request served with Serve.
+type Response struct {
+	Status int    // status code, http.StatusOK if not written
+	Bytes  int    // size of written body
+	Route  string // chi route pattern of the matched route, empty if unmatched
+	rctx   *chi.Context
+}
+
+// URLParam returns value of URL parameter of the matched route.
+func (r Response) URLParam(name string) string {
+	return r.rctx.URLParam(name)
+}
+
+// Serve serves r with next, describing the response and the matched
+// route. For middlewares observing requests, placed before chi routers.
+func Serve(next http.Handler, w http.ResponseWriter, r *http.Request) Response {
+	// chi routers use route context found in request's context,
+	// so the matched route can be read afterwards.
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		rctx = chi.NewRouteContext()
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	}
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	next.ServeHTTP(ww, r)
+
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return Response{Status: status, Bytes: ww.BytesWritten(), Route: rctx.RoutePattern(), rctx: rctx}
+}
+
+// Middleware logs each request with its ID, method, chi route pattern,
+// key, status, response size, latency and annotations.
+// Requests answered with server errors are logged at Error level.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, annotations := Track(r.Context(), r.Header.Get(RequestIdHeader))
+		id := RequestId(ctx)
+		w.Header().Set(RequestIdHeader, id)
+		response := Serve(next, w, r.WithContext(ctx))
+
+		fields := Fields{
+			"request_id": id,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     response.Status,
+			"bytes":      response.Bytes,
+			"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"remote":     r.RemoteAddr,
+		}
+		if response.Route != "" {
+			fields["route"] = response.Route
+		}
+		if key := response.URLParam("key"); key != "" {
+			fields["key"] = key
+		}
+		for name, value := range annotations() {
+			fields[name] = value
+		}
+		level := Info
+		if response.Status >= http.StatusInternalServerError {
+			level = Error
+		}
+		l.Log(level, "request", fields)
+	})
+}
+
+func newRequestId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
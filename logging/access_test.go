@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	logger, buf := newTestLogger(Info)
+	router := chi.NewRouter()
+	router.Route("/api/objects", func(router chi.Router) {
+		router.Get("/{key}", func(w http.ResponseWriter, r *http.Request) {
+			Annotate(r.Context(), Fields{"identity": "client"})
+			if RequestId(r.Context()) == "" {
+				t.Error("request ID not passed")
+			}
+			w.Write([]byte("data"))
+		})
+		router.Delete("/{key}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	})
+	handler := logger.Middleware(router)
+
+	dataSets := []struct {
+		method    string
+		url       string
+		requestId string
+		expected  map[string]interface{}
+	}{
+		{"GET", "/api/objects/abc", "client-id", map[string]interface{}{
+			"level": "info", "msg": "request", "request_id": "client-id", "method": "GET",
+			"path": "/api/objects/abc", "route": "/api/objects/{key}", "key": "abc",
+			"status": 200.0, "bytes": 4.0, "identity": "client", "remote": "192.0.2.1:1234",
+		}},
+		{"DELETE", "/api/objects/abc", "", map[string]interface{}{
+			"level": "error", "status": 500.0, "bytes": 0.0,
+		}},
+		{"GET", "/absent", "invalid id", map[string]interface{}{
+			"level": "info", "path": "/absent", "status": 404.0,
+		}},
+	}
+	for _, dataSet := range dataSets {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(dataSet.method, dataSet.url, nil)
+		if dataSet.requestId != "" {
+			r.Header.Set(RequestIdHeader, dataSet.requestId)
+		}
+		handler.ServeHTTP(w, r)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid entry %s: %v", buf.String(), err)
+		}
+		for name, value := range dataSet.expected {
+			if entry[name] != value {
+				t.Errorf("wrong %s of %s %s: %v", name, dataSet.method, dataSet.url, entry[name])
+			}
+		}
+		if _, ok := entry["latency_ms"].(float64); !ok {
+			t.Errorf("no latency in %s", buf.String())
+		}
+		id := w.Header().Get(RequestIdHeader)
+		if id != entry["request_id"] || len(id) == 0 || (dataSet.requestId == "client-id" && id != "client-id") {
+			t.Errorf("wrong request ID header: %v", id)
+		}
+		if dataSet.requestId == "invalid id" && id == "invalid id" {
+			t.Error("invalid request ID accepted")
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	router := chi.NewRouter()
+	router.Get("/objects/{key}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	})
+	// Nested calls share the route context.
+	var inner Response
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = Serve(router, w, r)
+	})
+
+	response := Serve(handler, httptest.NewRecorder(), httptest.NewRequest("GET", "/objects/abc", nil))
+	for _, r := range []Response{response, inner} {
+		if r.Status != http.StatusOK || r.Bytes != 4 || r.Route != "/objects/{key}" || r.URLParam("key") != "abc" {
+			t.Errorf("wrong response: %+v", r)
+		}
+	}
+	response = Serve(router, httptest.NewRecorder(), httptest.NewRequest("GET", "/absent", nil))
+	if response.Status != http.StatusNotFound || response.Route != "" {
+		t.Errorf("wrong response: %+v", response)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	ctx, annotations := Track(context.Background(), "client-id")
+	Annotate(ctx, Fields{"identity": "client"})
+	if id := RequestId(ctx); id != "client-id" {
+		t.Errorf("wrong request ID: %v", id)
+	}
+	if fields := annotations(); len(fields) != 1 || fields["identity"] != "client" {
+		t.Errorf("wrong annotations: %v", fields)
+	}
+
+	ctx, _ = Track(context.Background(), "invalid id")
+	if id := RequestId(ctx); id == "invalid id" || id == "" {
+		t.Errorf("wrong request ID: %v", id)
+	}
+}
@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is severity of a log entry.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= Debug && l <= Error {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("level%d", int(l))
+}
+
+// ParseLevel returns level with given name.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Fields are additional attributes of a log entry.
+type Fields map[string]interface{}
+
+// Logger writes entries as JSON lines, with time, level and msg
+// attributes followed by fields.
+type Logger struct {
+	mut   sync.Mutex
+	out   io.Writer
+	level Level
+	now   func() time.Time
+}
+
+// New creates a Logger writing entries of level and above to out.
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, level: level, now: time.Now}
+}
+
+// SetLevel changes minimal level of written entries.
+func (l *Logger) SetLevel(level Level) {
+	l.mut.Lock()
+	l.level = level
+	l.mut.Unlock()
+}
+
+// Enabled reports whether entries of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return level >= l.level
+}
+
+// Log writes an entry, if its level is enabled. Errors among
+// fields are written as their messages.
+func (l *Logger) Log(level Level, msg string, fields Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, l.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, msg)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteByte(',')
+		writeValue(&buf, name)
+		buf.WriteByte(':')
+		value := fields[name]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		writeValue(&buf, value)
+	}
+	buf.WriteString("}\n")
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	// There is nowhere to report failed writes.
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func (l *Logger) Debug(msg string, fields Fields) {
+	l.Log(Debug, msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields Fields) {
+	l.Log(Info, msg, fields)
+}
+
+func (l *Logger) Warn(msg string, fields Fields) {
+	l.Log(Warn, msg, fields)
+}
+
+func (l *Logger) Error(msg string, fields Fields) {
+	l.Log(Error, msg, fields)
+}
+
+// Writer returns a writer logging each write as an entry of level,
+// for use as output of the standard log package.
+func (l *Logger) Writer(level Level) io.Writer {
+	return &writer{l, level}
+}
+
+type writer struct {
+	logger *Logger
+	level  Level
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.logger.Log(w.level, strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+// writeValue writes value in JSON, or its fmt representation
+// as a string if it cannot be marshaled.
+func writeValue(buf *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
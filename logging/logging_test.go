@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := New(&buf, level)
+	logger.now = func() time.Time {
+		return time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	}
+	return logger, &buf
+}
+
+func TestLogger(t *testing.T) {
+	logger, buf := newTestLogger(Info)
+	logger.Debug("hidden", nil)
+	logger.Info("started", Fields{"addr": ":8080", "count": 3})
+	// Values which cannot be marshaled are formatted.
+	logger.Error("failed", Fields{"error": errors.New("broken"), "ch": make(chan int)})
+	logger.SetLevel(Error)
+	logger.Warn("hidden", nil)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("wrong number of entries: %s", buf.String())
+	}
+	if string(lines[0]) != `{"time":"2020-01-01T12:00:00Z","level":"info","msg":"started","addr":":8080","count":3}` {
+		t.Errorf("wrong entry: %s", lines[0])
+	}
+	if !bytes.HasPrefix(lines[1], []byte(`{"time":"2020-01-01T12:00:00Z","level":"error","msg":"failed","ch":"0x`)) ||
+		!bytes.HasSuffix(lines[1], []byte(`","error":"broken"}`)) {
+		t.Errorf("wrong entry: %s", lines[1])
+	}
+}
+
+func TestLoggerWriter(t *testing.T) {
+	logger, buf := newTestLogger(Debug)
+	std := log.New(logger.Writer(Warn), "", 0)
+	std.Printf("quoted \"%s\"", "value")
+	expected := `{"time":"2020-01-01T12:00:00Z","level":"warn","msg":"quoted \"value\""}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("wrong entry: %s", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{"debug": Debug, "INFO": Info, "warn": Warn, "error": Error} {
+		if level, err := ParseLevel(name); err != nil || level != expected {
+			t.Errorf("wrong level for %s: %v %v", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("unknown level parsed")
+	}
+}
@@ -2,10 +2,29 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/grpcapi"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/health"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/limit"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/metrics"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/openapi"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/partition"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/replication"
 	GWPRouter "github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/socket"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tracing"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/webhook"
+	"google.golang.org/grpc"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,15 +38,315 @@ const (
 	dbName          = "gwp.db"
 )
 
+// version of the server, set at build time with
+// -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// logger writes entries of the server as JSON lines.
+var logger = logging.New(os.Stderr, logging.Info)
+
+// fatal logs msg with fields at Error level and exits.
+func fatal(msg string, fields logging.Fields) {
+	logger.Error(msg, fields)
+	os.Exit(1)
+}
+
+// since returns milliseconds elapsed since start.
+func since(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+// instrument wraps handler of the server with logging, tracing
+// and metrics of requests. Panics beneath logging, also in middlewares
+// wrapping routers, get error responses like panics of handlers.
+func instrument(next http.Handler, log *logging.Logger, serverMetrics *metrics.Metrics) http.Handler {
+	return log.Middleware(apierror.Recoverer(tracing.Middleware(serverMetrics.Middleware(next))))
+}
+
 func main() {
-	dataStorage := storage.NewStorage()
-	if err := persistence.LoadFromDb(dataStorage, dbName); err != nil {
-		log.Println(err)
-		log.Println("Skipping loading data from db")
-		dataStorage = storage.NewStorage()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fsck":
+			os.Exit(fsck(os.Args[2:]))
+		case "export":
+			os.Exit(exportData(os.Args[2:]))
+		case "import":
+			os.Exit(importData(os.Args[2:]))
+		}
+	}
+
+	recoverDb := flag.Bool("recover", false, "skip and quarantine corrupt records when loading data")
+	leaderUrl := flag.String("leader", "", "run as a read replica of the leader at given address")
+	leaderToken := flag.String("leader-token", "", "authenticate to the leader with API key or JWT read from given file")
+	addr := flag.String("addr", port, "address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve gRPC API on, disabled if empty")
+	db := flag.String("db", dbName, "database file")
+	raftId := flag.String("raft-id", "", "run as a member of Raft cluster with given node ID")
+	raftAddr := flag.String("raft-addr", raftAddress, "address for Raft communication")
+	raftDir := flag.String("raft-dir", raftDirName, "directory for Raft log and snapshots")
+	raftPeers := flag.String("raft-peers", "", "cluster members used for bootstrap, as id=address,id=address")
+	linearizable := flag.Bool("linearizable", false, "serve only linearizable reads in Raft cluster")
+	clusterSelf := flag.String("cluster-self", "", "run as a partitioned cluster node reachable at given address")
+	clusterJoin := flag.String("cluster-join", "", "address of a cluster node to join")
+	clusterSecret := flag.String("cluster-secret", "", "authenticate cluster nodes with secret shared by them, read from given file")
+	authEnabled := flag.Bool("auth", false, "require API keys")
+	var jwt jwtFlags
+	flag.StringVar(&jwt.jwks, "jwt-jwks", "", "accept JWTs signed with keys from given JWKS file")
+	flag.StringVar(&jwt.key, "jwt-key", "", "accept JWTs signed with public key from given PEM file")
+	flag.StringVar(&jwt.secret, "jwt-secret", "", "accept JWTs signed with HS256 secret from given file")
+	flag.StringVar(&jwt.issuer, "jwt-issuer", "", "required issuer of JWTs")
+	flag.StringVar(&jwt.audience, "jwt-audience", "", "required audience of JWTs")
+	flag.StringVar(&jwt.claim, "jwt-claim", auth.DefaultClaim, "JWT claim holding permissions")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with certificate from given PEM file")
+	tlsKey := flag.String("tls-key", "", "private key of TLS certificate")
+	tlsClientCA := flag.String("tls-client-ca", "", "require client certificates signed by CAs from given PEM file")
+	tlsIdentities := flag.String("tls-identities", "", "authenticate clients with certificates of subjects from given JSON file")
+	rateLimit := flag.Float64("rate-limit", 0, "requests per second allowed for each client, unlimited if 0")
+	rateBurst := flag.Int("rate-burst", limit.DefaultBurst, "requests allowed for each client at once")
+	quotasFile := flag.String("quotas", "", "enforce storage quotas of tenants from given JSON file")
+	logLevel := flag.String("log-level", "info", "minimal level of logged entries: debug, info, warn or error")
+	traceEndpoint := flag.String("trace-endpoint", "", "export traces to OTLP/HTTP collector at given URL")
+	traceFile := flag.String("trace-file", "", "export traces as JSON lines to given file, - for standard output")
+	traceService := flag.String("trace-service", "gwp", "service name of exported traces")
+	drainDelay := flag.Duration("drain-delay", 0, "time to report not ready before shutting down, so that load balancers stop sending requests")
+	maxRestoreSize := flag.Int64("max-restore-size", GWPRouter.DefaultMaxRestoreSize, "maximum size of restored backups in bytes, held in memory while validated")
+	eventsLog := flag.Int("events-log", events.DefaultLogSize, "number of recent mutations kept for resuming event streams")
+	flag.Parse()
+	if level, err := logging.ParseLevel(*logLevel); err == nil {
+		logger.SetLevel(level)
+	} else {
+		fatal("Invalid log level", logging.Fields{"error": err})
+	}
+	// Other packages log with the standard logger.
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(logging.Info))
+	if *traceEndpoint != "" && *traceFile != "" {
+		fatal("Traces are exported either to -trace-endpoint or to -trace-file", nil)
+	}
+	stopTracing := func() {}
+	if *traceEndpoint != "" || *traceFile != "" {
+		var err error
+		if stopTracing, err = startTracing(*traceEndpoint, *traceFile, *traceService); err != nil {
+			fatal("Failed to start tracing", logging.Fields{"error": err})
+		}
+	}
+	if *clusterSelf != "" && (*raftId != "" || *leaderUrl != "") {
+		fatal("Partitioned cluster cannot be combined with Raft or replication", nil)
+	}
+	if (*clusterSelf == "") != (*clusterSecret == "") {
+		fatal("Partitioned cluster requires both -cluster-self and -cluster-secret", nil)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal("TLS requires both -tls-cert and -tls-key", nil)
+	}
+	if *tlsClientCA != "" && *tlsCert == "" {
+		fatal("Client certificates require -tls-cert and -tls-key", nil)
+	}
+	if *tlsIdentities != "" && *tlsClientCA == "" {
+		fatal("Certificate identities require -tls-client-ca", nil)
+	}
+	if *quotasFile != "" && (*raftId != "" || *leaderUrl != "") {
+		// Followers must accept all mutations of the leader.
+		fatal("Quotas are not available in Raft cluster and on followers", nil)
+	}
+	if *grpcAddr != "" && (*raftId != "" || *clusterSelf != "") {
+		// Cluster nodes would serve only their local keys.
+		fatal("gRPC API is not available in Raft cluster and on cluster nodes", nil)
+	}
+	if *leaderToken != "" && *leaderUrl == "" {
+		fatal("Leader token requires -leader", nil)
+	}
+	authRequired := *authEnabled || jwt.enabled() || *tlsIdentities != ""
+	if (authRequired || *tlsClientCA != "") && (*raftId != "" || *leaderUrl != "" || *clusterSelf != "") {
+		// Servers do not authenticate to each other.
+		fatal("Authentication is available only on standalone servers", nil)
+	}
+
+	server := &http.Server{Addr: *addr}
+	replicationCtx, stopReplication := context.WithCancel(context.Background())
+	var save func() error
+	var cluster *partition.Cluster
+	var dispatcher *webhook.Dispatcher
+	var limiter *limit.Limiter
+	var serverHealth *health.Health
+	var objects *grpcapi.Server
+	var authenticator *auth.Authenticator
+	serverMetrics := metrics.New()
+	spec := openapi.Spec(version)
+	// Checks requests right before routing, after
+	// authentication and rate limiting.
+	validate := openapi.Validate(spec)
+	if *rateLimit > 0 {
+		limiter = limit.NewLimiter(*rateLimit, *rateBurst)
+	}
+	if *raftId != "" {
+		// Raft keeps its own log and snapshots, db file is not used.
+		start := time.Now()
+		raftStorage, err := startRaft(*raftId, *raftAddr, *raftDir, *raftPeers, *linearizable)
+		if err != nil {
+			fatal("Failed to start Raft", logging.Fields{"error": err})
+		}
+		if serverHealth, err = health.New(version, raftStorage, nil); err != nil {
+			fatal("Failed to start health checks", logging.Fields{"error": err})
+		}
+		serverHealth.Loaded(start, nil)
+		defer func() {
+			if err := raftStorage.Shutdown(); err != nil {
+				logger.Error("Failed to shut down Raft", logging.Fields{"error": err})
+			}
+		}()
+		router := GWPRouter.NewRouter(raftStorage)
+		mounted := features{
+			metrics: serverMetrics.Handler(),
+			status:  serverHealth.StatusHandler(),
+			openapi: openapi.Handler(spec),
+		}
+		mounted.mount(router)
+		serverMetrics.ObserveStorage(raftStorage)
+		server.Handler = validate(router)
+		if limiter != nil {
+			server.Handler = limiter.Middleware(server.Handler)
+		}
+	} else {
+		quotas := storage.NewQuotaStorage(storage.NewStorage())
+		dataStorage := storage.NewObservableStorage(quotas)
+		var err error
+		if serverHealth, err = health.New(version, dataStorage, persistence.NewMetaStore(*db)); err != nil {
+			fatal("Failed to start health checks", logging.Fields{"db": *db, "error": err})
+		}
+		serverHealth.AddCheck("persistence", func() error {
+			return persistence.CheckWritable(*db)
+		})
+		start := time.Now()
+		err = loadData(dataStorage, *db, *recoverDb)
+		serverMetrics.ObservePersistence(metrics.Load, start, err)
+		serverHealth.Loaded(start, err)
+		if err != nil {
+			// Starting with partial data would overwrite
+			// the database at shutdown.
+			fatal("Failed to load data, run with -recover or use fsck", logging.Fields{"db": *db, "error": err})
+		}
+		logger.Info("Loaded data", logging.Fields{"db": *db, "objects": len(dataStorage.Keys()), "duration_ms": since(start)})
+		if *quotasFile != "" {
+			// Set after loading, so that saved data
+			// over quotas is not lost.
+			quotaList, err := limit.LoadQuotas(*quotasFile)
+			if err != nil {
+				fatal("Failed to load quotas", logging.Fields{"file": *quotasFile, "error": err})
+			}
+			quotas.SetQuotas(quotaList)
+		}
+		save = func() error {
+			return persistence.SaveToDb(dataStorage, *db)
+		}
+
+		router := GWPRouter.NewRouterWithRestoreLimit(dataStorage, *maxRestoreSize)
+		validated := validate(router)
+		server.Handler = validated
+		mounted := features{
+			metrics: serverMetrics.Handler(),
+			status:  serverHealth.StatusHandler(),
+			openapi: openapi.Handler(spec),
+			quotas:  limit.Handler(quotas),
+		}
+		serverMetrics.ObserveStorage(dataStorage)
+		serverMetrics.WatchObjects(dataStorage)
+		feed := events.NewFeed(dataStorage, *eventsLog)
+		mounted.events = feed.Handler()
+		server.RegisterOnShutdown(feed.Close)
+		// Writes over the socket would bypass forwarding
+		// to cluster nodes and redirecting to the leader.
+		sockets := socket.NewServer(dataStorage, *clusterSelf != "" || *leaderUrl != "")
+		mounted.sockets = sockets.Handler()
+		server.RegisterOnShutdown(sockets.Close)
+		if *grpcAddr != "" {
+			// Likewise for writes over gRPC.
+			objects = grpcapi.NewServer(dataStorage, *leaderUrl != "")
+		}
+		if *clusterSelf != "" {
+			secret, err := partition.LoadSecret(*clusterSecret)
+			if err != nil {
+				fatal("Failed to load cluster secret", logging.Fields{"error": err})
+			}
+			cluster = partition.New(*clusterSelf, secret, dataStorage)
+			mounted.cluster = cluster.Handler()
+			server.Handler = cluster.Forward(validated)
+		}
+		if *leaderUrl != "" {
+			follower := replication.NewFollower(*leaderUrl, dataStorage)
+			if *leaderToken != "" {
+				token, err := loadToken(*leaderToken)
+				if err != nil {
+					fatal("Failed to load leader token", logging.Fields{"error": err})
+				}
+				follower.UseToken(token)
+			}
+			mounted.replication = follower.Handler()
+			server.Handler = follower.RedirectWrites(validated)
+			go follower.Run(replicationCtx)
+		} else {
+			leader := replication.NewLeader(dataStorage)
+			mounted.replication = leader.Handler()
+			server.RegisterOnShutdown(leader.Close)
+		}
+		if *leaderUrl == "" && *clusterSelf == "" {
+			// Followers and cluster nodes would deliver
+			// the same events again.
+			var err error
+			dispatcher, err = webhook.NewDispatcher(dataStorage, persistence.NewMetaStore(*db))
+			if err != nil {
+				fatal("Failed to load webhooks", logging.Fields{"error": err})
+			}
+			mounted.webhooks = dispatcher.Handler()
+			// Namespaces other than the default one
+			// are not replicated.
+			namespaces, err := namespace.NewManager(persistence.NewNamespaceStore(*db), quotas, dataStorage)
+			if err != nil {
+				fatal("Failed to load namespaces, run with -recover or use fsck", logging.Fields{"db": *db, "error": err})
+			}
+			mounted.namespaces = namespaces.Handler()
+			save = func() error {
+				// Failing namespaces must not cost
+				// data of the default one.
+				err := persistence.SaveToDb(dataStorage, *db)
+				if namespacesErr := namespaces.Save(); namespacesErr != nil {
+					if err != nil {
+						return fmt.Errorf("%v; %v", err, namespacesErr)
+					}
+					return namespacesErr
+				}
+				return err
+			}
+		}
+		if limiter != nil {
+			if cluster != nil {
+				// Clients are limited by the node they send
+				// requests to, not again by the owner of the key.
+				limiter.Exempt(cluster.FromNode)
+			}
+			// Wrapped by authentication below, to tell
+			// clients apart by their identities.
+			server.Handler = limiter.Middleware(server.Handler)
+		}
+		if authRequired {
+			authenticator, mounted.keys, err = startAuth(*db, *authEnabled, jwt, *tlsIdentities)
+			if err != nil {
+				fatal("Failed to start authentication", logging.Fields{"error": err})
+			}
+			authenticator.Authorize(socket.Url, auth.Authenticated)
+			authenticator.Authorize(openapi.Url, auth.Authenticated)
+			// Scrapers need not be admins.
+			authenticator.Authorize(metrics.Url, auth.Authenticated)
+			server.Handler = authenticator.Middleware(server.Handler)
+		}
+		mounted.mount(router)
 	}
 
-	server := &http.Server{Addr: port, Handler: GWPRouter.NewRouter(dataStorage)}
+	// Probes are answered before authentication and rate limiting.
+	server.Handler = serverHealth.Probes(server.Handler)
+	// Outermost, to count and log also requests
+	// stopped by other middlewares.
+	server.Handler = instrument(server.Handler, logger, serverMetrics)
 
 	go func() {
 		// Here we catch SIGINT and SIGTERM signals
@@ -35,19 +354,101 @@ func main() {
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 		<-stop
-		log.Println("Shutting down the server...")
-		ctx, _ := context.WithTimeout(context.Background(), shutdownTimeout*time.Second)
+		serverHealth.ShutDown()
+		if *drainDelay > 0 {
+			logger.Info("Draining the server", logging.Fields{"delay_ms": float64(*drainDelay) / float64(time.Millisecond)})
+			time.Sleep(*drainDelay)
+		}
+		logger.Info("Shutting down the server", nil)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout*time.Second)
+		defer cancel()
 		if err := server.Shutdown(ctx); err != nil {
-			log.Println(err)
+			logger.Error("Failed to shut down gracefully", logging.Fields{"error": err})
 		}
 	}()
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Println(err)
+	if *tlsCert != "" {
+		if err := startTLS(replicationCtx, server, *tlsCert, *tlsKey, *tlsClientCA); err != nil {
+			fatal("Failed to configure TLS", logging.Fields{"error": err})
+		}
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal("Failed to listen", logging.Fields{"addr": *addr, "error": err})
+	}
+	logger.Info("Serving", logging.Fields{"addr": listener.Addr().String(), "tls": server.TLSConfig != nil})
+	var grpcServer *grpc.Server
+	if objects != nil {
+		if grpcServer, err = startGrpc(objects, *grpcAddr, server.TLSConfig, authenticator); err != nil {
+			fatal("Failed to start gRPC API", logging.Fields{"addr": *grpcAddr, "error": err})
+		}
+	}
+	if cluster != nil && *clusterJoin != "" {
+		// Joined cluster contacts this node back,
+		// so it must be already listening.
+		go func() {
+			if err := cluster.Join(*clusterJoin); err != nil {
+				logger.Error("Failed to join cluster", logging.Fields{"address": *clusterJoin, "error": err})
+			}
+		}()
+	}
+	if server.TLSConfig != nil {
+		// Certificate is served by TLSConfig.GetCertificate.
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Error("Server failed", logging.Fields{"error": err})
+	}
+	if grpcServer != nil {
+		// Watches would keep GracefulStop waiting.
+		objects.Close()
+		grpcServer.GracefulStop()
+	}
+	stopReplication()
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+	serverMetrics.Close()
+
+	if save != nil {
+		logger.Info("Saving data", logging.Fields{"db": *db})
+		start := time.Now()
+		err := save()
+		serverMetrics.ObservePersistence(metrics.Save, start, err)
+		if err != nil {
+			fatal("Failed to save data", logging.Fields{"db": *db, "error": err})
+		}
+		if err := serverHealth.Saved(start, nil); err != nil {
+			logger.Error("Failed to record save", logging.Fields{"db": *db, "error": err})
+		}
+		logger.Info("Saved data", logging.Fields{"db": *db, "duration_ms": since(start)})
 	}
+	stopTracing()
+}
 
-	log.Println("Saving data...")
-	if err := persistence.SaveToDb(dataStorage, dbName); err != nil {
-		log.Fatal(err)
+// loadData loads data from db file into storage.
+// If recoverDb, corrupt records are skipped and quarantined.
+// Absent data is not an error, since the server
+// may be running for the first time.
+func loadData(dataStorage storage.Storage, db string, recoverDb bool) error {
+	var err error
+	if recoverDb {
+		var report persistence.Report
+		report, err = persistence.RecoverFromDb(dataStorage, db)
+		for _, corrupt := range report.Corrupt {
+			logger.Warn("Quarantined corrupt record", logging.Fields{"key": corrupt.Key, "error": corrupt.Err})
+		}
+		if err == nil {
+			logger.Info("Recovered data", logging.Fields{"loaded": report.Loaded, "corrupt": len(report.Corrupt)})
+		}
+	} else {
+		err = persistence.LoadFromDb(dataStorage, db)
+	}
+	if err == persistence.BucketAbsentError {
+		logger.Info("No data in db, starting with empty storage", logging.Fields{"db": db})
+		return nil
 	}
+	return err
 }
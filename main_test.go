@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentRecovers(t *testing.T) {
+	serverMetrics := metrics.New()
+	// Panics in middlewares wrapping the router, like authentication.
+	panicking := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == metrics.Url {
+				panic("middleware failed")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	var buf bytes.Buffer
+	handler := instrument(panicking(serverMetrics.Handler()), logging.New(&buf, logging.Info), serverMetrics)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", metrics.Url, nil))
+	var envelope apierror.Envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("invalid body: %s", w.Body.String())
+	}
+	if w.Code != http.StatusInternalServerError || envelope.Error.Code != apierror.Internal {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(buf.String(), `"panic":"middleware failed"`) || !strings.Contains(buf.String(), `"status":500`) {
+		t.Errorf("panic not logged: %s", buf.String())
+	}
+}
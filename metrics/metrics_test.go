@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_total", "Test counter.", "path")
+	histogram := registry.NewHistogram("test_seconds", "Test histogram.", []float64{1, 2})
+	registry.NewGaugeFunc("test_gauge", "Test gauge.", func() float64 {
+		return 2.5
+	})
+	counter.Inc("/b")
+	counter.Add(2, `/a"\`)
+	counter.Inc("/b")
+	histogram.Observe(0.5)
+	histogram.Observe(1)
+	histogram.Observe(3)
+
+	var buf bytes.Buffer
+	if err := registry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{path="/a\"\\"} 2
+test_total{path="/b"} 2
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="2"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 4.5
+test_seconds_count 3
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 2.5
+`
+	if buf.String() != expected {
+		t.Errorf("wrong output:\n%s", buf.String())
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	counter := NewRegistry().NewCounter("test_total", "Test counter.", "path")
+	defer func() {
+		if recover() == nil {
+			t.Error("mismatched labels accepted")
+		}
+	}()
+	counter.Inc()
+}
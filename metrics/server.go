@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const Url = "/metrics"
+
+// Operations of persistence.
+const (
+	Load = "load"
+	Save = "save"
+)
+
+// Number of mutations queued for observing object sizes.
+const storageBuffer = 4096
+
+// Methods used as labels, others are labelled "other",
+// so that clients cannot create unlimited series.
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPut: true, http.MethodPost: true,
+	http.MethodDelete: true, http.MethodOptions: true, http.MethodPatch: true,
+}
+
+// Upper bounds of buckets of object sizes, in bytes.
+var sizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Metrics are metrics of the server.
+type Metrics struct {
+	registry          *Registry
+	requests          *Counter
+	durations         *Histogram
+	objectSizes       *Histogram
+	persistence       *Histogram
+	persistenceErrors *Counter
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+}
+
+func New() *Metrics {
+	registry := NewRegistry()
+	return &Metrics{
+		registry: registry,
+		requests: registry.NewCounter("gwp_http_requests_total",
+			"Number of HTTP requests.", "method", "route", "code"),
+		durations: registry.NewHistogram("gwp_http_request_duration_seconds",
+			"Duration of HTTP requests.", DefaultBuckets, "method", "route", "code"),
+		objectSizes: registry.NewHistogram("gwp_object_size_bytes",
+			"Size of objects put in storage.", sizeBuckets),
+		persistence: registry.NewHistogram("gwp_persistence_duration_seconds",
+			"Duration of loading and saving data.", DefaultBuckets, "operation"),
+		persistenceErrors: registry.NewCounter("gwp_persistence_errors_total",
+			"Number of failed loads and saves of data.", "operation"),
+		closed: make(chan struct{}),
+	}
+}
+
+// Handler returns handler writing metrics in Prometheus text format,
+// to be mounted under Url.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := m.registry.Write(w); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// Middleware counts requests and measures their duration,
+// by method, chi route pattern and response code.
+// Unknown methods and unmatched routes share labels.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		response := logging.Serve(next, w, r)
+
+		route := response.Route
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !methods[method] {
+			method = "other"
+		}
+		labels := []string{method, route, strconv.Itoa(response.Status)}
+		m.requests.Inc(labels...)
+		m.durations.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
+
+// ObserveStorage reports number of objects in storage and their total size.
+func (m *Metrics) ObserveStorage(dataStorage storage.Storage) {
+	m.registry.NewGaugeFunc("gwp_objects", "Number of objects in storage.", func() float64 {
+		objects, _ := storage.Total(dataStorage)
+		return float64(objects)
+	})
+	m.registry.NewGaugeFunc("gwp_objects_bytes", "Total size of objects in storage.", func() float64 {
+		_, bytes := storage.Total(dataStorage)
+		return float64(bytes)
+	})
+}
+
+// WatchObjects observes sizes of objects put in storage after the call,
+// until Close.
+func (m *Metrics) WatchObjects(dataStorage *storage.ObservableStorage) {
+	subscription := dataStorage.Subscribe(storageBuffer)
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		for m.observeSizes(subscription) {
+			// Subscription was closed by a restore or overflow,
+			// observations are lost but a new one can continue.
+			subscription = dataStorage.Subscribe(storageBuffer)
+		}
+	}()
+}
+
+// observeSizes observes events of subscription, until it is
+// closed or Close is called. Returns false in the latter case.
+func (m *Metrics) observeSizes(subscription *storage.Subscription) bool {
+	defer subscription.Close()
+	for {
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return true
+			}
+			if event.Op == storage.OpPut {
+				m.objectSizes.Observe(float64(len(event.Data.Object)))
+			}
+		case <-m.closed:
+			return false
+		}
+	}
+}
+
+// ObservePersistence records a load or save operation,
+// started at start and finished with err.
+func (m *Metrics) ObservePersistence(operation string, start time.Time, err error) {
+	m.persistence.Observe(time.Since(start).Seconds(), operation)
+	if err != nil {
+		m.persistenceErrors.Inc(operation)
+	}
+}
+
+// Close stops observing storages.
+func (m *Metrics) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+	})
+	m.running.Wait()
+}
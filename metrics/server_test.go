@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns lines written by handler of m.
+func scrape(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", Url, nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("wrong response: %v %v", w.Code, w.Header())
+	}
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	defer m.Close()
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	m.ObserveStorage(dataStorage)
+	m.WatchObjects(dataStorage)
+	handler := m.Middleware(router.NewRouter(dataStorage))
+
+	requests := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{"PUT", router.ObjectsUrl + "/key1", "data"},
+		{"PUT", router.ObjectsUrl + "/key2", strings.Repeat("x", 1000)},
+		{"GET", router.ObjectsUrl + "/key1", ""},
+		{"GET", router.ObjectsUrl + "/absent", ""},
+		{"GET", "/absent", ""},
+	}
+	for _, request := range requests {
+		r := httptest.NewRequest(request.method, request.url, bytes.NewBufferString(request.body))
+		r.Header.Set("Content-Type", "type")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	m.ObservePersistence(Load, time.Now(), nil)
+	m.ObservePersistence(Save, time.Now(), errors.New("failed"))
+
+	expected := []string{
+		`gwp_http_requests_total{method="PUT",route="/api/objects/{key}/",code="201"} 2`,
+		`gwp_http_requests_total{method="GET",route="/api/objects/{key}/",code="200"} 1`,
+		`gwp_http_requests_total{method="GET",route="/api/objects/{key}/",code="404"} 1`,
+		`gwp_http_requests_total{method="GET",route="unmatched",code="404"} 1`,
+		`gwp_http_request_duration_seconds_count{method="PUT",route="/api/objects/{key}/",code="201"} 2`,
+		`gwp_objects 2`,
+		`gwp_objects_bytes 1004`,
+		`gwp_object_size_bytes_bucket{le="64"} 1`,
+		`gwp_object_size_bytes_bucket{le="1024"} 2`,
+		`gwp_object_size_bytes_sum 1004`,
+		`gwp_persistence_duration_seconds_count{operation="load"} 1`,
+		`gwp_persistence_duration_seconds_count{operation="save"} 1`,
+		`gwp_persistence_errors_total{operation="save"} 1`,
+	}
+	// Object sizes are observed asynchronously.
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(scrape(t, m), "gwp_object_size_bytes_count 2") {
+		if time.Now().After(deadline) {
+			t.Fatal("object sizes not observed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	output := scrape(t, m)
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing line %s", line)
+		}
+	}
+	if strings.Contains(output, `gwp_persistence_errors_total{operation="load"}`) {
+		t.Error("successful load counted as error")
+	}
+}
+
+func TestWatchObjectsRestore(t *testing.T) {
+	m := New()
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	m.WatchObjects(dataStorage)
+	dataStorage.Restore(map[string]storage.Data{})
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(scrape(t, m), "gwp_object_size_bytes_count") {
+		if time.Now().After(deadline) {
+			t.Fatal("sizes not observed after restore")
+		}
+		// Restore closes the subscription, a new one is started asynchronously.
+		_ = dataStorage.Put("key", []byte{}, "type")
+		time.Sleep(5 * time.Millisecond)
+	}
+	m.Close()
+}
+
+func TestMetricsUnknownMethod(t *testing.T) {
+	m := New()
+	defer m.Close()
+	handler := m.Middleware(router.NewRouter(storage.NewStorage()))
+	for _, method := range []string{"BOGUS1", "BOGUS2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, router.ObjectsUrl+"/key", nil))
+	}
+
+	metrics := scrape(t, m)
+	if strings.Contains(metrics, "BOGUS") {
+		t.Errorf("unknown method used as label:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `gwp_http_requests_total{method="other",`) {
+		t.Errorf("unknown methods not counted:\n%s", metrics)
+	}
+}
@@ -0,0 +1,100 @@
+package namespace
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+)
+
+// Maximal size of a namespace description.
+const maxRequestSize = 100000
+
+// Handler returns handler managing namespaces and their objects,
+// to be mounted under Url. Objects of namespace ns are served
+// under /{ns}/objects like router.ObjectsHandler.
+func (m *Manager) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/", m.getNamespaces)
+	router.Route("/{namespace}", func(router chi.Router) {
+		router.Get("/", m.getNamespace)
+		router.Put("/", m.putNamespace)
+		router.Delete("/", m.deleteNamespace)
+		router.Mount("/objects", http.HandlerFunc(m.serveObjects))
+	})
+	return router
+}
+
+// getNamespaces writes statuses of all namespaces
+// into body in JSON format.
+func (m *Manager) getNamespaces(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJson(w, http.StatusOK, m.List())
+}
+
+// getNamespace writes status of the namespace into body in JSON format.
+// If the namespace does not exist, writes code http.StatusNotFound.
+func (m *Manager) getNamespace(w http.ResponseWriter, r *http.Request) {
+	if status, err := m.Status(chi.URLParam(r, "namespace")); err == nil {
+		apierror.WriteJson(w, http.StatusOK, status)
+	} else {
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, err.Error())
+	}
+}
+
+// putNamespace creates the namespace with quotas from request's body,
+// which may be empty, writing it back with code http.StatusCreated.
+// If the namespace exists, writes code http.StatusConflict.
+// If its name or description is invalid, writes code http.StatusBadRequest.
+func (m *Manager) putNamespace(w http.ResponseWriter, r *http.Request) {
+	var namespace Namespace
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, &namespace)
+	}
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid namespace description: "+err.Error())
+		return
+	}
+	namespace.Name = chi.URLParam(r, "namespace")
+	switch namespace, err := m.Create(r.Context(), namespace); err {
+	case nil:
+		apierror.WriteJson(w, http.StatusCreated, namespace)
+	case InvalidNameError:
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "namespace name must match "+NamePattern)
+	case NamespaceExistsError:
+		apierror.Write(w, r, http.StatusConflict, apierror.Conflict, err.Error())
+	default:
+		panic(err)
+	}
+}
+
+// deleteNamespace removes the namespace with its data,
+// writing code http.StatusNoContent.
+// If the namespace does not exist, writes code http.StatusNotFound.
+// For the default namespace, writes code http.StatusConflict.
+func (m *Manager) deleteNamespace(w http.ResponseWriter, r *http.Request) {
+	switch err := m.Delete(r.Context(), chi.URLParam(r, "namespace")); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case NamespaceAbsentError:
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, err.Error())
+	case DefaultNamespaceError:
+		apierror.Write(w, r, http.StatusConflict, apierror.Conflict, err.Error())
+	default:
+		panic(err)
+	}
+}
+
+// serveObjects passes request to handler of objects in the namespace.
+// If the namespace does not exist, writes code http.StatusNotFound.
+func (m *Manager) serveObjects(w http.ResponseWriter, r *http.Request) {
+	m.mut.RLock()
+	e, ok := m.namespaces[chi.URLParam(r, "namespace")]
+	m.mut.RUnlock()
+	if ok {
+		e.handler.ServeHTTP(w, r)
+	} else {
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, NamespaceAbsentError.Error())
+	}
+}
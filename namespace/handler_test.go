@@ -0,0 +1,66 @@
+package namespace
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	manager, defaultStorage := newManager(t, newMemStore())
+	handler := router.NewRouter(defaultStorage)
+	handler.Mount(Url, manager.Handler())
+
+	dataSets := []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"GET", Url + "/team", "", http.StatusNotFound},
+		{"PUT", Url + "/team/objects/key", "data", http.StatusNotFound},
+		{"PUT", Url + "/team", `{"quotas": [{"prefix": "", "maxBytes": 4}]}`, http.StatusCreated},
+		{"PUT", Url + "/team", "", http.StatusConflict},
+		{"PUT", Url + "/other", "", http.StatusCreated},
+		{"PUT", Url + "/third", "{", http.StatusBadRequest},
+		{"PUT", Url + "/team/objects/key", "data", http.StatusCreated},
+		{"PUT", Url + "/team/objects/big", "data", http.StatusInsufficientStorage},
+		{"GET", Url + "/team/objects/key", "", http.StatusOK},
+		{"GET", Url + "/other/objects/key", "", http.StatusNotFound},
+		{"GET", router.ObjectsUrl + "/key", "", http.StatusNotFound},
+		{"PUT", Url + "/default/objects/key", "data", http.StatusCreated},
+		{"GET", router.ObjectsUrl + "/key", "", http.StatusOK},
+		{"DELETE", Url + "/default", "", http.StatusConflict},
+		{"DELETE", Url + "/other", "", http.StatusNoContent},
+		{"DELETE", Url + "/other", "", http.StatusNotFound},
+		{"GET", Url + "/other/objects", "", http.StatusNotFound},
+	}
+	for _, dataSet := range dataSets {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(dataSet.method, dataSet.url, bytes.NewBufferString(dataSet.body))
+		r.Header.Set("Content-Type", "type")
+		handler.ServeHTTP(w, r)
+		if w.Code != dataSet.code {
+			t.Errorf("wrong code for %v %v: %v", dataSet.method, dataSet.url, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", Url+"/team/objects", nil))
+	var keys []string
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys) != 1 || keys[0] != "key" {
+		t.Errorf("wrong keys: %v %v", keys, err)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", Url, nil))
+	var statuses []Status
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != Default || statuses[1].Name != "team" || statuses[1].Usage[0].Bytes != 4 {
+		t.Errorf("wrong statuses: %+v", statuses)
+	}
+}
@@ -0,0 +1,234 @@
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Url = "/api/namespaces"
+
+	// Default is the namespace of objects under router.ObjectsUrl.
+	Default = "default"
+
+	NamePattern = "^[0-9a-zA-Z]{1,100}$" // pattern describing valid names
+)
+
+const namespacesBucket = "GWP_namespaces"
+
+var (
+	InvalidNameError      = errors.New("invalid namespace name")
+	NamespaceExistsError  = errors.New("namespace already exists")
+	NamespaceAbsentError  = errors.New("namespace does not exist")
+	DefaultNamespaceError = errors.New("default namespace cannot be deleted")
+)
+
+var nameRegex = regexp.MustCompile(NamePattern)
+
+// Store persists namespaces and their data,
+// implemented by persistence.NamespaceStore.
+type Store interface {
+	Load(bucketName string) (map[string][]byte, error)
+	Put(ctx context.Context, bucketName, key string, record []byte) error
+	Delete(ctx context.Context, bucketName, key string) error
+	LoadNamespace(dataStorage storage.Storage, namespace string) error
+	SaveNamespace(dataStorage storage.Storage, namespace string) error
+	DeleteNamespace(ctx context.Context, namespace string) error
+}
+
+// Namespace is a separate key space with its own quotas.
+type Namespace struct {
+	Name    string          `json:"name"`
+	Quotas  []storage.Quota `json:"quotas"`
+	Created time.Time       `json:"created"`
+}
+
+// Status describes a namespace along with usage of its quotas.
+type Status struct {
+	Namespace
+	Usage []storage.Usage `json:"usage"`
+}
+
+type entry struct {
+	namespace Namespace
+	quotas    *storage.QuotaStorage
+	storage   *storage.ObservableStorage
+	handler   http.Handler
+}
+
+// Manager keeps namespaces. Data of the default namespace is kept
+// by the server as before, data of others is loaded at start
+// and saved with Save.
+type Manager struct {
+	store      Store
+	mut        sync.RWMutex
+	namespaces map[string]*entry
+}
+
+// NewManager loads namespaces from store. quotas are the storage
+// of the default namespace.
+func NewManager(store Store, quotas *storage.QuotaStorage, dataStorage *storage.ObservableStorage) (*Manager, error) {
+	m := &Manager{store: store, namespaces: make(map[string]*entry)}
+	m.namespaces[Default] = &entry{
+		namespace: Namespace{Name: Default},
+		quotas:    quotas,
+		storage:   dataStorage,
+		handler:   router.ObjectsHandler(dataStorage),
+	}
+	records, err := store.Load(namespacesBucket)
+	if err != nil {
+		return nil, err
+	}
+	for name, record := range records {
+		var namespace Namespace
+		if err := json.Unmarshal(record, &namespace); err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", name, err)
+		}
+		e := newEntry(namespace)
+		if err := store.LoadNamespace(e.storage, name); err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", name, err)
+		}
+		// Set after loading, so that saved data
+		// over quotas is not lost.
+		e.quotas.SetQuotas(namespace.Quotas)
+		m.namespaces[name] = e
+	}
+	return m, nil
+}
+
+func newEntry(namespace Namespace) *entry {
+	quotas := storage.NewQuotaStorage(storage.NewStorage())
+	dataStorage := storage.NewObservableStorage(quotas)
+	return &entry{
+		namespace: namespace,
+		quotas:    quotas,
+		storage:   dataStorage,
+		handler:   router.ObjectsHandler(dataStorage),
+	}
+}
+
+// Create adds an empty namespace, returning it with Created set.
+func (m *Manager) Create(ctx context.Context, namespace Namespace) (Namespace, error) {
+	if !nameRegex.MatchString(namespace.Name) {
+		return Namespace{}, InvalidNameError
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.namespaces[namespace.Name]; ok {
+		return Namespace{}, NamespaceExistsError
+	}
+	namespace.Created = time.Now().UTC()
+	if namespace.Quotas == nil {
+		namespace.Quotas = make([]storage.Quota, 0)
+	}
+	record, err := json.Marshal(namespace)
+	if err != nil {
+		return Namespace{}, err
+	}
+	if err := m.store.Put(ctx, namespacesBucket, namespace.Name, record); err != nil {
+		return Namespace{}, err
+	}
+	e := newEntry(namespace)
+	e.quotas.SetQuotas(namespace.Quotas)
+	m.namespaces[namespace.Name] = e
+	return namespace, nil
+}
+
+// Delete removes namespace along with its data.
+func (m *Manager) Delete(ctx context.Context, name string) error {
+	if name == Default {
+		return DefaultNamespaceError
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.namespaces[name]; !ok {
+		return NamespaceAbsentError
+	}
+	// Data is deleted first, so that a failure
+	// cannot leave it behind without the namespace.
+	if err := m.store.DeleteNamespace(ctx, name); err != nil {
+		return err
+	}
+	if err := m.store.Delete(ctx, namespacesBucket, name); err != nil {
+		return err
+	}
+	delete(m.namespaces, name)
+	return nil
+}
+
+// Status returns status of namespace.
+func (m *Manager) Status(name string) (Status, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	if e, ok := m.namespaces[name]; ok {
+		return e.status(), nil
+	}
+	return Status{}, NamespaceAbsentError
+}
+
+// List returns statuses of all namespaces, sorted by name.
+func (m *Manager) List() []Status {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	statuses := make([]Status, 0, len(m.namespaces))
+	for _, e := range m.namespaces {
+		statuses = append(statuses, e.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Storage returns storage of namespace.
+func (m *Manager) Storage(name string) (*storage.ObservableStorage, bool) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	if e, ok := m.namespaces[name]; ok {
+		return e.storage, true
+	}
+	return nil, false
+}
+
+// Save saves data of all namespaces other than the default one.
+// A namespace failing to save does not stop others from being saved.
+func (m *Manager) Save() error {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	var failures []string
+	for name, e := range m.namespaces {
+		if name == Default {
+			continue
+		}
+		if err := m.store.SaveNamespace(e.storage, name); err != nil {
+			failures = append(failures, fmt.Sprintf("namespace %s: %v", name, err))
+		}
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (e *entry) status() Status {
+	namespace := e.namespace
+	if namespace.Name == Default {
+		// Quotas of the default namespace come from configuration.
+		namespace.Quotas = make([]storage.Quota, 0)
+		for _, usage := range e.quotas.Usage() {
+			namespace.Quotas = append(namespace.Quotas, usage.Quota)
+		}
+	}
+	return Status{Namespace: namespace, Usage: e.quotas.Usage()}
+}
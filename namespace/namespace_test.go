@@ -0,0 +1,207 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// memStore is a Store keeping records and data in memory.
+type memStore struct {
+	mut     sync.Mutex
+	buckets map[string]map[string][]byte
+	data    map[string]map[string]storage.Data
+	failing map[string]bool // namespaces failing to be saved or deleted
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		buckets: make(map[string]map[string][]byte),
+		data:    make(map[string]map[string]storage.Data),
+		failing: make(map[string]bool),
+	}
+}
+
+func (m *memStore) Load(bucketName string) (map[string][]byte, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	records := make(map[string][]byte)
+	for key, record := range m.buckets[bucketName] {
+		records[key] = record
+	}
+	return records, nil
+}
+
+func (m *memStore) Put(_ context.Context, bucketName, key string, record []byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.buckets[bucketName] == nil {
+		m.buckets[bucketName] = make(map[string][]byte)
+	}
+	m.buckets[bucketName][key] = record
+	return nil
+}
+
+func (m *memStore) Delete(_ context.Context, bucketName, key string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.buckets[bucketName], key)
+	return nil
+}
+
+func (m *memStore) LoadNamespace(dataStorage storage.Storage, namespace string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	for key, data := range m.data[namespace] {
+		if err := dataStorage.Put(key, data.Object, data.ContentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var storeError = errors.New("store failed")
+
+func (m *memStore) SaveNamespace(dataStorage storage.Storage, namespace string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.failing[namespace] {
+		return storeError
+	}
+	m.data[namespace] = make(map[string]storage.Data)
+	for _, key := range dataStorage.Keys() {
+		if data, err := dataStorage.Get(key); err == nil {
+			m.data[namespace][key] = data
+		}
+	}
+	return nil
+}
+
+func (m *memStore) DeleteNamespace(_ context.Context, namespace string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.failing[namespace] {
+		return storeError
+	}
+	delete(m.data, namespace)
+	return nil
+}
+
+func newManager(t *testing.T, store Store) (*Manager, *storage.ObservableStorage) {
+	quotas := storage.NewQuotaStorage(storage.NewStorage())
+	dataStorage := storage.NewObservableStorage(quotas)
+	manager, err := NewManager(store, quotas, dataStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager, dataStorage
+}
+
+func TestManager(t *testing.T) {
+	store := newMemStore()
+	manager, defaultStorage := newManager(t, store)
+	if s, ok := manager.Storage(Default); !ok || s != defaultStorage {
+		t.Error("wrong default storage")
+	}
+
+	quotas := []storage.Quota{{Prefix: "", MaxObjects: 1}}
+	if _, err := manager.Create(context.Background(), Namespace{Name: "team", Quotas: quotas}); err != nil {
+		t.Fatal(err)
+	}
+	dataSets := []struct {
+		name string
+		err  error
+	}{
+		{"team", NamespaceExistsError},
+		{Default, NamespaceExistsError},
+		{"", InvalidNameError},
+		{"a/b", InvalidNameError},
+	}
+	for _, dataSet := range dataSets {
+		if _, err := manager.Create(context.Background(), Namespace{Name: dataSet.name}); err != dataSet.err {
+			t.Errorf("wrong error for %q: %v", dataSet.name, err)
+		}
+	}
+
+	team, ok := manager.Storage("team")
+	if !ok {
+		t.Fatal("namespace absent")
+	}
+	if err := team.Put("key", []byte{1}, "type"); err != nil {
+		t.Fatal(err)
+	}
+	if err := team.Put("other", []byte{1}, "type"); err != storage.QuotaExceededError {
+		t.Errorf("quota not enforced: %v", err)
+	}
+	if _, err := defaultStorage.Get("key"); err != storage.KeyAbsentError {
+		t.Error("namespaces share keys")
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, _ := newManager(t, store)
+	status, err := reloaded.Status("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status.Quotas, quotas) || !reflect.DeepEqual(status.Usage, []storage.Usage{{Quota: quotas[0], Bytes: 1, Objects: 1}}) {
+		t.Errorf("wrong status after reload: %+v", status)
+	}
+	if names := len(reloaded.List()); names != 2 {
+		t.Errorf("wrong number of namespaces: %v", names)
+	}
+
+	if err := reloaded.Delete(context.Background(), Default); err != DefaultNamespaceError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := reloaded.Delete(context.Background(), "team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Delete(context.Background(), "team"); err != NamespaceAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, ok := store.data["team"]; ok {
+		t.Error("data of deleted namespace kept")
+	}
+	if reloaded, _ := newManager(t, store); len(reloaded.List()) != 1 {
+		t.Error("deleted namespace loaded")
+	}
+}
+
+func TestManager_Failures(t *testing.T) {
+	store := newMemStore()
+	manager, _ := newManager(t, store)
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := manager.Create(context.Background(), Namespace{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		namespaceStorage, _ := manager.Storage(name)
+		namespaceStorage.Put("key", []byte{1}, "type")
+	}
+	store.failing["b"] = true
+
+	// Other namespaces are saved despite the failure.
+	if err := manager.Save(); err == nil {
+		t.Error("failure not reported")
+	}
+	for _, name := range []string{"a", "c"} {
+		if len(store.data[name]) != 1 {
+			t.Errorf("namespace %s not saved", name)
+		}
+	}
+
+	// Namespace failing to be deleted is kept.
+	if err := manager.Delete(context.Background(), "b"); err != storeError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, err := manager.Status("b"); err != nil {
+		t.Errorf("namespace removed: %v", err)
+	}
+	if reloaded, _ := newManager(t, store); len(reloaded.List()) != 4 {
+		t.Error("namespace record removed")
+	}
+}
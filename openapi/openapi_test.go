@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Id string `json:"id"`
+}
+
+type testValue struct {
+	inner
+	Name     string            `json:"name"`
+	Count    int32             `json:"count,omitempty"`
+	Created  time.Time         `json:"created"`
+	Data     []byte            `json:"data,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Inner    *inner            `json:"inner,omitempty"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+func TestSchemas(t *testing.T) {
+	s := newSchemas()
+	s.register("Inner", inner{})
+	s.register("Value", testValue{})
+	s.omit("Value", "name")
+
+	expected := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":      {Type: "string"},
+			"count":   {Type: "integer", Format: "int32"},
+			"created": {Type: "string", Format: "date-time"},
+			"data":    {Type: "string", Format: "byte"},
+			"tags":    {Type: "array", Items: &Schema{Type: "string"}},
+			"labels":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+			"inner":   ref("Inner"),
+		},
+		Required: []string{"id", "created", "tags"},
+	}
+	if actual := s.components["Value"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected schema %+v, got %+v", expected, actual)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	document := &Document{OpenAPI: "3.0.3", Info: Info{Title: "test", Version: "1"}}
+	w := httptest.NewRecorder()
+	Handler(document).ServeHTTP(w, httptest.NewRequest(http.MethodGet, Url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected code %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected JSON content type, got %q", contentType)
+	}
+	var decoded Document
+	if err := json.NewDecoder(w.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Info, document.Info) {
+		t.Errorf("expected info %+v, got %+v", document.Info, decoded.Info)
+	}
+}
+
+func TestSpecPublicOperations(t *testing.T) {
+	body, err := json.Marshal(Spec("test").Paths["/healthz"]["get"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"security":[]`) {
+		t.Errorf("expected empty security, got %s", body)
+	}
+}
+
+// refs calls fn with names of component schemas referred to by schema.
+func refs(schema *Schema, fn func(string)) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref != "" {
+		fn(strings.TrimPrefix(schema.Ref, "#/components/schemas/"))
+	}
+	refs(schema.Items, fn)
+	refs(schema.AdditionalProperties, fn)
+	for _, property := range schema.Properties {
+		refs(property, fn)
+	}
+	for _, option := range schema.OneOf {
+		refs(option, fn)
+	}
+}
+
+func TestSpecConsistent(t *testing.T) {
+	spec := Spec("test")
+	check := func(where string, schema *Schema) {
+		refs(schema, func(name string) {
+			if spec.Components.Schemas[name] == nil {
+				t.Errorf("%s: unknown schema %q", where, name)
+			}
+		})
+	}
+	for name, schema := range spec.Components.Schemas {
+		check(name, schema)
+	}
+
+	templateParameter := regexp.MustCompile(`{([^}]+)}`)
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			where := method + " " + path
+			declared := make(map[string]bool)
+			for _, parameter := range op.Parameters {
+				check(where, parameter.Schema)
+				if parameter.In == "path" {
+					declared[parameter.Name] = true
+				}
+			}
+			for _, match := range templateParameter.FindAllStringSubmatch(path, -1) {
+				if !declared[match[1]] {
+					t.Errorf("%s: path parameter %q not declared", where, match[1])
+				}
+			}
+			if op.RequestBody != nil {
+				for _, mediaType := range op.RequestBody.Content {
+					check(where, mediaType.Schema)
+				}
+			}
+			if len(op.Responses) == 0 {
+				t.Errorf("%s: no responses", where)
+			}
+			for _, response := range op.Responses {
+				for _, mediaType := range response.Content {
+					check(where, mediaType.Schema)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/health"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/limit"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/metrics"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/partition"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/replication"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/socket"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/webhook"
+)
+
+// Error codes of apierror, in order of the documentation.
+var errorCodes = []string{
+	apierror.BadRequest, apierror.InvalidKey, apierror.MissingContentType, apierror.ObjectTooLarge,
+	apierror.Unauthorized, apierror.Forbidden, apierror.NotFound, apierror.KeyNotFound,
+	apierror.MethodNotAllowed, apierror.Conflict, apierror.RateLimited, apierror.QuotaExceeded,
+	apierror.Internal, apierror.BadGateway, apierror.Unavailable,
+}
+
+// public is security of operations not requiring authentication.
+var public = &[]map[string][]string{}
+
+// clusterSecret is security of operations used by cluster nodes.
+var clusterSecret = &[]map[string][]string{{"clusterSecret": {}}}
+
+// Spec returns document describing HTTP API of the server with version.
+// Parameters are described with the patterns and limits used
+// by handlers to validate them.
+func Spec(version string) *Document {
+	s := newSchemas()
+	s.override(storage.Op(""), &Schema{Type: "string", Enum: []string{string(storage.OpPut), string(storage.OpDelete), string(storage.OpCreate), string(storage.OpUpdate)}})
+	s.override(auth.Permission(""), &Schema{Type: "string", Enum: []string{string(auth.Read), string(auth.Write), string(auth.Delete)}})
+
+	s.register("Error", apierror.Error{})
+	s.components["Error"].Properties["code"].Enum = errorCodes
+	s.register("ErrorEnvelope", apierror.Envelope{})
+	s.register("Problem", apierror.Problem{})
+	s.components["Problem"].Properties["code"].Enum = errorCodes
+	s.register("Event", events.Event{})
+	s.register("Quota", storage.Quota{})
+	s.register("Usage", storage.Usage{})
+	s.register("Namespace", namespace.Namespace{})
+	s.register("NamespaceStatus", namespace.Status{})
+	s.register("Grant", auth.Grant{})
+	s.register("Credential", auth.Credential{})
+	// Hashes are never returned.
+	s.omit("Credential", "hash")
+	s.register("KeyRequest", auth.KeyRequest{})
+	s.register("CreatedKey", auth.CreatedKey{})
+	s.omit("CreatedKey", "hash")
+	s.register("Hook", webhook.Hook{})
+	s.register("DeadLetter", webhook.DeadLetter{})
+	s.register("ClusterInfo", partition.Info{})
+	s.register("Membership", partition.Membership{})
+	s.register("Migration", partition.Migration{})
+	s.register("ReplicaStatus", replication.ReplicaStatus{})
+	s.register("LeaderStatus", replication.LeaderStatus{})
+	s.register("FollowerStatus", replication.FollowerStatus{})
+	s.register("Result", health.Result{})
+	s.register("Status", health.Status{})
+	s.register("Readiness", struct {
+		Ready  bool              `json:"ready"`
+		Checks map[string]string `json:"checks"`
+	}{})
+
+	d := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "GWP",
+			Version: version,
+			Description: "Key-value store over HTTP. Authentication is required only if the server " +
+				"is started with it, by API keys or JWTs in the Authorization header, or by client certificates.",
+		},
+		Tags: []Tag{
+			{"objects", "Objects of the default namespace"},
+			{"namespaces", "Separate key spaces with their own quotas"},
+			{"events", "Notifications about changes of objects"},
+			{"admin", "Backup, restore, keys, webhooks and quotas"},
+			{"cluster", "Replication and partitioned cluster"},
+			{"server", "Health, status, metrics and this document"},
+			{"internal", "Used by cluster nodes to talk to each other"},
+		},
+		Paths: make(map[string]PathItem),
+		Components: Components{
+			Schemas: s.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer":        {Type: "http", Scheme: "bearer", Description: "API key or JWT"},
+				"clusterSecret": {Type: "apiKey", In: "header", Name: partition.SecretHeader, Description: "Secret shared by cluster nodes"},
+			},
+		},
+		Security: []map[string][]string{{"bearer": {}}},
+	}
+
+	objectPaths(d, router.ObjectsUrl, "objects", "", nil)
+	namespacePaths(d)
+	adminPaths(d)
+	eventPaths(d)
+	clusterPaths(d)
+	serverPaths(d)
+
+	// Authentication and rate limiting apply to all protected operations.
+	for _, item := range d.Paths {
+		for _, op := range item {
+			if op.Security == nil {
+				op.Responses["401"] = errorResponse("Missing or invalid credentials.")
+				op.Responses["403"] = errorResponse("Operation not allowed for the identity.")
+				op.Responses["429"] = errorResponse("Too many requests, retry after time in Retry-After header.")
+			}
+		}
+	}
+	return d
+}
+
+func (d *Document) add(path, method string, op *Operation) {
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(PathItem)
+	}
+	d.Paths[path][method] = op
+}
+
+func errorResponse(description string) Response {
+	return Response{Description: description, Content: map[string]MediaType{
+		"application/json":        {ref("ErrorEnvelope")},
+		apierror.ProblemMediaType: {ref("Problem")},
+	}}
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return Response{Description: description, Content: map[string]MediaType{"application/json": {schema}}}
+}
+
+func jsonBody(description string, schema *Schema) *RequestBody {
+	return &RequestBody{Description: description, Required: true, Content: map[string]MediaType{"application/json": {schema}}}
+}
+
+func noContent(description string) Response {
+	return Response{Description: description}
+}
+
+func pathParameter(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
+
+func stringArray() *Schema {
+	return &Schema{Type: "array", Items: &Schema{Type: "string"}}
+}
+
+// objectPaths adds operations on objects under url, with operation
+// IDs prefixed with idPrefix and parameters preceding the key.
+func objectPaths(d *Document, url, tag, idPrefix string, parameters []Parameter) {
+	id := func(name string) string {
+		if idPrefix == "" {
+			return name
+		}
+		return idPrefix + string(name[0]-'a'+'A') + name[1:]
+	}
+	key := pathParameter("key", "Key of the object.", &Schema{Type: "string", Pattern: router.KeyPattern})
+	withKey := append(append([]Parameter{}, parameters...), key)
+	versionHeader := map[string]Header{router.VersionHeader: {
+		Description: "Version of the key, the sequence number of its last mutation.",
+		Schema:      &Schema{Type: "integer", Format: "int64"},
+	}}
+	storageErrors := func(responses map[string]Response) map[string]Response {
+		responses["503"] = errorResponse("Storage unavailable, e.g. on a Raft member which is not the leader.")
+		return responses
+	}
+
+	d.add(url, "get", &Operation{
+		Tags: []string{tag}, Summary: "List keys", OperationId: id("listKeys"),
+		Parameters: parameters,
+		Responses: map[string]Response{
+			"200": jsonResponse("Keys of all objects.", stringArray()),
+		},
+	})
+	d.add(url+"/{key}", "get", &Operation{
+		Tags: []string{tag}, Summary: "Get object", OperationId: id("getObject"),
+		Description: "Returns the object with its content type. With wait parameter, blocks until " +
+			"the key changes after version given in after parameter, or the current one, " +
+			fmt.Sprintf("or until wait elapses. Wait is limited to %s.", router.MaxWait),
+		Parameters: append(withKey,
+			Parameter{Name: "wait", In: "query", Description: "Maximal time to wait for a change, e.g. 30s.", Schema: &Schema{Type: "string"}},
+			Parameter{Name: "after", In: "query", Description: "Version to wait for a change after.", Schema: &Schema{Type: "integer", Format: "int64"}},
+		),
+		Responses: storageErrors(map[string]Response{
+			"200": {Description: "The object.", Headers: versionHeader, Content: map[string]MediaType{
+				"*/*": {&Schema{Type: "string", Format: "binary"}},
+			}},
+			"400": errorResponse("Invalid key, wait or after parameter."),
+			"404": errorResponse("No object under the key."),
+		}),
+	})
+	d.add(url+"/{key}", "put", &Operation{
+		Tags: []string{tag}, Summary: "Put object", OperationId: id("putObject"),
+		Description: "Stores request's body under the key, along with its Content-Type header, which is required.",
+		Parameters:  withKey,
+		RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+			"*/*": {&Schema{Type: "string", Format: "binary", MaxLength: router.MaxObjectSize}},
+		}},
+		Responses: storageErrors(map[string]Response{
+			"201": noContent("Object stored."),
+			"400": errorResponse("Invalid key or missing Content-Type header."),
+			"413": errorResponse(fmt.Sprintf("Object larger than %d bytes.", router.MaxObjectSize)),
+			"507": errorResponse("Storage quota exceeded."),
+		}),
+	})
+	d.add(url+"/{key}", "delete", &Operation{
+		Tags: []string{tag}, Summary: "Delete object", OperationId: id("deleteObject"),
+		Parameters: withKey,
+		Responses: storageErrors(map[string]Response{
+			"204": noContent("Object deleted."),
+			"400": errorResponse("Invalid key."),
+			"404": errorResponse("No object under the key."),
+		}),
+	})
+}
+
+func namespacePaths(d *Document) {
+	url := namespace.Url + "/{namespace}"
+	name := pathParameter("namespace", "Name of the namespace.", &Schema{Type: "string", Pattern: namespace.NamePattern})
+	tags := []string{"namespaces"}
+
+	d.add(namespace.Url, "get", &Operation{
+		Tags: tags, Summary: "List namespaces", OperationId: "listNamespaces",
+		Responses: map[string]Response{
+			"200": jsonResponse("Namespaces with usage of their quotas, sorted by name.",
+				&Schema{Type: "array", Items: ref("NamespaceStatus")}),
+		},
+	})
+	d.add(url, "get", &Operation{
+		Tags: tags, Summary: "Get namespace", OperationId: "getNamespace",
+		Parameters: []Parameter{name},
+		Responses: map[string]Response{
+			"200": jsonResponse("The namespace with usage of its quotas.", ref("NamespaceStatus")),
+			"404": errorResponse("No such namespace."),
+		},
+	})
+	d.add(url, "put", &Operation{
+		Tags: tags, Summary: "Create namespace", OperationId: "createNamespace",
+		Parameters: []Parameter{name},
+		RequestBody: &RequestBody{Description: "Quotas of the namespace, body may be empty.", Content: map[string]MediaType{
+			"application/json": {&Schema{Type: "object", Properties: map[string]*Schema{
+				"quotas": {Type: "array", Items: ref("Quota")},
+			}}},
+		}},
+		Responses: map[string]Response{
+			"201": jsonResponse("Namespace created.", ref("Namespace")),
+			"400": errorResponse("Invalid name or description."),
+			"409": errorResponse("Namespace already exists."),
+		},
+	})
+	d.add(url, "delete", &Operation{
+		Tags: tags, Summary: "Delete namespace", OperationId: "deleteNamespace",
+		Description: "Deletes the namespace along with its objects.",
+		Parameters:  []Parameter{name},
+		Responses: map[string]Response{
+			"204": noContent("Namespace deleted."),
+			"404": errorResponse("No such namespace."),
+			"409": errorResponse("The default namespace cannot be deleted."),
+		},
+	})
+	objectPaths(d, url+"/objects", "namespaces", "namespace", []Parameter{name})
+	for _, op := range []*Operation{d.Paths[url+"/objects"]["get"], d.Paths[url+"/objects/{key}"]["get"]} {
+		op.Responses["404"] = errorResponse("No such namespace or object.")
+	}
+}
+
+func adminPaths(d *Document) {
+	tags := []string{"admin"}
+	archive := map[string]MediaType{router.SnapshotMediaType: {&Schema{
+		Type:        "string",
+		Description: "JSON lines holding key, contentType and base64 encoded object.",
+	}}}
+	id := pathParameter("id", "", &Schema{Type: "string"})
+
+	d.add(router.AdminUrl+"/backup", "get", &Operation{
+		Tags: tags, Summary: "Back up objects", OperationId: "backup",
+		Responses: map[string]Response{
+			"200": {Description: "Point in time snapshot of the default namespace.", Content: archive},
+		},
+	})
+	d.add(router.AdminUrl+"/restore", "post", &Operation{
+		Tags: tags, Summary: "Restore objects", OperationId: "restore",
+		Description: "Replaces objects of the default namespace with the snapshot, if it is valid.",
+		RequestBody: &RequestBody{Required: true, Content: archive},
+		Responses: map[string]Response{
+			"204": noContent("Objects replaced."),
+			"400": errorResponse("Invalid snapshot, objects left unchanged."),
+			"413": errorResponse("Snapshot too large, objects left unchanged."),
+		},
+	})
+
+	d.add(auth.Url+"/keys", "get", &Operation{
+		Tags: tags, Summary: "List API keys", OperationId: "listCredentials",
+		Responses: map[string]Response{
+			"200": jsonResponse("Credentials of API keys, oldest first.", &Schema{Type: "array", Items: ref("Credential")}),
+		},
+	})
+	d.add(auth.Url+"/keys", "post", &Operation{
+		Tags: tags, Summary: "Create API key", OperationId: "createKey",
+		RequestBody: jsonBody("", ref("KeyRequest")),
+		Responses: map[string]Response{
+			"201": jsonResponse("The key along with its credential. Key is not available later.", ref("CreatedKey")),
+			"400": errorResponse("Invalid description."),
+		},
+	})
+	d.add(auth.Url+"/keys/{id}", "delete", &Operation{
+		Tags: tags, Summary: "Revoke API key", OperationId: "revokeKey",
+		Parameters: []Parameter{id},
+		Responses: map[string]Response{
+			"204": noContent("Key revoked."),
+			"404": errorResponse("No such key."),
+		},
+	})
+
+	d.add(webhook.Url, "get", &Operation{
+		Tags: tags, Summary: "List webhooks", OperationId: "listHooks",
+		Responses: map[string]Response{
+			"200": jsonResponse("Webhooks without secrets.", &Schema{Type: "array", Items: ref("Hook")}),
+		},
+	})
+	d.add(webhook.Url, "post", &Operation{
+		Tags: tags, Summary: "Register webhook", OperationId: "registerHook",
+		Description: "Registers a webhook receiving events of keys with prefix. Id is generated, and so is secret if not given.",
+		RequestBody: jsonBody("", ref("Hook")),
+		Responses: map[string]Response{
+			"201": jsonResponse("Webhook with its id and secret.", ref("Hook")),
+			"400": errorResponse("Invalid description."),
+		},
+	})
+	d.add(webhook.Url+"/{id}", "delete", &Operation{
+		Tags: tags, Summary: "Unregister webhook", OperationId: "unregisterHook",
+		Parameters: []Parameter{id},
+		Responses: map[string]Response{
+			"204": noContent("Webhook unregistered."),
+			"404": errorResponse("No such webhook."),
+		},
+	})
+	d.add(webhook.Url+"/deadletters", "get", &Operation{
+		Tags: tags, Summary: "List dead letters", OperationId: "listDeadLetters",
+		Responses: map[string]Response{
+			"200": jsonResponse("Failed deliveries, oldest first.", &Schema{Type: "array", Items: ref("DeadLetter")}),
+		},
+	})
+	d.add(webhook.Url+"/deadletters/{id}", "delete", &Operation{
+		Tags: tags, Summary: "Discard dead letter", OperationId: "discardDeadLetter",
+		Parameters: []Parameter{id},
+		Responses: map[string]Response{
+			"204": noContent("Dead letter discarded."),
+			"404": errorResponse("No such dead letter."),
+		},
+	})
+
+	d.add(limit.Url, "get", &Operation{
+		Tags: tags, Summary: "Get quota usage", OperationId: "getUsage",
+		Responses: map[string]Response{
+			"200": jsonResponse("Usage of quotas of the default namespace.", &Schema{Type: "array", Items: ref("Usage")}),
+		},
+	})
+}
+
+func eventPaths(d *Document) {
+	tags := []string{"events"}
+	d.add(events.Url, "get", &Operation{
+		Tags: tags, Summary: "Stream events", OperationId: "streamEvents",
+		Description: "Server-Sent Events of puts and deletes, with Event as data and its version as ID. " +
+			"Reconnecting clients receive missed events, or a reset event if they are no longer available.",
+		Parameters: []Parameter{
+			{Name: "prefix", In: "query", Description: "Prefix of reported keys.", Schema: &Schema{Type: "string"}},
+			{Name: "Last-Event-ID", In: "header", Description: "ID of the last received event.", Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]Response{
+			"200": {Description: "Stream of events.", Content: map[string]MediaType{"text/event-stream": {&Schema{Type: "string"}}}},
+		},
+	})
+	d.add(socket.Url, "get", &Operation{
+		Tags: tags, Summary: "Open WebSocket", OperationId: "openSocket",
+		Description: "WebSocket connection for subscribing to changes and accessing objects with JSON messages.",
+		Responses: map[string]Response{
+			"101": noContent("Switched to WebSocket protocol."),
+		},
+	})
+}
+
+func clusterPaths(d *Document) {
+	tags := []string{"cluster"}
+	internal := []string{"internal"}
+	d.add(replication.Url+replication.StatusPath, "get", &Operation{
+		Tags: tags, Summary: "Get replication status", OperationId: "getReplicationStatus",
+		Responses: map[string]Response{
+			"200": jsonResponse("Status of the leader or the follower.",
+				&Schema{OneOf: []*Schema{ref("LeaderStatus"), ref("FollowerStatus")}}),
+		},
+	})
+	d.add(replication.Url+replication.StreamPath, "get", &Operation{
+		Tags: internal, Summary: "Stream mutations to follower", OperationId: "streamReplication",
+		Responses: map[string]Response{
+			"200": {Description: "Snapshot followed by mutations, as JSON lines.", Content: map[string]MediaType{
+				"application/x-ndjson": {&Schema{Type: "string"}},
+			}},
+		},
+	})
+
+	d.add(partition.Url, "get", &Operation{
+		Tags: tags, Summary: "Get cluster", OperationId: "getCluster",
+		Responses: map[string]Response{
+			"200": jsonResponse("Ring membership from the point of view of the node.", ref("ClusterInfo")),
+		},
+	})
+	d.add(partition.Url+"/nodes", "post", &Operation{
+		Tags: tags, Summary: "Add node", OperationId: "addNode", Security: clusterSecret,
+		RequestBody: jsonBody("", &Schema{Type: "object", Required: []string{"address"}, Properties: map[string]*Schema{
+			"address": {Type: "string", Description: "Base URL of the node."},
+		}}),
+		Responses: map[string]Response{
+			"204": noContent("Node added."),
+			"400": errorResponse("Missing address."),
+			"401": errorResponse("Missing or invalid cluster secret."),
+			"502": errorResponse("Cluster nodes unreachable."),
+		},
+	})
+	d.add(partition.Url+"/nodes", "delete", &Operation{
+		Tags: tags, Summary: "Remove node", OperationId: "removeNode", Security: clusterSecret,
+		Parameters: []Parameter{
+			{Name: "address", In: "query", Description: "Base URL of the node.", Required: true, Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]Response{
+			"204": noContent("Node removed."),
+			"400": errorResponse("Missing address."),
+			"401": errorResponse("Missing or invalid cluster secret."),
+			"502": errorResponse("Cluster nodes unreachable."),
+		},
+	})
+	d.add(partition.Url+"/membership", "put", &Operation{
+		Tags: internal, Summary: "Accept membership", OperationId: "putMembership", Security: clusterSecret,
+		RequestBody: jsonBody("", ref("Membership")),
+		Responses: map[string]Response{
+			"204": noContent("Membership accepted."),
+			"400": errorResponse("Invalid membership."),
+			"401": errorResponse("Missing or invalid cluster secret."),
+			"409": errorResponse("Membership not newer than the known one."),
+		},
+	})
+	d.add(partition.Url+"/migrate", "post", &Operation{
+		Tags: internal, Summary: "Accept migrated objects", OperationId: "migrate", Security: clusterSecret,
+		RequestBody: jsonBody("", ref("Migration")),
+		Responses: map[string]Response{
+			"204": noContent("Objects stored, except for those written on the node since membership changed."),
+			"400": errorResponse("Invalid migration."),
+			"401": errorResponse("Missing or invalid cluster secret."),
+			"409": errorResponse("Migration made with other membership or after migration window."),
+			"503": errorResponse("Objects could not be stored."),
+		},
+	})
+}
+
+func serverPaths(d *Document) {
+	tags := []string{"server"}
+	readiness := jsonResponse("Results of readiness checks.", ref("Readiness"))
+	notReady := readiness
+	notReady.Description = "Server not ready. " + readiness.Description
+	d.add(health.HealthUrl, "get", &Operation{
+		Tags: tags, Summary: "Check liveness", OperationId: "checkHealth",
+		Security: public,
+		Responses: map[string]Response{
+			"200": {Description: "Process is running.", Content: map[string]MediaType{"text/plain": {&Schema{Type: "string"}}}},
+		},
+	})
+	d.add(health.ReadyUrl, "get", &Operation{
+		Tags: tags, Summary: "Check readiness", OperationId: "checkReady",
+		Security: public,
+		Responses: map[string]Response{
+			"200": readiness,
+			"503": notReady,
+		},
+	})
+	d.add(health.StatusUrl, "get", &Operation{
+		Tags: tags, Summary: "Get status", OperationId: "getStatus",
+		Responses: map[string]Response{
+			"200": jsonResponse("Status of the server.", ref("Status")),
+		},
+	})
+	d.add(metrics.Url, "get", &Operation{
+		Tags: tags, Summary: "Get metrics", OperationId: "getMetrics",
+		Responses: map[string]Response{
+			"200": {Description: "Metrics in Prometheus text format.", Content: map[string]MediaType{"text/plain": {&Schema{Type: "string"}}}},
+		},
+	})
+	d.add(Url, "get", &Operation{
+		Tags: tags, Summary: "Get API description", OperationId: "getOpenAPI",
+		Responses: map[string]Response{
+			"200": jsonResponse("This document.", &Schema{Type: "object"}),
+		},
+	})
+
+	// Every response carries ID of the request.
+	requestId := Header{Description: "ID of the request, taken from the request if valid.", Schema: &Schema{Type: "string"}}
+	for _, item := range d.Paths {
+		for _, op := range item {
+			for code, response := range op.Responses {
+				if response.Headers == nil {
+					response.Headers = make(map[string]Header)
+				}
+				response.Headers[logging.RequestIdHeader] = requestId
+				op.Responses[code] = response
+			}
+		}
+	}
+}
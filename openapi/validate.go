@@ -0,0 +1,176 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// templateParameter matches parameters of path templates.
+var templateParameter = regexp.MustCompile(`{([^}]+)}`)
+
+// route matches request paths to operations of a path template.
+type route struct {
+	regex *regexp.Regexp
+	// names of path parameters, in order of regex groups.
+	names []string
+	item  PathItem
+}
+
+// Validate returns middleware checking parameters of requests against
+// operations of document. Path, query and header parameters must match
+// their schemas and required ones must be present. Invalid requests get
+// code http.StatusBadRequest with code apierror.BadRequest, or
+// apierror.InvalidKey for invalid keys, like handlers write.
+// Requests of paths and methods absent from document are passed
+// to next, which answers them. Bodies are not validated.
+func Validate(document *Document) func(http.Handler) http.Handler {
+	var routes []route
+	patterns := make(map[string]*regexp.Regexp)
+	for path, item := range document.Paths {
+		for _, op := range item {
+			for _, parameter := range op.Parameters {
+				if parameter.Schema != nil && parameter.Schema.Pattern != "" {
+					patterns[parameter.Schema.Pattern] = regexp.MustCompile(parameter.Schema.Pattern)
+				}
+			}
+		}
+		names := []string{}
+		pattern := "^"
+		last := 0
+		for _, match := range templateParameter.FindAllStringSubmatchIndex(path, -1) {
+			pattern += regexp.QuoteMeta(path[last:match[0]]) + "([^/]+)"
+			names = append(names, path[match[2]:match[3]])
+			last = match[1]
+		}
+		pattern += regexp.QuoteMeta(path[last:]) + "$"
+		routes = append(routes, route{regexp.MustCompile(pattern), names, item})
+	}
+	// Literal segments take precedence over parameters.
+	sort.Slice(routes, func(i, j int) bool {
+		if len(routes[i].names) != len(routes[j].names) {
+			return len(routes[i].names) < len(routes[j].names)
+		}
+		return routes[i].regex.String() < routes[j].regex.String()
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if len(path) > 1 {
+				path = strings.TrimSuffix(path, "/")
+			}
+			for _, route := range routes {
+				match := route.regex.FindStringSubmatch(path)
+				if match == nil {
+					continue
+				}
+				op := route.item[strings.ToLower(r.Method)]
+				if op == nil {
+					break
+				}
+				values := make(map[string]string)
+				for i, name := range route.names {
+					values[name] = match[i+1]
+				}
+				if !checkParameters(w, r, op.Parameters, values, patterns) {
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkParameters checks parameters of request, taking path parameters
+// from values and compiled patterns of schemas from patterns. Writes
+// error response and returns false if a parameter is invalid.
+func checkParameters(w http.ResponseWriter, r *http.Request, parameters []Parameter, values map[string]string, patterns map[string]*regexp.Regexp) bool {
+	for _, parameter := range parameters {
+		var value string
+		var present bool
+		switch parameter.In {
+		case "path":
+			value, present = values[parameter.Name]
+		case "query":
+			var list []string
+			list, present = r.URL.Query()[parameter.Name]
+			if present {
+				value = list[0]
+			}
+		case "header":
+			value = r.Header.Get(parameter.Name)
+			present = value != ""
+		default:
+			continue
+		}
+		if !present {
+			if parameter.Required {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest,
+					fmt.Sprintf("%s %s is required", parameter.Name, kind(parameter)))
+				return false
+			}
+			continue
+		}
+		if message := check(parameter.Schema, parameter.Name, value, patterns); message != "" {
+			code := apierror.BadRequest
+			if parameter.In == "path" && parameter.Name == "key" {
+				code = apierror.InvalidKey
+			}
+			apierror.WriteDetails(w, r, http.StatusBadRequest, code, message, map[string]string{parameter.Name: value})
+			return false
+		}
+	}
+	return true
+}
+
+// kind names location of parameter in messages.
+func kind(parameter Parameter) string {
+	if parameter.In == "query" {
+		return "parameter"
+	}
+	return parameter.In
+}
+
+// check returns message describing why value of parameter called
+// name does not match schema, or an empty string if it does.
+// Schemas referring to components are not checked.
+func check(schema *Schema, name, value string, patterns map[string]*regexp.Regexp) string {
+	if schema == nil {
+		return ""
+	}
+	switch schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return name + " must be an integer"
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return name + " must be a number"
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return name + " must be a boolean"
+		}
+	}
+	if schema.Pattern != "" && !patterns[schema.Pattern].MatchString(value) {
+		return name + " must match " + schema.Pattern
+	}
+	if schema.MaxLength > 0 && len(value) > schema.MaxLength {
+		return fmt.Sprintf("%s must be at most %d characters long", name, schema.MaxLength)
+	}
+	if len(schema.Enum) > 0 {
+		for _, option := range schema.Enum {
+			if value == option {
+				return ""
+			}
+		}
+		return name + " must be one of " + strings.Join(schema.Enum, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	handler := Validate(Spec("test"))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	dataSets := []struct {
+		method string
+		target string
+		code   string
+	}{
+		{http.MethodGet, "/api/objects/key?wait=1s&after=5", ""},
+		{http.MethodGet, "/api/objects/key/", ""},
+		{http.MethodGet, "/api/objects/key?after=abc", apierror.BadRequest},
+		{http.MethodPut, "/api/objects/a-b", apierror.InvalidKey},
+		{http.MethodGet, "/api/namespaces/team/objects/a-b", apierror.InvalidKey},
+		{http.MethodDelete, "/api/cluster/nodes", apierror.BadRequest},
+		{http.MethodDelete, "/api/cluster/nodes?address=http://node", ""},
+		{http.MethodPost, "/api/objects/key", ""},
+		{http.MethodGet, "/unknown?after=abc", ""},
+	}
+	for _, dataSet := range dataSets {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(dataSet.method, dataSet.target, nil))
+		if dataSet.code == "" {
+			if w.Code != http.StatusTeapot {
+				t.Errorf("%s %s: request not passed on: %d %s", dataSet.method, dataSet.target, w.Code, w.Body)
+			}
+			continue
+		}
+		var envelope apierror.Envelope
+		if err := json.NewDecoder(w.Body).Decode(&envelope); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusBadRequest || envelope.Error.Code != dataSet.code {
+			t.Errorf("%s %s: wrong response: %d %+v", dataSet.method, dataSet.target, w.Code, envelope.Error)
+		}
+	}
+}
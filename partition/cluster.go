@@ -0,0 +1,644 @@
+package partition
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Url = "/api/cluster"
+
+	// ForwardedHeader marks requests sent by other cluster nodes.
+	// Such requests are always served locally, so that nodes
+	// with different views of the ring do not forward in circles.
+	ForwardedHeader = "X-GWP-Forwarded"
+	// SecretHeader carries the secret shared by cluster nodes,
+	// authenticating requests sent by them.
+	SecretHeader = "X-GWP-Cluster-Secret"
+
+	clientTimeout = 30 * time.Second
+
+	// MigrationWindow is how long after a membership change
+	// migrations are accepted and retried.
+	MigrationWindow = 5 * time.Minute
+	retryDelay      = time.Second
+
+	// membershipAttempts limits how many times a membership
+	// change is made again on top of a newer membership.
+	membershipAttempts = 5
+)
+
+// Membership is a versioned list of cluster nodes.
+// Nodes accept only memberships with epoch higher than
+// the one they know.
+type Membership struct {
+	Epoch uint64   `json:"epoch"`
+	Nodes []string `json:"nodes"`
+}
+
+// Migration carries objects of a node to their new owner, along
+// with keys deleted on the node after their objects were migrated.
+type Migration struct {
+	Epoch   uint64          `json:"epoch"`
+	Objects []archive.Entry `json:"objects"`
+	Deleted []string        `json:"deleted"`
+}
+
+// Info describes cluster from the point of view of a node.
+type Info struct {
+	Self         string   `json:"self"`
+	Epoch        uint64   `json:"epoch"`
+	Nodes        []string `json:"nodes"`
+	VirtualNodes int      `json:"virtualNodes"`
+	LocalKeys    int      `json:"localKeys"`
+}
+
+// Cluster is a node of a cluster partitioning keys over
+// its members with a consistent hash ring.
+// Nodes are identified by their base URLs, e.g. http://10.0.0.1:8080.
+type Cluster struct {
+	self    string
+	secret  string
+	storage storage.Storage
+	client  *http.Client
+
+	mut        sync.RWMutex
+	ring       *Ring
+	membership Membership
+	// Keys written locally during migration window,
+	// which migrations must not overwrite.
+	written   map[string]struct{}
+	windowEnd time.Time
+
+	// writes are held for reading by local writes of objects
+	// and for writing by migrations, so that they do not interleave.
+	writes sync.RWMutex
+	// changing serializes membership changes made by this node.
+	changing sync.Mutex
+	// rebalancing serializes data migrations.
+	rebalancing     sync.Mutex
+	migrationWindow time.Duration
+	retryDelay      time.Duration
+}
+
+// New creates a single node cluster, accepting requests
+// of other nodes authenticated with secret.
+func New(self, secret string, dataStorage storage.Storage) *Cluster {
+	self = strings.TrimSuffix(self, "/")
+	return &Cluster{
+		self:       self,
+		secret:     secret,
+		storage:    dataStorage,
+		client:     &http.Client{Timeout: clientTimeout},
+		ring:       NewRing(self),
+		membership: Membership{Epoch: 1, Nodes: []string{self}},
+
+		migrationWindow: MigrationWindow,
+		retryDelay:      retryDelay,
+	}
+}
+
+// Owner returns node responsible for key.
+func (c *Cluster) Owner(key string) string {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.ring.Owner(key)
+}
+
+func (c *Cluster) epoch() uint64 {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.membership.Epoch
+}
+
+// Info describes current cluster state.
+func (c *Cluster) Info() Info {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return Info{
+		Self:         c.self,
+		Epoch:        c.membership.Epoch,
+		Nodes:        c.ring.Nodes(),
+		VirtualNodes: VirtualNodes,
+		LocalKeys:    len(c.storage.Keys()),
+	}
+}
+
+// Join asks node at seed to add this node to its cluster.
+func (c *Cluster) Join(seed string) error {
+	body, _ := json.Marshal(map[string]string{"address": c.self})
+	return c.send(http.MethodPost, strings.TrimSuffix(seed, "/")+Url+"/nodes", "application/json", body)
+}
+
+// Leave removes this node from the cluster,
+// handing its data over to remaining nodes.
+func (c *Cluster) Leave() error {
+	return c.changeMembership(func(nodes map[string]struct{}) {
+		delete(nodes, c.self)
+	})
+}
+
+// LoadSecret reads secret shared by cluster nodes from file.
+func LoadSecret(fileName string) (string, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(contents))
+	if secret == "" {
+		return "", fmt.Errorf("empty secret in %s", fileName)
+	}
+	return secret, nil
+}
+
+// Handler returns handler serving cluster endpoints,
+// to be mounted under Url. Endpoints other than the one
+// describing the cluster require SecretHeader.
+func (c *Cluster) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", c.getInfo)
+	r.Group(func(r chi.Router) {
+		r.Use(c.requireSecret)
+		r.Put("/membership", c.putMembership)
+		r.Post("/nodes", c.postNode)
+		r.Delete("/nodes", c.deleteNode)
+		r.Post("/migrate", c.postMigrate)
+	})
+	return r
+}
+
+// FromNode tells whether request was sent by a cluster node.
+func (c *Cluster) FromNode(r *http.Request) bool {
+	secret := r.Header.Get(SecretHeader)
+	return c.secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(c.secret)) == 1
+}
+
+// requireSecret stops requests not sent by cluster nodes,
+// writing code http.StatusUnauthorized with code apierror.Unauthorized.
+func (c *Cluster) requireSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.FromNode(r) {
+			next.ServeHTTP(w, r)
+		} else {
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.Unauthorized, "cluster secret required")
+		}
+	})
+}
+
+// Forward sends requests for keys owned by other nodes
+// to their owners and merges key listings of all nodes.
+// Other requests are passed to next. ForwardedHeader
+// is removed from requests not sent by cluster nodes.
+func (c *Cluster) Forward(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ForwardedHeader) != "" && !c.FromNode(r) {
+			r.Header.Del(ForwardedHeader)
+		}
+		path := r.URL.Path
+		if path != router.ObjectsUrl && !strings.HasPrefix(path, router.ObjectsUrl+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		forwarded := r.Header.Get(ForwardedHeader) != ""
+		key := strings.Trim(strings.TrimPrefix(path, router.ObjectsUrl), "/")
+		if key == "" {
+			if !forwarded && r.Method == http.MethodGet && len(c.Info().Nodes) > 1 {
+				c.listKeys(w, r)
+			} else {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+		if owner := c.Owner(key); forwarded || owner == c.self || owner == "" {
+			c.serveLocally(w, r, key, next)
+		} else {
+			c.proxy(owner).ServeHTTP(w, r)
+		}
+	})
+}
+
+// serveLocally passes request for key to next. Writes are recorded
+// before they are served, so that migrations do not overwrite them.
+func (c *Cluster) serveLocally(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	c.mut.Lock()
+	if time.Now().Before(c.windowEnd) {
+		c.written[key] = struct{}{}
+	} else {
+		c.written = nil
+	}
+	c.mut.Unlock()
+	next.ServeHTTP(w, r)
+}
+
+func (c *Cluster) proxy(owner string) http.Handler {
+	target, err := url.Parse(owner)
+	if err != nil {
+		panic(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		c.authenticate(r)
+		if id := logging.RequestId(r.Context()); id != "" {
+			r.Header.Set(logging.RequestIdHeader, id)
+		}
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Forwarding to %s: %v", owner, err)
+		apierror.WriteDetails(w, r, http.StatusBadGateway, apierror.BadGateway,
+			"owner of the key unreachable", map[string]string{"node": owner})
+	}
+	return proxy
+}
+
+// listKeys writes keys stored on all nodes in JSON format.
+// Writes code http.StatusBadGateway if a node cannot be reached.
+func (c *Cluster) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys := make(map[string]struct{})
+	for _, node := range c.Info().Nodes {
+		var nodeKeys []string
+		if node == c.self {
+			nodeKeys = c.storage.Keys()
+		} else if err := c.getJson(node+router.ObjectsUrl, &nodeKeys); err != nil {
+			log.Printf("Listing keys of %s: %v", node, err)
+			apierror.WriteDetails(w, r, http.StatusBadGateway, apierror.BadGateway,
+				"node unreachable", map[string]string{"node": node})
+			return
+		}
+		for _, key := range nodeKeys {
+			keys[key] = struct{}{}
+		}
+	}
+	merged := make([]string, 0, len(keys))
+	for key := range keys {
+		merged = append(merged, key)
+	}
+	sort.Strings(merged)
+	apierror.WriteJson(w, http.StatusOK, merged)
+}
+
+func (c *Cluster) getInfo(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJson(w, http.StatusOK, c.Info())
+}
+
+// putMembership accepts membership broadcast by another node.
+// Writes code http.StatusConflict if membership is not newer
+// than the known one, http.StatusNoContent otherwise.
+func (c *Cluster) putMembership(w http.ResponseWriter, r *http.Request) {
+	var membership Membership
+	if err := json.NewDecoder(r.Body).Decode(&membership); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid membership: "+err.Error())
+		return
+	}
+	if !c.apply(membership) {
+		apierror.Write(w, r, http.StatusConflict, apierror.Conflict, "membership not newer than the known one")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	go c.rebalance()
+}
+
+// postNode adds node given in JSON body {"address": ...} to the cluster.
+func (c *Cluster) postNode(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Address == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "node address is required")
+		return
+	}
+	address := strings.TrimSuffix(body.Address, "/")
+	err := c.changeMembership(func(nodes map[string]struct{}) {
+		nodes[address] = struct{}{}
+	})
+	if err != nil {
+		log.Printf("Adding node %s: %v", address, err)
+		apierror.WriteDetails(w, r, http.StatusBadGateway, apierror.BadGateway, err.Error(), map[string]string{"node": address})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteNode removes node given in address query parameter
+// from the cluster. Removed node hands its data over to
+// remaining nodes, if it is reachable.
+func (c *Cluster) deleteNode(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimSuffix(r.URL.Query().Get("address"), "/")
+	if address == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "address parameter is required")
+		return
+	}
+	err := c.changeMembership(func(nodes map[string]struct{}) {
+		delete(nodes, address)
+	})
+	if err != nil {
+		log.Printf("Removing node %s: %v", address, err)
+		apierror.WriteDetails(w, r, http.StatusBadGateway, apierror.BadGateway, err.Error(), map[string]string{"node": address})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postMigrate applies migration from request's body to local storage,
+// except for keys written locally since the membership changed,
+// as they are newer. Writes code http.StatusConflict if migration
+// was made with membership other than the current one, or after
+// the migration window, so that the sender keeps its objects.
+func (c *Cluster) postMigrate(w http.ResponseWriter, r *http.Request) {
+	var m Migration
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid migration: "+err.Error())
+		return
+	}
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	c.mut.RLock()
+	epoch, windowEnd, written := c.membership.Epoch, c.windowEnd, c.written
+	c.mut.RUnlock()
+	if m.Epoch != epoch || time.Now().After(windowEnd) {
+		apierror.WriteDetails(w, r, http.StatusConflict, apierror.Conflict,
+			"migration not accepted in current membership", map[string]uint64{"epoch": epoch})
+		return
+	}
+	for _, entry := range m.Objects {
+		if _, ok := written[entry.Key]; ok {
+			continue
+		}
+		if entry.Object == nil {
+			entry.Object = []byte{}
+		}
+		if err := c.storage.Put(entry.Key, entry.Object, entry.ContentType); err != nil {
+			apierror.Write(w, r, http.StatusServiceUnavailable, apierror.Unavailable, err.Error())
+			return
+		}
+	}
+	for _, key := range m.Deleted {
+		if _, ok := written[key]; ok {
+			continue
+		}
+		if err := c.storage.Delete(key); err != nil && err != storage.KeyAbsentError {
+			apierror.Write(w, r, http.StatusServiceUnavailable, apierror.Unavailable, err.Error())
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeMembership applies change to current nodes, bumps epoch
+// and broadcasts the result to all nodes, including removed ones.
+// Failing to notify a removed node is not an error. If a node knows
+// a newer membership, it is applied and the change is made again
+// on top of it.
+func (c *Cluster) changeMembership(change func(nodes map[string]struct{})) error {
+	c.changing.Lock()
+	defer c.changing.Unlock()
+	for attempt := 1; ; attempt++ {
+		newer, err := c.broadcast(change)
+		if newer == nil {
+			return err
+		}
+		if attempt == membershipAttempts {
+			return fmt.Errorf("membership changed concurrently %d times", attempt)
+		}
+		if c.apply(*newer) {
+			go c.rebalance()
+		}
+	}
+}
+
+// broadcast sends membership made with change to all nodes.
+// Returns membership of a node rejecting the broadcast, if it
+// is not older. Otherwise the broadcast membership is applied,
+// even if some kept nodes were not notified, so that nodes which
+// were do not get ahead and a retry is made with a higher epoch.
+// The first error of notifying a kept node is returned then.
+func (c *Cluster) broadcast(change func(nodes map[string]struct{})) (*Membership, error) {
+	c.mut.RLock()
+	nodes := make(map[string]struct{})
+	for _, node := range c.membership.Nodes {
+		nodes[node] = struct{}{}
+	}
+	epoch := c.membership.Epoch
+	c.mut.RUnlock()
+
+	before := make(map[string]struct{})
+	for node := range nodes {
+		before[node] = struct{}{}
+	}
+	change(nodes)
+	membership := Membership{Epoch: epoch + 1}
+	for node := range nodes {
+		membership.Nodes = append(membership.Nodes, node)
+		before[node] = struct{}{}
+	}
+	sort.Strings(membership.Nodes)
+
+	var failed error
+	body, _ := json.Marshal(membership)
+	for node := range before {
+		if node == c.self {
+			continue
+		}
+		err := c.send(http.MethodPut, node+Url+"/membership", "application/json", body)
+		if err == nil {
+			continue
+		}
+		if isConflict(err) {
+			var info Info
+			if err := c.getJson(node+Url, &info); err != nil {
+				log.Printf("Getting membership of %s: %v", node, err)
+			} else if info.Epoch >= membership.Epoch {
+				return &Membership{Epoch: info.Epoch, Nodes: info.Nodes}, nil
+			}
+		}
+		if _, kept := nodes[node]; !kept {
+			// Removed node may be already dead.
+			log.Printf("Notifying removed node %s: %v", node, err)
+			continue
+		}
+		log.Printf("Notifying node %s: %v", node, err)
+		if failed == nil {
+			failed = err
+		}
+	}
+	if c.apply(membership) {
+		go c.rebalance()
+	}
+	return nil, failed
+}
+
+// apply replaces known membership if the given one is newer.
+func (c *Cluster) apply(membership Membership) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if membership.Epoch <= c.membership.Epoch {
+		return false
+	}
+	c.membership = membership
+	c.ring = NewRing(membership.Nodes...)
+	c.written = make(map[string]struct{})
+	c.windowEnd = time.Now().Add(c.migrationWindow)
+	return true
+}
+
+// rebalance moves local objects owned by other nodes to their owners,
+// retrying until all are moved, membership changes or the migration
+// window passes. Objects written by requests forwarded from nodes not
+// knowing the membership yet are migrated again.
+func (c *Cluster) rebalance() {
+	c.rebalancing.Lock()
+	defer c.rebalancing.Unlock()
+
+	epoch := c.epoch()
+	deadline := time.Now().Add(c.migrationWindow)
+	deleted := make(map[string][]string)
+	for {
+		left := c.migrate(epoch, deleted)
+		if left == 0 || c.epoch() != epoch {
+			// Newer membership is rebalanced next.
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Giving up migration of %d objects", left)
+			return
+		}
+		time.Sleep(c.retryDelay)
+	}
+}
+
+// migrate sends local objects owned by other nodes to their owners,
+// along with keys in deleted, and deletes the objects unless they changed
+// in the meantime. Keys of objects deleted in the meantime are added to
+// deleted, to be sent next time. Returns number of objects and keys left.
+func (c *Cluster) migrate(epoch uint64, deleted map[string][]string) int {
+	migrations := make(map[string]*Migration)
+	for owner, keys := range deleted {
+		migrations[owner] = &Migration{Epoch: epoch, Deleted: keys}
+	}
+	for _, key := range c.storage.Keys() {
+		owner := c.Owner(key)
+		if owner == c.self || owner == "" {
+			continue
+		}
+		data, err := c.storage.Get(key)
+		if err != nil {
+			continue
+		}
+		if migrations[owner] == nil {
+			migrations[owner] = &Migration{Epoch: epoch}
+		}
+		migrations[owner].Objects = append(migrations[owner].Objects,
+			archive.Entry{Key: key, ContentType: data.ContentType, Object: data.Object})
+	}
+
+	left := 0
+	for owner, m := range migrations {
+		body, _ := json.Marshal(m)
+		if err := c.send(http.MethodPost, owner+Url+"/migrate", "application/json", body); err != nil {
+			log.Printf("Migrating %d objects to %s: %v", len(m.Objects), owner, err)
+			left += len(m.Objects) + len(m.Deleted)
+			continue
+		}
+		delete(deleted, owner)
+		c.writes.Lock()
+		for _, entry := range m.Objects {
+			current, err := c.storage.Get(entry.Key)
+			if err == storage.KeyAbsentError {
+				deleted[owner] = append(deleted[owner], entry.Key)
+				left++
+			} else if err != nil || current.ContentType != entry.ContentType || !bytes.Equal(current.Object, entry.Object) {
+				left++
+			} else if err := c.storage.Delete(entry.Key); err != nil {
+				left++
+			}
+		}
+		c.writes.Unlock()
+	}
+	return left
+}
+
+// authenticate marks request as sent by this node.
+func (c *Cluster) authenticate(r *http.Request) {
+	r.Header.Set(ForwardedHeader, c.self)
+	r.Header.Set(SecretHeader, c.secret)
+}
+
+// send sends request to another node, expecting a successful response.
+func (c *Cluster) send(method, url, contentType string, body []byte) error {
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	c.authenticate(request)
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = ioutil.ReadAll(response.Body)
+	if response.StatusCode/100 != 2 {
+		return &statusError{method: method, url: url, code: response.StatusCode, status: response.Status}
+	}
+	return nil
+}
+
+// statusError is returned by send for unsuccessful responses.
+type statusError struct {
+	method string
+	url    string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.method, e.url, e.status)
+}
+
+// isConflict tells whether err is a response
+// with code http.StatusConflict.
+func isConflict(err error) bool {
+	e, ok := err.(*statusError)
+	return ok && e.code == http.StatusConflict
+}
+
+func (c *Cluster) getJson(url string, value interface{}) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	c.authenticate(request)
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(value)
+}
@@ -0,0 +1,462 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/limit"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+type node struct {
+	storage storage.Storage
+	cluster *Cluster
+	server  *httptest.Server
+	// down makes node respond with http.StatusServiceUnavailable, if not 0.
+	down int32
+}
+
+func newNode() *node {
+	return newWrappedNode(nil)
+}
+
+// newWrappedNode creates node serving requests with
+// its handler wrapped with wrap, if it is not nil.
+func newWrappedNode(wrap func(*Cluster, http.Handler) http.Handler) *node {
+	n := &node{storage: storage.NewStorage()}
+	n.server = httptest.NewUnstartedServer(nil)
+	n.server.Start()
+	n.cluster = New(n.server.URL, testSecret, n.storage)
+	r := router.NewRouter(n.storage)
+	r.Mount(Url, n.cluster.Handler())
+	handler := n.cluster.Forward(r)
+	if wrap != nil {
+		handler = wrap(n.cluster, handler)
+	}
+	n.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&n.down) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return n
+}
+
+func newNodes(t *testing.T, count int) []*node {
+	var nodes []*node
+	for i := 0; i < count; i++ {
+		n := newNode()
+		if i > 0 {
+			if err := n.cluster.Join(nodes[0].server.URL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func closeNodes(nodes []*node) {
+	for _, n := range nodes {
+		n.server.Close()
+	}
+}
+
+func put(t *testing.T, url, key string, object []byte) {
+	request, _ := http.NewRequest(http.MethodPut, url+router.ObjectsUrl+"/"+key, bytes.NewReader(object))
+	request.Header.Set("Content-Type", "type")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		t.Fatalf("wrong response code: %v", response.StatusCode)
+	}
+}
+
+func get(t *testing.T, url, key string) []byte {
+	response, err := http.Get(url + router.ObjectsUrl + "/" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response code: %v", response.StatusCode)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	return body
+}
+
+// waitForBalance polls until every node stores only keys it owns
+// and nodes store count keys in total.
+func waitForBalance(t *testing.T, nodes []*node, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		total := 0
+		balanced := true
+		for _, n := range nodes {
+			for _, key := range n.storage.Keys() {
+				total++
+				if n.cluster.Owner(key) != n.cluster.self {
+					balanced = false
+				}
+			}
+		}
+		if balanced && total == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cluster not balanced, %v keys stored", total)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	nodes := newNodes(t, 3)
+	defer closeNodes(nodes)
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprint("key", i)
+		put(t, nodes[i%3].server.URL, key, []byte(key))
+	}
+	waitForBalance(t, nodes, 30)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprint("key", i)
+		if object := get(t, nodes[(i+1)%3].server.URL, key); string(object) != key {
+			t.Errorf("wrong object: %s", object)
+		}
+	}
+
+	response, err := http.Get(nodes[0].server.URL + router.ObjectsUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var keys []string
+	if err := json.NewDecoder(response.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 30 || !sort.StringsAreSorted(keys) {
+		t.Errorf("wrong keys: %v", keys)
+	}
+}
+
+func TestRebalancing(t *testing.T) {
+	nodes := newNodes(t, 1)
+	defer func() { closeNodes(nodes) }()
+
+	for i := 0; i < 50; i++ {
+		put(t, nodes[0].server.URL, fmt.Sprint("key", i), []byte{byte(i)})
+	}
+
+	for i := 0; i < 2; i++ {
+		n := newNode()
+		if err := n.cluster.Join(nodes[0].server.URL); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+		waitForBalance(t, nodes, 50)
+	}
+	for _, n := range nodes {
+		if len(n.storage.Keys()) == 0 {
+			t.Errorf("no keys moved to %v", n.cluster.self)
+		}
+	}
+
+	if err := nodes[1].cluster.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	remaining := []*node{nodes[0], nodes[2]}
+	waitForBalance(t, remaining, 50)
+	if keys := nodes[1].storage.Keys(); len(keys) != 0 {
+		t.Errorf("keys left on removed node: %v", keys)
+	}
+	for i := 0; i < 50; i++ {
+		if object := get(t, nodes[1].server.URL, fmt.Sprint("key", i)); !reflect.DeepEqual(object, []byte{byte(i)}) {
+			t.Errorf("wrong object: %v", object)
+		}
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	nodes := newNodes(t, 2)
+	defer closeNodes(nodes)
+
+	response, err := http.Get(nodes[1].server.URL + Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var info Info
+	if err := json.NewDecoder(response.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{nodes[0].server.URL, nodes[1].server.URL}
+	sort.Strings(expected)
+	if info.Self != nodes[1].server.URL || info.Epoch != 2 || !reflect.DeepEqual(info.Nodes, expected) {
+		t.Errorf("wrong info: %v", info)
+	}
+}
+
+func TestRemoveDeadNode(t *testing.T) {
+	nodes := newNodes(t, 3)
+	defer closeNodes(nodes[:2])
+	nodes[2].server.Close()
+
+	request, _ := http.NewRequest(http.MethodDelete, nodes[0].server.URL+Url+"/nodes?address="+nodes[2].server.URL, nil)
+	request.Header.Set(SecretHeader, testSecret)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Fatalf("wrong response code: %v", response.StatusCode)
+	}
+	for _, n := range nodes[:2] {
+		if info := n.cluster.Info(); len(info.Nodes) != 2 {
+			t.Errorf("wrong nodes: %v", info.Nodes)
+		}
+	}
+}
+
+// checkMembership fails t unless all nodes know epoch and members.
+func checkMembership(t *testing.T, nodes []*node, epoch uint64, members []*node) {
+	var expected []string
+	for _, n := range members {
+		expected = append(expected, n.server.URL)
+	}
+	sort.Strings(expected)
+	for _, n := range nodes {
+		if info := n.cluster.Info(); info.Epoch != epoch || !reflect.DeepEqual(info.Nodes, expected) {
+			t.Errorf("wrong membership of %s: %v %v", n.server.URL, info.Epoch, info.Nodes)
+		}
+	}
+}
+
+func TestConcurrentMembershipChange(t *testing.T) {
+	nodes := newNodes(t, 2)
+	defer closeNodes(nodes)
+	added := newNode()
+	defer added.server.Close()
+	nodes = append(nodes, added)
+
+	// Concurrent change made by nodes[1], which
+	// did not notify nodes[0] yet.
+	nodes[1].cluster.apply(Membership{Epoch: 3, Nodes: []string{nodes[0].server.URL, nodes[1].server.URL, added.server.URL}})
+	added.cluster.apply(Membership{Epoch: 3, Nodes: []string{nodes[0].server.URL, nodes[1].server.URL, added.server.URL}})
+	joining := newNode()
+	defer joining.server.Close()
+	nodes = append(nodes, joining)
+	if err := joining.cluster.Join(nodes[0].server.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkMembership(t, nodes, 4, nodes)
+}
+
+func TestRetryMembershipChange(t *testing.T) {
+	nodes := newNodes(t, 3)
+	defer closeNodes(nodes)
+	joining := newNode()
+	defer joining.server.Close()
+
+	atomic.StoreInt32(&nodes[2].down, 1)
+	if err := joining.cluster.Join(nodes[0].server.URL); err == nil {
+		t.Fatal("no error with unreachable node")
+	}
+	checkMembership(t, []*node{nodes[0], nodes[1], joining}, 4, append(nodes, joining))
+
+	atomic.StoreInt32(&nodes[2].down, 0)
+	if err := joining.cluster.Join(nodes[0].server.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkMembership(t, append(nodes, joining), 5, append(nodes, joining))
+}
+
+func TestRateLimitOnEntryNode(t *testing.T) {
+	limited := func(c *Cluster, handler http.Handler) http.Handler {
+		limiter := limit.NewLimiter(0.001, 3)
+		limiter.Exempt(c.FromNode)
+		return limiter.Middleware(handler)
+	}
+	nodes := []*node{newWrappedNode(limited), newWrappedNode(limited)}
+	defer closeNodes(nodes)
+	if err := nodes[1].cluster.Join(nodes[0].server.URL); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; len(keys) < 3; i++ {
+		if key := fmt.Sprint("key", i); nodes[0].cluster.Owner(key) == nodes[1].server.URL {
+			keys = append(keys, key)
+		}
+	}
+
+	// Requests forwarded by nodes[0] are not charged to it by nodes[1],
+	// so the client can still send requests to nodes[1] directly.
+	for _, key := range keys {
+		put(t, nodes[0].server.URL, key, []byte(key))
+	}
+	for _, key := range keys {
+		if object := get(t, nodes[1].server.URL, key); string(object) != key {
+			t.Errorf("wrong object: %s", object)
+		}
+	}
+	for _, n := range nodes {
+		response, err := http.Get(n.server.URL + router.ObjectsUrl + "/" + keys[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("wrong response code of %s: %v", n.server.URL, response.StatusCode)
+		}
+	}
+}
+
+func migrate(t *testing.T, url string, m Migration) int {
+	body, _ := json.Marshal(m)
+	request, _ := http.NewRequest(http.MethodPost, url+Url+"/migrate", bytes.NewReader(body))
+	request.Header.Set(SecretHeader, testSecret)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestMigrationKeepsLocalWrites(t *testing.T) {
+	n := newNode()
+	defer n.server.Close()
+	n.cluster.apply(Membership{Epoch: 2, Nodes: []string{n.cluster.self}})
+	put(t, n.server.URL, "written", []byte("local"))
+	put(t, n.server.URL, "deleted", []byte("local"))
+	request, _ := http.NewRequest(http.MethodDelete, n.server.URL+router.ObjectsUrl+"/deleted", nil)
+	if response, err := http.DefaultClient.Do(request); err != nil {
+		t.Fatal(err)
+	} else {
+		response.Body.Close()
+	}
+	n.storage.Put("stale", []byte("local"), "type")
+
+	m := Migration{Epoch: 2, Objects: []archive.Entry{
+		{Key: "written", ContentType: "type", Object: []byte("migrated")},
+		{Key: "deleted", ContentType: "type", Object: []byte("migrated")},
+		{Key: "new", ContentType: "type", Object: []byte("migrated")},
+	}, Deleted: []string{"stale"}}
+	if code := migrate(t, n.server.URL, m); code != http.StatusNoContent {
+		t.Fatalf("wrong response code: %v", code)
+	}
+	expected := map[string]string{"written": "local", "new": "migrated"}
+	actual := make(map[string]string)
+	for _, key := range n.storage.Keys() {
+		data, _ := n.storage.Get(key)
+		actual[key] = string(data.Object)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	m.Epoch = 1
+	if code := migrate(t, n.server.URL, m); code != http.StatusConflict {
+		t.Errorf("wrong response code: %v", code)
+	}
+	n.cluster.windowEnd = time.Now()
+	m.Epoch = 2
+	if code := migrate(t, n.server.URL, m); code != http.StatusConflict {
+		t.Errorf("wrong response code: %v", code)
+	}
+}
+
+func TestMigrationOfChangedObjects(t *testing.T) {
+	dataStorage := storage.NewStorage()
+	var migrations []Migration
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m Migration
+		json.NewDecoder(r.Body).Decode(&m)
+		if len(migrations) == 0 {
+			// Written by requests forwarded from nodes
+			// not knowing the new owner yet.
+			dataStorage.Put("changed", []byte("new"), "type")
+			dataStorage.Delete("deleted")
+		}
+		migrations = append(migrations, m)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer owner.Close()
+	c := New("http://self", testSecret, dataStorage)
+	c.retryDelay = time.Millisecond
+	c.apply(Membership{Epoch: 2, Nodes: []string{owner.URL}})
+	for _, key := range []string{"changed", "deleted", "same"} {
+		dataStorage.Put(key, []byte("old"), "type")
+	}
+
+	c.rebalance()
+	if keys := dataStorage.Keys(); len(keys) != 0 {
+		t.Errorf("keys left: %v", keys)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations, got %v", migrations)
+	}
+	expected := Migration{Epoch: 2, Objects: []archive.Entry{{Key: "changed", ContentType: "type", Object: []byte("new")}}, Deleted: []string{"deleted"}}
+	if !reflect.DeepEqual(migrations[1], expected) {
+		t.Errorf("expected %+v, got %+v", expected, migrations[1])
+	}
+}
+
+func TestSecret(t *testing.T) {
+	nodes := newNodes(t, 2)
+	defer closeNodes(nodes)
+
+	for _, secret := range []string{"", "invalid"} {
+		request, _ := http.NewRequest(http.MethodDelete, nodes[0].server.URL+Url+"/nodes?address="+nodes[1].server.URL, nil)
+		request.Header.Set(SecretHeader, secret)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("wrong response code: %v", response.StatusCode)
+		}
+	}
+	if info := nodes[0].cluster.Info(); len(info.Nodes) != 2 {
+		t.Errorf("wrong nodes: %v", info.Nodes)
+	}
+
+	// Forged header does not make other nodes store keys they do not own.
+	key := "key"
+	for i := 0; nodes[0].cluster.Owner(key) == nodes[0].cluster.self; i++ {
+		key = fmt.Sprint("key", i)
+	}
+	request, _ := http.NewRequest(http.MethodPut, nodes[0].server.URL+router.ObjectsUrl+"/"+key, strings.NewReader("data"))
+	request.Header.Set("Content-Type", "type")
+	request.Header.Set(ForwardedHeader, "client")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if _, err := nodes[1].storage.Get(key); err != nil {
+		t.Errorf("key not stored on its owner: %v", err)
+	}
+	if keys := nodes[0].storage.Keys(); len(keys) != 0 {
+		t.Errorf("keys stored on other node: %v", keys)
+	}
+}
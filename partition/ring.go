@@ -0,0 +1,92 @@
+package partition
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// VirtualNodes is the number of points each node takes on the ring.
+const VirtualNodes = 64
+
+// Ring is a consistent hash ring assigning keys to nodes.
+// Ring is not safe for concurrent modification.
+type Ring struct {
+	points []uint32
+	owners map[uint32]string
+	nodes  map[string]struct{}
+}
+
+func NewRing(nodes ...string) *Ring {
+	ring := &Ring{owners: make(map[uint32]string), nodes: make(map[string]struct{})}
+	for _, node := range nodes {
+		ring.Add(node)
+	}
+	return ring
+}
+
+// Add places node on the ring.
+func (r *Ring) Add(node string) {
+	if _, present := r.nodes[node]; present {
+		return
+	}
+	r.nodes[node] = struct{}{}
+	for i := 0; i < VirtualNodes; i++ {
+		point := hash(node + "#" + strconv.Itoa(i))
+		// On the unlikely collision, lower node name wins,
+		// so the ring does not depend on insertion order.
+		if owner, taken := r.owners[point]; taken {
+			if owner < node {
+				continue
+			}
+		} else {
+			r.points = append(r.points, point)
+		}
+		r.owners[point] = node
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove takes node off the ring.
+func (r *Ring) Remove(node string) {
+	if _, present := r.nodes[node]; !present {
+		return
+	}
+	delete(r.nodes, node)
+	remaining := make([]string, 0, len(r.nodes))
+	for other := range r.nodes {
+		remaining = append(remaining, other)
+	}
+	*r = *NewRing(remaining...)
+}
+
+// Owner returns node responsible for key,
+// empty if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	point := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Nodes returns sorted nodes present on the ring.
+func (r *Ring) Nodes() []string {
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// hash uses SHA-1, since checksums spread similar node names poorly.
+func hash(value string) uint32 {
+	sum := sha1.Sum([]byte(value))
+	return binary.BigEndian.Uint32(sum[:])
+}
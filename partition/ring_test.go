@@ -0,0 +1,59 @@
+package partition
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRing_Owner(t *testing.T) {
+	if owner := NewRing().Owner("key"); owner != "" {
+		t.Errorf("empty ring has owner: %v", owner)
+	}
+
+	nodes := []string{"http://a", "http://b", "http://c"}
+	ring := NewRing(nodes...)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		counts[ring.Owner(fmt.Sprint("key", i))]++
+	}
+	for _, node := range nodes {
+		if counts[node] < 500 {
+			t.Errorf("node %v owns too few keys: %v", node, counts[node])
+		}
+	}
+
+	reversed := NewRing(nodes[2], nodes[1], nodes[0])
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint("key", i)
+		if ring.Owner(key) != reversed.Owner(key) {
+			t.Fatalf("owner depends on insertion order: %v", key)
+		}
+	}
+}
+
+func TestRing_AddRemove(t *testing.T) {
+	ring := NewRing("http://a", "http://b")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint("key", i)
+		before[key] = ring.Owner(key)
+	}
+
+	ring.Add("http://c")
+	if nodes := ring.Nodes(); !reflect.DeepEqual(nodes, []string{"http://a", "http://b", "http://c"}) {
+		t.Errorf("wrong nodes: %v", nodes)
+	}
+	for key, owner := range before {
+		if now := ring.Owner(key); now != owner && now != "http://c" {
+			t.Errorf("key %v moved between old nodes", key)
+		}
+	}
+
+	ring.Remove("http://c")
+	for key, owner := range before {
+		if now := ring.Owner(key); now != owner {
+			t.Errorf("key %v not moved back", key)
+		}
+	}
+}
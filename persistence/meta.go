@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"github.com/boltdb/bolt"
+	"os"
+	"strings"
+)
+
+var ReservedBucketError = errors.New("bucket reserved for data")
+
+// MetaStore keeps auxiliary records, such as configuration
+// of server features, in their own buckets of the Bolt
+// database holding the data. Unlike the data, records are
+// written immediately, traced as part of operations in contexts
+// passed to Put and Delete.
+type MetaStore struct {
+	dbName string
+}
+
+func NewMetaStore(dbName string) *MetaStore {
+	return &MetaStore{dbName: dbName}
+}
+
+// Load returns all records in bucket.
+// Absent bucket or database is treated as empty.
+func (m *MetaStore) Load(bucketName string) (map[string][]byte, error) {
+	records := make(map[string][]byte)
+	if _, err := os.Stat(m.dbName); os.IsNotExist(err) {
+		return records, nil
+	}
+	err := m.run(context.Background(), bucketName, true, func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucketName)); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				records[string(k)] = append([]byte{}, v...)
+				return nil
+			})
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Put places record under key in bucket, creating the bucket if needed.
+func (m *MetaStore) Put(ctx context.Context, bucketName, key string, record []byte) error {
+	return m.run(ctx, bucketName, false, func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(bucketName)); err == nil {
+			return b.Put([]byte(key), record)
+		} else {
+			return err
+		}
+	})
+}
+
+// Delete removes record under key from bucket.
+// Removing an absent record is not an error.
+func (m *MetaStore) Delete(ctx context.Context, bucketName, key string) error {
+	return m.run(ctx, bucketName, false, func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucketName)); b != nil {
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+// run opens the database and runs fn inside a transaction,
+// read-only if view.
+func (m *MetaStore) run(ctx context.Context, bucketName string, view bool, fn func(tx *bolt.Tx) error) (rerr error) {
+	if bucketName == bucket || strings.HasPrefix(bucketName, quarantineBucket) || strings.HasPrefix(bucketName, namespacePrefix) {
+		return ReservedBucketError
+	}
+	if db, err := bolt.Open(m.dbName, 0600, nil); err != nil {
+		return err
+	} else {
+		defer func() {
+			err := db.Close()
+			if rerr == nil {
+				rerr = err
+			}
+		}()
+		return transaction(ctx, db, !view, fn)
+	}
+}
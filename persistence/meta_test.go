@@ -0,0 +1,91 @@
+package persistence
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tracing"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMetaStore(t *testing.T) {
+	testDbName := "GWP_meta_test.db"
+	defer os.Remove(testDbName)
+	store := NewMetaStore(testDbName)
+
+	if records, err := store.Load("GWP_meta"); err != nil || len(records) != 0 {
+		t.Fatalf("wrong records of absent database: %v %v", records, err)
+	}
+	if err := store.Put(context.Background(), "GWP_meta", "key1", []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "GWP_meta", "key2", []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(context.Background(), "GWP_meta", "key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(context.Background(), "GWP_absent", "key1"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.Load("GWP_meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, map[string][]byte{"key2": {2}}) {
+		t.Errorf("wrong records: %v", records)
+	}
+
+	// Saving data must not remove other buckets.
+	dataStorage := storage.NewStorage()
+	dataStorage.Put("key", []byte{}, "")
+	if err := SaveToDb(dataStorage, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := store.Load("GWP_meta"); err != nil || len(records) != 1 {
+		t.Errorf("wrong records after save: %v %v", records, err)
+	}
+
+	for _, bucketName := range []string{bucket, quarantineBucket, namespaceBucket("ns"), quarantineOf(namespaceBucket("ns"))} {
+		if err := store.Put(context.Background(), bucketName, "key", []byte{}); err != ReservedBucketError {
+			t.Errorf("wrong error for %s: %v", bucketName, err)
+		}
+	}
+}
+
+type memoryExporter struct {
+	mut   sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (m *memoryExporter) Export(spans []tracing.SpanData) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func TestMetaStoreTracing(t *testing.T) {
+	testDbName := "GWP_meta_tracing_test.db"
+	defer os.Remove(testDbName)
+	exporter := &memoryExporter{}
+	tracer := tracing.NewTracer(exporter)
+	tracing.SetTracer(tracer)
+	ctx, request := tracing.Start(context.Background(), "request")
+	err := NewMetaStore(testDbName).Put(ctx, "GWP_meta", "key", []byte{1})
+	request.End()
+	tracing.SetTracer(nil)
+	tracer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("wrong spans: %+v", exporter.spans)
+	}
+	if update := exporter.spans[0]; update.Name != "bolt.Update" || update.Parent != request.Context().SpanId {
+		t.Errorf("transaction not traced as part of request: %+v", update)
+	}
+}
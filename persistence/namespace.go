@@ -0,0 +1,91 @@
+package persistence
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/boltdb/bolt"
+	"os"
+)
+
+// Prefix of buckets holding data of namespaces. Data of the default
+// namespace is kept in the bucket used by LoadFromDb and SaveToDb.
+const namespacePrefix = "GWP_ns_"
+
+func namespaceBucket(namespace string) string {
+	return namespacePrefix + namespace
+}
+
+// LoadNamespaceFromDb loads data of namespace from Bolt database
+// to storage, like LoadFromDb. Returns BucketAbsentError if
+// the namespace has no data.
+func LoadNamespaceFromDb(dataStorage storage.Storage, dbName, namespace string) error {
+	_, err := update(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return load(tx, namespaceBucket(namespace), dataStorage, false, true)
+	})
+	return err
+}
+
+// ReadNamespaceFromDb loads data of namespace from an existing
+// Bolt database to storage without modifying the database,
+// like ReadFromDb. Returns BucketAbsentError if the namespace
+// has no data.
+func ReadNamespaceFromDb(dataStorage storage.Storage, dbName, namespace string) error {
+	_, err := view(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return load(tx, namespaceBucket(namespace), dataStorage, false, false)
+	})
+	return err
+}
+
+// SaveNamespaceToDb saves storage contents to Bolt database
+// as data of namespace.
+func SaveNamespaceToDb(dataStorage storage.Storage, dbName, namespace string) error {
+	return save(dataStorage, dbName, namespaceBucket(namespace))
+}
+
+// DeleteNamespaceFromDb removes data of namespace from Bolt database,
+// traced as part of the operation in ctx.
+// Removing absent data is not an error.
+func DeleteNamespaceFromDb(ctx context.Context, dbName, namespace string) error {
+	if _, err := os.Stat(dbName); os.IsNotExist(err) {
+		return nil
+	}
+	_, err := update(ctx, dbName, func(tx *bolt.Tx) (Report, error) {
+		if err := tx.DeleteBucket([]byte(namespaceBucket(namespace))); err != nil && err != bolt.ErrBucketNotFound {
+			return Report{}, err
+		}
+		return Report{}, nil
+	})
+	return err
+}
+
+// NamespaceStore persists records of namespaces like MetaStore
+// and their data in separate buckets.
+type NamespaceStore struct {
+	*MetaStore
+}
+
+func NewNamespaceStore(dbName string) *NamespaceStore {
+	return &NamespaceStore{NewMetaStore(dbName)}
+}
+
+// LoadNamespace loads data of namespace to storage.
+// Absent data is treated as empty.
+func (n *NamespaceStore) LoadNamespace(dataStorage storage.Storage, namespace string) error {
+	if _, err := os.Stat(n.dbName); os.IsNotExist(err) {
+		return nil
+	}
+	if err := LoadNamespaceFromDb(dataStorage, n.dbName, namespace); err != BucketAbsentError {
+		return err
+	}
+	return nil
+}
+
+// SaveNamespace saves storage contents as data of namespace.
+func (n *NamespaceStore) SaveNamespace(dataStorage storage.Storage, namespace string) error {
+	return SaveNamespaceToDb(dataStorage, n.dbName, namespace)
+}
+
+// DeleteNamespace removes data of namespace.
+func (n *NamespaceStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return DeleteNamespaceFromDb(ctx, n.dbName, namespace)
+}
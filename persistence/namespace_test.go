@@ -0,0 +1,95 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	testDbName := "GWP_namespace_test.db"
+	defer os.Remove(testDbName)
+	if err := DeleteNamespaceFromDb(context.Background(), testDbName, "ns"); err != nil {
+		t.Fatal(err)
+	}
+
+	defaultStorage := storage.NewStorage()
+	defaultStorage.Put("key", []byte{1}, "default")
+	nsStorage := storage.NewStorage()
+	nsStorage.Put("key", []byte{2}, "ns")
+	if err := SaveToDb(defaultStorage, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNamespaceToDb(nsStorage, testDbName, "ns"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := storage.NewStorage()
+	if err := LoadNamespaceFromDb(loaded, testDbName, "ns"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Snapshot(), nsStorage.Snapshot()) {
+		t.Errorf("wrong namespace data: %v", loaded.Snapshot())
+	}
+	loaded = storage.NewStorage()
+	if err := LoadFromDb(loaded, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Snapshot(), defaultStorage.Snapshot()) {
+		t.Errorf("wrong default data: %v", loaded.Snapshot())
+	}
+
+	if err := DeleteNamespaceFromDb(context.Background(), testDbName, "ns"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadNamespaceFromDb(storage.NewStorage(), testDbName, "ns"); err != BucketAbsentError {
+		t.Errorf("wrong error after delete: %v", err)
+	}
+	if err := LoadFromDb(storage.NewStorage(), testDbName); err != nil {
+		t.Errorf("default data lost: %v", err)
+	}
+}
+
+func TestNamespacesRecovery(t *testing.T) {
+	testDbName := "GWP_namespace_recovery_test.db"
+	defer os.Remove(testDbName)
+	records := corruptRecords()
+	writeRecords(t, testDbName, records)
+	writeBucket(t, testDbName, namespaceBucket("ns"), records)
+
+	report, err := CheckDb(testDbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Loaded != 4 || report.Legacy != 2 || len(report.Corrupt) != 2 {
+		t.Errorf("wrong report: %v", report)
+	}
+	if namespaces := []string{report.Corrupt[0].Namespace, report.Corrupt[1].Namespace}; !reflect.DeepEqual(namespaces, []string{"", "ns"}) {
+		t.Errorf("wrong namespaces of corrupt records: %v", namespaces)
+	}
+	if err := LoadNamespaceFromDb(storage.NewStorage(), testDbName, "ns"); err == nil {
+		t.Error("corrupt namespace loaded")
+	}
+
+	dataStorage := storage.NewStorage()
+	if _, err := RecoverFromDb(dataStorage, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if len(dataStorage.Keys()) != 2 {
+		t.Errorf("namespace data loaded to storage: %v", dataStorage.Keys())
+	}
+	nsStorage := storage.NewStorage()
+	if err := LoadNamespaceFromDb(nsStorage, testDbName, "ns"); err != nil {
+		t.Fatalf("namespace not loadable after recovery: %v", err)
+	}
+	if len(nsStorage.Keys()) != 2 {
+		t.Errorf("wrong namespace keys: %v", nsStorage.Keys())
+	}
+	quarantined := readRecords(t, testDbName, quarantineOf(namespaceBucket("ns")))
+	if !bytes.Equal(quarantined["bad"], records["bad"]) {
+		t.Errorf("wrong quarantined record: %v", quarantined["bad"])
+	}
+}
@@ -1,21 +1,115 @@
 package persistence
 
 import (
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tracing"
 	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const (
-	bucket = "GWP" // bucket name inside Bolt database
+	bucket           = "GWP"            // bucket name inside Bolt database
+	quarantineBucket = "GWP_quarantine" // bucket for records which failed to deserialize
 )
 
+var BucketAbsentError = errors.New(fmt.Sprintf("bucket %s not present", bucket))
+
+// CorruptRecord describes a record which could not be deserialized.
+type CorruptRecord struct {
+	Key       string
+	Err       error
+	Namespace string // empty for the default namespace
+}
+
+func (c CorruptRecord) Error() string {
+	if c.Namespace != "" {
+		return fmt.Sprintf("namespace %s: record %s: %v", c.Namespace, c.Key, c.Err)
+	}
+	return fmt.Sprintf("record %s: %v", c.Key, c.Err)
+}
+
+// Report summarizes a pass over database contents.
+type Report struct {
+	Loaded  int             // records deserialized successfully
+	Legacy  int             // records stored in the legacy format
+	Corrupt []CorruptRecord // records which failed to deserialize
+}
+
+func (r *Report) add(other Report) {
+	r.Loaded += other.Loaded
+	r.Legacy += other.Legacy
+	r.Corrupt = append(r.Corrupt, other.Corrupt...)
+}
+
 // LoadFromDb loads Bolt database contents to storage.
-func LoadFromDb(dataStorage storage.Storage, dbName string) (rerr error) {
-	if db, err := bolt.Open(dbName, 0600, nil); err != nil {
-		return err
+// Records stored in the legacy format are rewritten
+// in the current format.
+// Loading stops at the first corrupt record, returning
+// it as CorruptRecord error.
+func LoadFromDb(dataStorage storage.Storage, dbName string) error {
+	_, err := update(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return load(tx, bucket, dataStorage, false, true)
+	})
+	return err
+}
+
+// RecoverFromDb loads Bolt database contents to storage,
+// skipping corrupt records. Corrupt records are moved
+// to a quarantine bucket and listed in the returned Report.
+// Records stored in the legacy format are rewritten
+// in the current format.
+// Data of namespaces is repaired likewise, so that it can
+// be loaded with LoadNamespaceFromDb afterwards.
+func RecoverFromDb(dataStorage storage.Storage, dbName string) (Report, error) {
+	return update(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return loadAll(tx, dataStorage, true, true)
+	})
+}
+
+// ReadFromDb loads contents of an existing Bolt database
+// to storage without modifying the database.
+// Legacy records are not migrated.
+func ReadFromDb(dataStorage storage.Storage, dbName string) error {
+	_, err := view(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return load(tx, bucket, dataStorage, false, false)
+	})
+	return err
+}
+
+// CheckDb verifies all records in an existing Bolt database,
+// including data of namespaces, without modifying it.
+func CheckDb(dbName string) (Report, error) {
+	return view(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return loadAll(tx, nil, true, false)
+	})
+}
+
+// RepairDb moves corrupt records of an existing Bolt database,
+// including data of namespaces, to quarantine buckets
+// and rewrites legacy records in the current format.
+func RepairDb(dbName string) (Report, error) {
+	if _, err := os.Stat(dbName); err != nil {
+		return Report{}, err
+	}
+	return update(context.Background(), dbName, func(tx *bolt.Tx) (Report, error) {
+		return loadAll(tx, nil, true, true)
+	})
+}
+
+// view runs fn inside a read-only transaction on an existing
+// Bolt database.
+func view(ctx context.Context, dbName string, fn func(tx *bolt.Tx) (Report, error)) (report Report, rerr error) {
+	if _, err := os.Stat(dbName); err != nil {
+		return Report{}, err
+	}
+	if db, err := bolt.Open(dbName, 0600, &bolt.Options{ReadOnly: true}); err != nil {
+		return Report{}, err
 	} else {
 		defer func() {
 			err := db.Close()
@@ -23,26 +117,185 @@ func LoadFromDb(dataStorage storage.Storage, dbName string) (rerr error) {
 				rerr = err
 			}
 		}()
-		return db.View(func(tx *bolt.Tx) error {
-			if gwp := tx.Bucket([]byte(bucket)); gwp != nil {
-				return gwp.ForEach(func(k, v []byte) error {
-					if data, err := deserializeData(v); err == nil {
-						dataStorage.Put(string(k), data.Object, data.ContentType)
-						return nil
-					} else {
-						// Unsuccessful deserialization means data inconsistency.
-						return err
-					}
-				})
-			} else {
-				return errors.New(fmt.Sprintf("bucket %s not present", bucket))
+		rerr = transaction(ctx, db, false, func(tx *bolt.Tx) error {
+			var err error
+			report, err = fn(tx)
+			return err
+		})
+		return report, rerr
+	}
+}
+
+// update runs fn inside a read-write transaction on Bolt database.
+func update(ctx context.Context, dbName string, fn func(tx *bolt.Tx) (Report, error)) (report Report, rerr error) {
+	if db, err := bolt.Open(dbName, 0600, nil); err != nil {
+		return Report{}, err
+	} else {
+		defer func() {
+			err := db.Close()
+			if rerr == nil {
+				rerr = err
 			}
+		}()
+		rerr = transaction(ctx, db, true, func(tx *bolt.Tx) error {
+			var err error
+			report, err = fn(tx)
+			return err
 		})
+		return report, rerr
+	}
+}
+
+// transaction runs fn inside a Bolt transaction, read-write
+// if writable, traced with a span child of the one in ctx.
+func transaction(ctx context.Context, db *bolt.DB, writable bool, fn func(tx *bolt.Tx) error) error {
+	name := "bolt.View"
+	if writable {
+		name = "bolt.Update"
+	}
+	_, span := tracing.Start(ctx, name)
+	defer span.End()
+	span.SetAttribute("db.name", db.Path())
+	var err error
+	if writable {
+		err = db.Update(fn)
+	} else {
+		err = db.View(fn)
+	}
+	span.SetError(err)
+	return err
+}
+
+// loadAll runs load on the data bucket, placing its records
+// in storage if it is not nil, and on buckets of all namespaces.
+func loadAll(tx *bolt.Tx, dataStorage storage.Storage, tolerant, write bool) (Report, error) {
+	report, err := load(tx, bucket, dataStorage, tolerant, write)
+	if err != nil {
+		return report, err
+	}
+	var namespaceBuckets []string
+	err = tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if strings.HasPrefix(string(name), namespacePrefix) {
+			namespaceBuckets = append(namespaceBuckets, string(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	// Buckets must not be created during ForEach.
+	for _, bucketName := range namespaceBuckets {
+		namespaceReport, err := load(tx, bucketName, nil, tolerant, write)
+		report.add(namespaceReport)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// load deserializes all records in bucketName, placing them in
+// storage if it is not nil.
+// If tolerant, corrupt records are skipped and reported instead
+// of stopping the load. If write, legacy records are rewritten
+// in the current format and corrupt ones moved to quarantine.
+func load(tx *bolt.Tx, bucketName string, dataStorage storage.Storage, tolerant, write bool) (Report, error) {
+	var report Report
+	gwp := tx.Bucket([]byte(bucketName))
+	if gwp == nil {
+		return report, BucketAbsentError
+	}
+
+	var namespace string
+	if strings.HasPrefix(bucketName, namespacePrefix) {
+		namespace = strings.TrimPrefix(bucketName, namespacePrefix)
+	}
+	migrated := make(map[string][]byte)
+	quarantined := make(map[string][]byte)
+	err := gwp.ForEach(func(k, v []byte) error {
+		if data, legacy, err := decodeRecord(v); err == nil {
+			report.Loaded++
+			if dataStorage != nil {
+				if err := dataStorage.Put(string(k), data.Object, data.ContentType); err != nil {
+					return err
+				}
+			}
+			if legacy {
+				report.Legacy++
+				migrated[string(k)] = serializeData(data)
+			}
+			return nil
+		} else {
+			// Unsuccessful deserialization means data inconsistency.
+			corrupt := CorruptRecord{string(k), err, namespace}
+			if !tolerant {
+				return corrupt
+			}
+			report.Corrupt = append(report.Corrupt, corrupt)
+			quarantined[string(k)] = append([]byte{}, v...)
+			return nil
+		}
+	})
+	if err != nil || !write {
+		return report, err
+	}
+
+	// Bucket must not be modified during ForEach.
+	for key, record := range migrated {
+		if err := gwp.Put([]byte(key), record); err != nil {
+			return report, err
+		}
+	}
+	if len(quarantined) > 0 {
+		quarantine, err := tx.CreateBucketIfNotExists([]byte(quarantineOf(bucketName)))
+		if err != nil {
+			return report, err
+		}
+		for key, record := range quarantined {
+			if err := quarantine.Put([]byte(key), record); err != nil {
+				return report, err
+			}
+			if err := gwp.Delete([]byte(key)); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// quarantineOf returns name of the quarantine bucket of bucketName,
+// GWP_quarantine for data of the default namespace
+// and GWP_quarantine_ns_{namespace} for others.
+func quarantineOf(bucketName string) string {
+	return quarantineBucket + strings.TrimPrefix(bucketName, bucket)
+}
+
+// CheckWritable checks that Bolt database can be written without
+// modifying it. If the database is absent, its directory must be writable.
+func CheckWritable(dbName string) error {
+	if file, err := os.OpenFile(dbName, os.O_WRONLY, 0); err == nil {
+		return file.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if file, err := ioutil.TempFile(filepath.Dir(dbName), ".gwp-check"); err == nil {
+		name := file.Name()
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return os.Remove(name)
+	} else {
+		return err
 	}
 }
 
 // SaveToDb saves storage contents to Bolt database.
-func SaveToDb(dataStorage storage.Storage, dbName string) (rerr error) {
+func SaveToDb(dataStorage storage.Storage, dbName string) error {
+	return save(dataStorage, dbName, bucket)
+}
+
+// save replaces contents of bucketName with storage contents.
+func save(dataStorage storage.Storage, dbName, bucketName string) (rerr error) {
 	if db, err := bolt.Open(dbName, 0600, nil); err != nil {
 		return err
 	} else {
@@ -52,9 +305,9 @@ func SaveToDb(dataStorage storage.Storage, dbName string) (rerr error) {
 				rerr = err
 			}
 		}()
-		return db.Update(func(tx *bolt.Tx) error {
-			_ = tx.DeleteBucket([]byte(bucket))
-			if gwp, err := tx.CreateBucket([]byte(bucket)); err == nil {
+		return transaction(context.Background(), db, true, func(tx *bolt.Tx) error {
+			_ = tx.DeleteBucket([]byte(bucketName))
+			if gwp, err := tx.CreateBucket([]byte(bucketName)); err == nil {
 				keys := dataStorage.Keys()
 				for _, key := range keys {
 					if data, err := dataStorage.Get(key); err == nil {
@@ -72,32 +325,3 @@ func SaveToDb(dataStorage storage.Storage, dbName string) (rerr error) {
 		})
 	}
 }
-
-// serializeData serializes storage.Data struct into byte slice.
-// First to bytes of slice contain ContentType as little endian uint16.
-// Further bytes contain ContentType and Object.
-func serializeData(data storage.Data) []byte {
-	contentType := []byte(data.ContentType)
-	contentTypeLen := len(contentType)
-	serialized := make([]byte, 2+contentTypeLen+len(data.Object))
-	binary.LittleEndian.PutUint16(serialized, uint16(contentTypeLen))
-	copy(serialized[2:], contentType)
-	copy(serialized[2+contentTypeLen:], data.Object)
-	return serialized
-}
-
-// deserializeData deserializes byte slice into storage.Data struct.
-// Deserializing struct serialized with serializeData will always
-// be successful.
-// deserializeData returns error on failure.
-func deserializeData(serialized []byte) (storage.Data, error) {
-	contentTypeLen := int(binary.LittleEndian.Uint16(serialized))
-	if len(serialized) < 2+contentTypeLen {
-		return storage.Data{}, errors.New("deseralization: invalid data")
-	} else {
-		contentType := string(serialized[2 : 2+contentTypeLen])
-		object := make([]byte, len(serialized)-2-contentTypeLen)
-		copy(object, serialized[2+contentTypeLen:])
-		return storage.Data{Object: object, ContentType: contentType}, nil
-	}
-}
@@ -6,45 +6,13 @@ import (
 	"fmt"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/boltdb/bolt"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
 )
 
-func TestSerialization(t *testing.T) {
-	dataSet := []storage.Data{
-		{[]byte{}, ""},
-		{[]byte{1, 2, 3, 4}, "type"},
-		{[]byte{}, "text"},
-		{[]byte{4, 4, 4}, ""},
-	}
-
-	for i, data := range dataSet {
-		t.Run(fmt.Sprint("data ", i), func(t *testing.T) {
-			serialized := serializeData(data)
-			deserialized, err := deserializeData(serialized)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if !bytes.Equal(data.Object, deserialized.Object) {
-				t.Errorf("object differs: %v", deserialized.Object)
-			}
-			if data.ContentType != deserialized.ContentType {
-				t.Errorf("content type differs: %v", deserialized.ContentType)
-			}
-		})
-	}
-
-	t.Run("invalid data deserialization", func(t *testing.T) {
-		serialized := make([]byte, 4)
-		binary.LittleEndian.PutUint16(serialized, 8)
-		if _, err := deserializeData(serialized); err == nil {
-			t.Error("deserialized invalid data")
-		}
-	})
-}
-
 func TestLoadSave(t *testing.T) {
 	testDbName := "GWP_test.db"
 	dataSets := [][]struct {
@@ -116,3 +84,271 @@ func TestLoadSave(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// legacyRecord serializes data in the format used before versioning.
+func legacyRecord(data storage.Data) []byte {
+	serialized := make([]byte, 2+len(data.ContentType)+len(data.Object))
+	binary.LittleEndian.PutUint16(serialized, uint16(len(data.ContentType)))
+	copy(serialized[2:], data.ContentType)
+	copy(serialized[2+len(data.ContentType):], data.Object)
+	return serialized
+}
+
+// writeRecords fills the data bucket in Bolt database with raw records.
+func writeRecords(t *testing.T, dbName string, records map[string][]byte) {
+	writeBucket(t, dbName, bucket, records)
+}
+
+// writeBucket fills bucket in Bolt database with raw records,
+// creating it if needed.
+func writeBucket(t *testing.T, dbName, bucketName string, records map[string][]byte) {
+	db, err := bolt.Open(dbName, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		gwp, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		for key, record := range records {
+			if err := gwp.Put([]byte(key), record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readRecords reads raw records from bucket in Bolt database.
+func readRecords(t *testing.T, dbName string, bucketName string) map[string][]byte {
+	db, err := bolt.Open(dbName, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(map[string][]byte)
+	err = db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucketName)); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				records[string(k)] = append([]byte{}, v...)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestLoadMigration(t *testing.T) {
+	testDbName := "GWP_migration_test.db"
+	legacy := map[string]storage.Data{
+		"old1": {Object: []byte{1, 2, 3}, ContentType: "type1"},
+		"old2": {Object: []byte{}, ContentType: ""},
+	}
+	current := map[string]storage.Data{
+		"new": {Object: []byte{4, 5}, ContentType: "type2"},
+	}
+
+	records := make(map[string][]byte)
+	for key, data := range legacy {
+		records[key] = legacyRecord(data)
+	}
+	for key, data := range current {
+		records[key] = serializeData(data)
+	}
+	writeRecords(t, testDbName, records)
+
+	dataStorage := storage.NewStorage()
+	if err := LoadFromDb(dataStorage, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range []map[string]storage.Data{legacy, current} {
+		for key, data := range set {
+			if loaded, err := dataStorage.Get(key); err != nil {
+				t.Errorf("key %v not loaded", key)
+			} else if !reflect.DeepEqual(data, loaded) {
+				t.Errorf("data differs: %v", loaded)
+			}
+		}
+	}
+
+	for key, record := range readRecords(t, testDbName, bucket) {
+		if _, legacy, err := decodeRecord(record); err != nil || legacy {
+			t.Errorf("record %s not migrated", key)
+		}
+	}
+
+	if err := os.Remove(testDbName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corruptRecords returns a set of raw records where
+// the key "bad" cannot be deserialized.
+func corruptRecords() map[string][]byte {
+	corrupted := serializeData(storage.Data{Object: []byte{1, 2, 3}, ContentType: "type"})
+	corrupted[len(corrupted)-1] ^= 0xff
+	return map[string][]byte{
+		"good":   serializeData(storage.Data{Object: []byte{1}, ContentType: "type"}),
+		"legacy": legacyRecord(storage.Data{Object: []byte{2}, ContentType: "type"}),
+		"bad":    corrupted,
+	}
+}
+
+func TestLoadCorrupted(t *testing.T) {
+	testDbName := "GWP_corrupted_test.db"
+	writeRecords(t, testDbName, corruptRecords())
+
+	err := LoadFromDb(storage.NewStorage(), testDbName)
+	if corrupt, ok := err.(CorruptRecord); !ok {
+		t.Errorf("wrong error: %v", err)
+	} else if corrupt.Key != "bad" || corrupt.Err != ChecksumError {
+		t.Errorf("wrong corrupt record: %v", corrupt)
+	}
+
+	if err := os.Remove(testDbName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverFromDb(t *testing.T) {
+	testDbName := "GWP_recover_test.db"
+	records := corruptRecords()
+	writeRecords(t, testDbName, records)
+
+	dataStorage := storage.NewStorage()
+	report, err := RecoverFromDb(dataStorage, testDbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Loaded != 2 || report.Legacy != 1 || len(report.Corrupt) != 1 {
+		t.Errorf("wrong report: %v", report)
+	}
+	keys := dataStorage.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"good", "legacy"}) {
+		t.Errorf("wrong keys loaded: %v", keys)
+	}
+
+	if _, present := readRecords(t, testDbName, bucket)["bad"]; present {
+		t.Error("corrupt record left in bucket")
+	}
+	quarantined := readRecords(t, testDbName, quarantineBucket)
+	if !bytes.Equal(quarantined["bad"], records["bad"]) {
+		t.Errorf("wrong quarantined record: %v", quarantined["bad"])
+	}
+
+	if err := LoadFromDb(storage.NewStorage(), testDbName); err != nil {
+		t.Errorf("database not loadable after recovery: %v", err)
+	}
+
+	if err := os.Remove(testDbName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRepairDb(t *testing.T) {
+	testDbName := "GWP_fsck_test.db"
+
+	if _, err := CheckDb(testDbName); err == nil {
+		t.Error("checked nonexistent database")
+	}
+	if _, err := RepairDb(testDbName); err == nil {
+		t.Error("repaired nonexistent database")
+	}
+	if _, err := os.Stat(testDbName); err == nil {
+		t.Fatal("database created")
+	}
+
+	records := corruptRecords()
+	writeRecords(t, testDbName, records)
+
+	report, err := CheckDb(testDbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Loaded != 2 || report.Legacy != 1 || len(report.Corrupt) != 1 {
+		t.Errorf("wrong report: %v", report)
+	}
+	if !reflect.DeepEqual(readRecords(t, testDbName, bucket), records) {
+		t.Error("database modified by check")
+	}
+
+	if _, err := RepairDb(testDbName); err != nil {
+		t.Fatal(err)
+	}
+	report, err = CheckDb(testDbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Loaded != 2 || report.Legacy != 0 || len(report.Corrupt) != 0 {
+		t.Errorf("wrong report after repair: %v", report)
+	}
+
+	if err := os.Remove(testDbName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadFromDb(t *testing.T) {
+	testDbName := "GWP_read_test.db"
+
+	if err := ReadFromDb(storage.NewStorage(), testDbName); err == nil {
+		t.Error("read nonexistent database")
+	}
+
+	records := map[string][]byte{
+		"legacy": legacyRecord(storage.Data{Object: []byte{1}, ContentType: "type"}),
+	}
+	writeRecords(t, testDbName, records)
+
+	dataStorage := storage.NewStorage()
+	if err := ReadFromDb(dataStorage, testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dataStorage.Get("legacy"); err != nil {
+		t.Error("record not loaded")
+	}
+	if !reflect.DeepEqual(readRecords(t, testDbName, bucket), records) {
+		t.Error("database modified")
+	}
+
+	if err := os.Remove(testDbName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	testDbName := "GWP_test.db"
+	defer os.Remove(testDbName)
+	if err := CheckWritable(testDbName); err != nil {
+		t.Errorf("absent database not writable: %v", err)
+	}
+	if _, err := os.Stat(testDbName); !os.IsNotExist(err) {
+		t.Error("check created the database")
+	}
+	if err := SaveToDb(storage.NewStorage(), testDbName); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritable(testDbName); err != nil {
+		t.Errorf("database not writable: %v", err)
+	}
+	if err := CheckWritable("GWP_absent/" + testDbName); err == nil {
+		t.Error("database in absent directory writable")
+	}
+	if err := CheckWritable("."); err == nil {
+		t.Error("directory writable as database")
+	}
+}
@@ -0,0 +1,153 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"hash/crc32"
+)
+
+// Record layout (all integers little endian):
+//
+//	bytes 0-1    recordMagic
+//	byte 2       format version
+//	bytes 3-6    CRC32 (IEEE) of bytes 7 onwards
+//	uvarint      number of metadata fields
+//	fields       uvarint tag, uvarint length, value
+//	remainder    object
+//
+// Unknown field tags are skipped, so new metadata can be added
+// without breaking older readers of the same version.
+//
+// Read as a legacy record, the magic would announce a 51199 bytes
+// long content type. Records starting with the magic are therefore
+// never treated as legacy ones.
+const (
+	recordMagic      = "\xff\xc7"
+	recordVersion    = 1
+	recordHeaderSize = 7
+)
+
+// Metadata field tags.
+const (
+	fieldContentType = 1
+)
+
+var (
+	InvalidRecordError  = errors.New("invalid record")
+	ChecksumError       = errors.New("record checksum mismatch")
+	UnknownVersionError = errors.New("unknown record version")
+)
+
+// serializeData serializes storage.Data struct into a versioned,
+// checksummed record.
+func serializeData(data storage.Data) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	body := make([]byte, 0, 3*binary.MaxVarintLen64+len(data.ContentType)+len(data.Object))
+
+	body = append(body, varint[:binary.PutUvarint(varint[:], 1)]...)
+	body = appendField(body, fieldContentType, []byte(data.ContentType))
+	body = append(body, data.Object...)
+
+	serialized := make([]byte, recordHeaderSize+len(body))
+	copy(serialized, recordMagic)
+	serialized[2] = recordVersion
+	binary.LittleEndian.PutUint32(serialized[3:], crc32.ChecksumIEEE(body))
+	copy(serialized[recordHeaderSize:], body)
+	return serialized
+}
+
+// appendField appends tag, length and value of a metadata field to buf.
+func appendField(buf []byte, tag uint64, value []byte) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	buf = append(buf, varint[:binary.PutUvarint(varint[:], tag)]...)
+	buf = append(buf, varint[:binary.PutUvarint(varint[:], uint64(len(value)))]...)
+	return append(buf, value...)
+}
+
+// deserializeData deserializes byte slice into storage.Data struct.
+// Both current and legacy records are accepted.
+// Deserializing struct serialized with serializeData will always
+// be successful.
+// deserializeData returns error on failure.
+func deserializeData(serialized []byte) (storage.Data, error) {
+	data, _, err := decodeRecord(serialized)
+	return data, err
+}
+
+// decodeRecord deserializes byte slice into storage.Data struct,
+// reporting whether the record was stored in the legacy format.
+func decodeRecord(serialized []byte) (data storage.Data, legacy bool, err error) {
+	if !hasMagic(serialized) {
+		data, err = decodeLegacy(serialized)
+		return data, err == nil, err
+	}
+	if len(serialized) < recordHeaderSize {
+		return storage.Data{}, false, InvalidRecordError
+	}
+	if serialized[2] != recordVersion {
+		return storage.Data{}, false, UnknownVersionError
+	}
+	checksum := binary.LittleEndian.Uint32(serialized[3:])
+	if crc32.ChecksumIEEE(serialized[recordHeaderSize:]) != checksum {
+		return storage.Data{}, false, ChecksumError
+	}
+	data, err = decodeCurrent(serialized)
+	return data, false, err
+}
+
+// hasMagic reports whether serialized starts with recordMagic.
+func hasMagic(serialized []byte) bool {
+	return len(serialized) >= len(recordMagic) && string(serialized[:len(recordMagic)]) == recordMagic
+}
+
+// decodeCurrent deserializes a record with a verified header and checksum.
+func decodeCurrent(serialized []byte) (storage.Data, error) {
+	body := serialized[recordHeaderSize:]
+	fieldCount, n := binary.Uvarint(body)
+	if n <= 0 {
+		return storage.Data{}, InvalidRecordError
+	}
+	body = body[n:]
+
+	var data storage.Data
+	for i := uint64(0); i < fieldCount; i++ {
+		tag, n := binary.Uvarint(body)
+		if n <= 0 {
+			return storage.Data{}, InvalidRecordError
+		}
+		body = body[n:]
+		length, n := binary.Uvarint(body)
+		if n <= 0 || uint64(len(body)-n) < length {
+			return storage.Data{}, InvalidRecordError
+		}
+		value := body[n : n+int(length)]
+		body = body[n+int(length):]
+
+		switch tag {
+		case fieldContentType:
+			data.ContentType = string(value)
+		}
+	}
+
+	data.Object = make([]byte, len(body))
+	copy(data.Object, body)
+	return data, nil
+}
+
+// decodeLegacy deserializes a record written before versioning.
+// First two bytes of such record contain ContentType length as
+// little endian uint16. Further bytes contain ContentType and Object.
+func decodeLegacy(serialized []byte) (storage.Data, error) {
+	if len(serialized) < 2 {
+		return storage.Data{}, InvalidRecordError
+	}
+	contentTypeLen := int(binary.LittleEndian.Uint16(serialized))
+	if len(serialized) < 2+contentTypeLen {
+		return storage.Data{}, InvalidRecordError
+	}
+	contentType := string(serialized[2 : 2+contentTypeLen])
+	object := make([]byte, len(serialized)-2-contentTypeLen)
+	copy(object, serialized[2+contentTypeLen:])
+	return storage.Data{Object: object, ContentType: contentType}, nil
+}
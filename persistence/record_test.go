@@ -0,0 +1,114 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func TestSerialization(t *testing.T) {
+	dataSet := []storage.Data{
+		{Object: []byte{}, ContentType: ""},
+		{Object: []byte{1, 2, 3, 4}, ContentType: "type"},
+		{Object: []byte{}, ContentType: "text"},
+		{Object: []byte{4, 4, 4}, ContentType: ""},
+	}
+
+	for i, data := range dataSet {
+		t.Run(fmt.Sprint("data ", i), func(t *testing.T) {
+			serialized := serializeData(data)
+			deserialized, err := deserializeData(serialized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data.Object, deserialized.Object) {
+				t.Errorf("object differs: %v", deserialized.Object)
+			}
+			if data.ContentType != deserialized.ContentType {
+				t.Errorf("content type differs: %v", deserialized.ContentType)
+			}
+		})
+	}
+
+	t.Run("invalid data deserialization", func(t *testing.T) {
+		serialized := make([]byte, 4)
+		binary.LittleEndian.PutUint16(serialized, 8)
+		if _, err := deserializeData(serialized); err == nil {
+			t.Error("deserialized invalid data")
+		}
+	})
+}
+
+func TestRecordFormat(t *testing.T) {
+	t.Run("long content type", func(t *testing.T) {
+		data := storage.Data{Object: []byte{1, 2}, ContentType: strings.Repeat("a", 70000)}
+		deserialized, err := deserializeData(serializeData(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deserialized.ContentType != data.ContentType {
+			t.Errorf("content type differs: %v", len(deserialized.ContentType))
+		}
+	})
+
+	t.Run("legacy record", func(t *testing.T) {
+		data := storage.Data{Object: []byte{1, 2, 3}, ContentType: "type"}
+		deserialized, legacy, err := decodeRecord(legacyRecord(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !legacy {
+			t.Error("legacy record not recognized")
+		}
+		if !bytes.Equal(deserialized.Object, data.Object) || deserialized.ContentType != data.ContentType {
+			t.Errorf("data differs: %v", deserialized)
+		}
+	})
+
+	t.Run("corrupted record", func(t *testing.T) {
+		serialized := serializeData(storage.Data{Object: []byte{1, 2, 3}, ContentType: "type"})
+		serialized[len(serialized)-1] ^= 0xff
+		if _, err := deserializeData(serialized); err != ChecksumError {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		serialized := serializeData(storage.Data{Object: []byte{}, ContentType: ""})
+		serialized[2] = recordVersion + 1
+		if _, err := deserializeData(serialized); err != UnknownVersionError {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		var varint [binary.MaxVarintLen64]byte
+		body := append([]byte{}, varint[:binary.PutUvarint(varint[:], 2)]...)
+		body = appendField(body, 100, []byte("future"))
+		body = appendField(body, fieldContentType, []byte("type"))
+		body = append(body, 7, 8)
+		serialized := serializeData(storage.Data{})[:recordHeaderSize]
+		serialized = append(serialized, body...)
+		binary.LittleEndian.PutUint32(serialized[3:], crc32.ChecksumIEEE(body))
+
+		deserialized, err := deserializeData(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deserialized.ContentType != "type" || !bytes.Equal(deserialized.Object, []byte{7, 8}) {
+			t.Errorf("data differs: %v", deserialized)
+		}
+	})
+
+	t.Run("truncated record", func(t *testing.T) {
+		for _, serialized := range [][]byte{{}, {1}, []byte(recordMagic)} {
+			if _, err := deserializeData(serialized); err == nil {
+				t.Errorf("deserialized invalid data: %v", serialized)
+			}
+		}
+	})
+}
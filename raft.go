@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/raftstorage"
+	"strings"
+)
+
+const (
+	raftAddress = "127.0.0.1:7000"
+	raftDirName = "raft"
+)
+
+// startRaft starts a Raft node communicating over TCP.
+// peers is a comma separated list of id=address pairs,
+// including the node itself.
+func startRaft(id, addr, dir, peers string, linearizable bool) (*raftstorage.RaftStorage, error) {
+	var parsed []raftstorage.Peer
+	if peers != "" {
+		for _, peer := range strings.Split(peers, ",") {
+			parts := strings.SplitN(peer, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid Raft peer %q, expected id=address", peer)
+			}
+			parsed = append(parsed, raftstorage.Peer{ID: parts[0], Address: parts[1]})
+		}
+	}
+	return raftstorage.NewTCP(id, addr, dir, parsed, linearizable)
+}
@@ -0,0 +1,91 @@
+package raftstorage
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/hashicorp/raft"
+	"io"
+	"sort"
+)
+
+// command is a mutation stored in Raft log.
+type command struct {
+	Op          storage.Op `json:"op"`
+	Key         string     `json:"key"`
+	ContentType string     `json:"contentType,omitempty"`
+	Object      []byte     `json:"object,omitempty"`
+}
+
+// fsm applies committed commands to local storage.
+// Snapshots are stored as archives.
+type fsm struct {
+	storage *storage.CmapStorage
+}
+
+// Apply returns error returned by local storage, if any.
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return err
+	}
+	switch cmd.Op {
+	case storage.OpPut:
+		if cmd.Object == nil {
+			cmd.Object = []byte{}
+		}
+		return f.storage.Put(cmd.Key, cmd.Object, cmd.ContentType)
+	case storage.OpDelete:
+		return f.storage.Delete(cmd.Key)
+	default:
+		return nil
+	}
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{f.storage.Snapshot()}, nil
+}
+
+func (f *fsm) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	values := make(map[string]storage.Data)
+	reader := archive.NewReader(snapshot)
+	for {
+		entry, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if entry.Object == nil {
+			entry.Object = []byte{}
+		}
+		values[entry.Key] = storage.Data{Object: entry.Object, ContentType: entry.ContentType}
+	}
+	f.storage.Restore(values)
+	return nil
+}
+
+type fsmSnapshot struct {
+	values map[string]storage.Data
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writer := archive.NewWriter(sink)
+	for _, key := range keys {
+		data := s.values[key]
+		if err := writer.Write(archive.Entry{Key: key, ContentType: data.ContentType, Object: data.Object}); err != nil {
+			_ = sink.Cancel()
+			return err
+		}
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
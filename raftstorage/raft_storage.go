@@ -0,0 +1,197 @@
+package raftstorage
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	applyTimeout     = 5 * time.Second
+	retainSnapshots  = 2
+	maxTransportPool = 3
+	transportTimeout = 10 * time.Second
+	logStoreName     = "raft.db"
+)
+
+// Peer is a member of Raft cluster.
+type Peer struct {
+	ID      string
+	Address string
+}
+
+// Config describes a node of Raft cluster.
+type Config struct {
+	ID string
+
+	// Peers are all members of the cluster, including this node.
+	// Used only to bootstrap a cluster without existing state.
+	Peers []Peer
+
+	Transport     raft.Transport
+	LogStore      raft.LogStore
+	StableStore   raft.StableStore
+	SnapshotStore raft.SnapshotStore
+
+	// If LinearizableReads, Get confirms leadership with a quorum
+	// before reading and fails on followers.
+	LinearizableReads bool
+
+	// Raft overrides default Raft settings if not nil.
+	// Its LocalID is always set to ID.
+	Raft *raft.Config
+
+	// LogOutput receives Raft logs, os.Stderr if nil.
+	LogOutput io.Writer
+}
+
+// RaftStorage is a storage.Storage replicating every mutation
+// through Raft log. Mutations succeed only on the leader,
+// other nodes return storage.UnavailableError.
+// Keys are always read from local state, which on followers
+// may lag behind the leader.
+type RaftStorage struct {
+	raft         *raft.Raft
+	fsm          *fsm
+	linearizable bool
+}
+
+// New starts a Raft node described by config.
+func New(config Config) (*RaftStorage, error) {
+	raftConfig := raft.DefaultConfig()
+	if config.Raft != nil {
+		copied := *config.Raft
+		raftConfig = &copied
+	}
+	raftConfig.LocalID = raft.ServerID(config.ID)
+	if config.LogOutput != nil {
+		raftConfig.LogOutput = config.LogOutput
+	}
+
+	f := &fsm{storage.NewCmapStorage()}
+	r, err := raft.NewRaft(raftConfig, f, config.LogStore, config.StableStore, config.SnapshotStore, config.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Peers) > 0 {
+		existing, err := raft.HasExistingState(config.LogStore, config.StableStore, config.SnapshotStore)
+		if err != nil {
+			_ = r.Shutdown().Error()
+			return nil, err
+		}
+		if !existing {
+			var servers []raft.Server
+			for _, peer := range config.Peers {
+				servers = append(servers, raft.Server{
+					ID:      raft.ServerID(peer.ID),
+					Address: raft.ServerAddress(peer.Address),
+				})
+			}
+			future := r.BootstrapCluster(raft.Configuration{Servers: servers})
+			if err := future.Error(); err != nil && err != raft.ErrCantBootstrap {
+				_ = r.Shutdown().Error()
+				return nil, err
+			}
+		}
+	}
+
+	return &RaftStorage{r, f, config.LinearizableReads}, nil
+}
+
+// NewTCP starts a Raft node communicating over TCP on bindAddr
+// and keeping its log and snapshots in dir.
+func NewTCP(id, bindAddr, dir string, peers []Peer, linearizableReads bool) (*RaftStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr("tcp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(bindAddr, addr, maxTransportPool, transportTimeout, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(dir, logStoreName))
+	if err != nil {
+		_ = transport.Close()
+		return nil, err
+	}
+	snapshotStore, err := raft.NewFileSnapshotStore(dir, retainSnapshots, os.Stderr)
+	if err != nil {
+		_ = transport.Close()
+		_ = logStore.Close()
+		return nil, err
+	}
+	return New(Config{
+		ID:                id,
+		Peers:             peers,
+		Transport:         transport,
+		LogStore:          logStore,
+		StableStore:       logStore,
+		SnapshotStore:     snapshotStore,
+		LinearizableReads: linearizableReads,
+	})
+}
+
+func (s *RaftStorage) Put(key string, object []byte, contentType string) error {
+	return s.apply(command{Op: storage.OpPut, Key: key, ContentType: contentType, Object: object})
+}
+
+func (s *RaftStorage) Get(key string) (storage.Data, error) {
+	if s.linearizable {
+		if err := s.raft.VerifyLeader().Error(); err != nil {
+			return storage.Data{}, storage.UnavailableError
+		}
+	}
+	return s.fsm.storage.Get(key)
+}
+
+func (s *RaftStorage) Delete(key string) error {
+	return s.apply(command{Op: storage.OpDelete, Key: key})
+}
+
+func (s *RaftStorage) Keys() []string {
+	return s.fsm.storage.Keys()
+}
+
+// Leader returns address of the current leader,
+// empty if there is no leader.
+func (s *RaftStorage) Leader() string {
+	return string(s.raft.Leader())
+}
+
+// IsLeader reports whether this node is the leader.
+func (s *RaftStorage) IsLeader() bool {
+	return s.raft.State() == raft.Leader
+}
+
+// Shutdown stops the node.
+func (s *RaftStorage) Shutdown() error {
+	return s.raft.Shutdown().Error()
+}
+
+// apply commits cmd and returns error returned by local
+// storage after applying it.
+func (s *RaftStorage) apply(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	future := s.raft.Apply(data, applyTimeout)
+	if err := future.Error(); err != nil {
+		// Not a leader, leadership lost or timed out.
+		return storage.UnavailableError
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
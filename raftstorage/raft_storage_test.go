@@ -0,0 +1,248 @@
+package raftstorage
+
+import (
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/hashicorp/raft"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newCluster starts nodes connected with in-memory transports.
+func newCluster(t *testing.T, size int, linearizable bool) []*RaftStorage {
+	var peers []Peer
+	var transports []*raft.InmemTransport
+	for i := 0; i < size; i++ {
+		addr, transport := raft.NewInmemTransport("")
+		peers = append(peers, Peer{fmt.Sprint("node", i), string(addr)})
+		transports = append(transports, transport)
+	}
+	for _, t1 := range transports {
+		for _, t2 := range transports {
+			if t1 != t2 {
+				t1.Connect(t2.LocalAddr(), t2)
+			}
+		}
+	}
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.HeartbeatTimeout = 50 * time.Millisecond
+	raftConfig.ElectionTimeout = 50 * time.Millisecond
+	raftConfig.LeaderLeaseTimeout = 50 * time.Millisecond
+	raftConfig.CommitTimeout = 5 * time.Millisecond
+
+	var nodes []*RaftStorage
+	for i, peer := range peers {
+		store := raft.NewInmemStore()
+		node, err := New(Config{
+			ID:                peer.ID,
+			Peers:             peers,
+			Transport:         transports[i],
+			LogStore:          store,
+			StableStore:       store,
+			SnapshotStore:     raft.NewInmemSnapshotStore(),
+			LinearizableReads: linearizable,
+			Raft:              raftConfig,
+			LogOutput:         ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func shutdown(t *testing.T, nodes []*RaftStorage) {
+	for _, node := range nodes {
+		if err := node.Shutdown(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// waitForLeader returns the leader once it is elected.
+func waitForLeader(t *testing.T, nodes []*RaftStorage) *RaftStorage {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, node := range nodes {
+			if node.IsLeader() {
+				return node
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("leader not elected")
+	return nil
+}
+
+// waitForState polls node until its local state equals values.
+func waitForState(t *testing.T, node *RaftStorage, values map[string]storage.Data) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(node.fsm.storage.Snapshot(), values) {
+		if time.Now().After(deadline) {
+			t.Fatalf("state not replicated: %v", node.fsm.storage.Snapshot())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForKnownLeader polls node until it knows a leader and returns it.
+func waitForKnownLeader(t *testing.T, node *RaftStorage) string {
+	deadline := time.Now().Add(5 * time.Second)
+	for node.Leader() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("leader not known")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return node.Leader()
+}
+
+func TestReplication(t *testing.T) {
+	nodes := newCluster(t, 3, false)
+	defer shutdown(t, nodes)
+	leader := waitForLeader(t, nodes)
+
+	if err := leader.Put("key1", []byte{1, 2}, "type"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Put("key2", []byte{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Delete("key2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Delete("absent"); err != storage.KeyAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	expected := map[string]storage.Data{"key1": {Object: []byte{1, 2}, ContentType: "type"}}
+	for _, node := range nodes {
+		waitForState(t, node, expected)
+		if keys := node.Keys(); !reflect.DeepEqual(keys, []string{"key1"}) {
+			t.Errorf("wrong keys: %v", keys)
+		}
+		if data, err := node.Get("key1"); err != nil || !reflect.DeepEqual(data, expected["key1"]) {
+			t.Errorf("wrong data: %v %v", data, err)
+		}
+	}
+}
+
+func TestFollowerWrites(t *testing.T) {
+	nodes := newCluster(t, 3, false)
+	defer shutdown(t, nodes)
+	leader := waitForLeader(t, nodes)
+
+	for _, node := range nodes {
+		if node == leader {
+			continue
+		}
+		if err := node.Put("key", []byte{}, ""); err != storage.UnavailableError {
+			t.Errorf("wrong error: %v", err)
+		}
+		if err := node.Delete("key"); err != storage.UnavailableError {
+			t.Errorf("wrong error: %v", err)
+		}
+		if known := waitForKnownLeader(t, node); known != leader.Leader() {
+			t.Errorf("wrong leader: %v", known)
+		}
+	}
+}
+
+func TestLinearizableReads(t *testing.T) {
+	nodes := newCluster(t, 3, true)
+	defer shutdown(t, nodes)
+	leader := waitForLeader(t, nodes)
+
+	if err := leader.Put("key", []byte{1}, "type"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.Get("key"); err != nil {
+		t.Errorf("leader read failed: %v", err)
+	}
+	for _, node := range nodes {
+		if node != leader {
+			if _, err := node.Get("key"); err != storage.UnavailableError {
+				t.Errorf("wrong error: %v", err)
+			}
+		}
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	nodes := newCluster(t, 3, false)
+	defer func() {
+		var running []*RaftStorage
+		for _, node := range nodes {
+			if node.raft.State() != raft.Shutdown {
+				running = append(running, node)
+			}
+		}
+		shutdown(t, running)
+	}()
+	leader := waitForLeader(t, nodes)
+	if err := leader.Put("key1", []byte{1}, "type"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rest []*RaftStorage
+	for _, node := range nodes {
+		if node != leader {
+			rest = append(rest, node)
+		}
+	}
+	newLeader := waitForLeader(t, rest)
+	if err := newLeader.Put("key2", []byte{2}, "type"); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range rest {
+		waitForState(t, node, map[string]storage.Data{
+			"key1": {Object: []byte{1}, ContentType: "type"},
+			"key2": {Object: []byte{2}, ContentType: "type"},
+		})
+		keys := node.Keys()
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"key1", "key2"}) {
+			t.Errorf("wrong keys: %v", keys)
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	original := &fsm{storage.NewCmapStorage()}
+	original.storage.Put("key1", []byte{1, 2}, "type")
+	original.storage.Put("key2", []byte{}, "")
+
+	snapshot, err := original.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &fsm{storage.NewCmapStorage()}
+	restored.storage.Put("stale", []byte{}, "")
+	if err := restored.Restore(reader); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(original.storage.Snapshot(), restored.storage.Snapshot()) {
+		t.Errorf("restored state differs: %v", restored.storage.Snapshot())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/client"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"time"
+)
+
+const remoteTimeout = 30
+
+// remoteStorage is storage.Storage backed by HTTP API
+// of a running server.
+// Storage interface does not allow reporting errors from
+// Keys, so the first failure is kept in err.
+type remoteStorage struct {
+	client *client.Client
+	err    error
+}
+
+// newRemoteStorage returns storage of namespace ns
+// of the server at url.
+func newRemoteStorage(url, ns string) *remoteStorage {
+	c := client.New(url)
+	if ns != namespace.Default {
+		c = c.Namespace(ns)
+	}
+	return &remoteStorage{client: c}
+}
+
+func (s *remoteStorage) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), remoteTimeout*time.Second)
+}
+
+func (s *remoteStorage) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *remoteStorage) Put(key string, object []byte, contentType string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.client.Put(ctx, key, bytes.NewReader(object), contentType)
+}
+
+func (s *remoteStorage) Get(key string) (storage.Data, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	object, err := s.client.Get(ctx, key)
+	if err != nil {
+		return storage.Data{}, err
+	}
+	defer object.Body.Close()
+	body, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		return storage.Data{}, err
+	}
+	return storage.Data{Object: body, ContentType: object.ContentType}, nil
+}
+
+func (s *remoteStorage) Delete(key string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.client.Delete(ctx, key)
+}
+
+func (s *remoteStorage) Keys() []string {
+	ctx, cancel := s.context()
+	defer cancel()
+	keys, err := s.client.List(ctx)
+	if err != nil {
+		s.setErr(err)
+		return nil
+	}
+	return keys
+}
@@ -0,0 +1,222 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/go-chi/chi"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+var StreamError = errors.New("malformed replication stream")
+
+// Replica is a local storage of a follower.
+type Replica interface {
+	storage.Storage
+	storage.Snapshotter
+}
+
+// Follower keeps a replica in sync with a leader.
+type Follower struct {
+	leader    string
+	replica   Replica
+	client    *http.Client
+	token     string
+	heartbeat time.Duration
+	mut       sync.Mutex
+	status    FollowerStatus
+}
+
+// NewFollower creates a follower of the leader
+// at address leaderUrl, e.g. http://127.0.0.1:8080.
+func NewFollower(leaderUrl string, replica Replica) *Follower {
+	leaderUrl = strings.TrimSuffix(leaderUrl, "/")
+	return &Follower{
+		leader:    leaderUrl,
+		replica:   replica,
+		client:    &http.Client{},
+		heartbeat: HeartbeatInterval,
+		status:    FollowerStatus{Role: "follower", Leader: leaderUrl},
+	}
+}
+
+// UseToken makes the follower authenticate to the leader with
+// bearer token, an admin API key or JWT, needed if the leader
+// requires authentication. Must be called before Run.
+func (f *Follower) UseToken(token string) {
+	f.token = token
+}
+
+// Run replicates leader storage until ctx is done,
+// reconnecting with exponential backoff after failures.
+func (f *Follower) Run(ctx context.Context) {
+	delay := minRetryDelay
+	for {
+		synced, err := f.replicate(ctx)
+		f.mut.Lock()
+		f.status.Connected = false
+		if err != nil {
+			f.status.LastError = err.Error()
+		}
+		f.mut.Unlock()
+		if synced {
+			delay = minRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// Status returns current replication state.
+func (f *Follower) Status() FollowerStatus {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.status
+}
+
+// Handler returns handler serving replication status,
+// to be mounted under Url.
+func (f *Follower) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get(StatusPath, func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJson(w, http.StatusOK, f.Status())
+	})
+	return router
+}
+
+// RedirectWrites redirects requests which could modify
+// storage to the leader with code http.StatusTemporaryRedirect.
+// Redirect preserves method and body of the request.
+func (f *Follower) RedirectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			http.Redirect(w, r, f.leader+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		}
+	})
+}
+
+// replicate connects to the leader and applies received stream.
+// Reports whether the replica was synced with leader snapshot.
+func (f *Follower) replicate(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodGet, f.leader+Url+StreamPath, nil)
+	if err != nil {
+		return false, err
+	}
+	if f.token != "" {
+		request.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	response, err := f.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("leader responded with %s", response.Status)
+	}
+
+	// Leader sends heartbeats, so silence means broken connection.
+	timeout := time.AfterFunc(3*f.heartbeat, cancel)
+	defer timeout.Stop()
+	dec := json.NewDecoder(response.Body)
+	read := func() (message, error) {
+		var msg message
+		err := dec.Decode(&msg)
+		timeout.Reset(3 * f.heartbeat)
+		return msg, err
+	}
+
+	header, err := read()
+	if err != nil {
+		return false, err
+	}
+	if header.Type != msgSnapshot {
+		return false, StreamError
+	}
+	values := make(map[string]storage.Data, header.Count)
+	for i := 0; i < header.Count; i++ {
+		entry, err := read()
+		if err != nil {
+			return false, err
+		}
+		if entry.Type != msgEntry {
+			return false, StreamError
+		}
+		values[entry.Key] = storage.Data{Object: nonNil(entry.Object), ContentType: entry.ContentType}
+	}
+	f.replica.Restore(values)
+	f.mut.Lock()
+	f.status.Connected = true
+	f.status.LastError = ""
+	f.status.AppliedSeq = header.Seq
+	// Leader may have restarted with a shorter history.
+	f.status.LeaderSeq = header.Seq
+	f.updateLeaderSeq(header.Seq)
+	f.mut.Unlock()
+
+	for {
+		msg, err := read()
+		if err != nil {
+			return true, err
+		}
+		switch msg.Type {
+		case msgPut:
+			if err := f.replica.Put(msg.Key, nonNil(msg.Object), msg.ContentType); err != nil {
+				return true, err
+			}
+		case msgDelete:
+			_ = f.replica.Delete(msg.Key)
+		case msgHeartbeat:
+		default:
+			return true, StreamError
+		}
+		f.mut.Lock()
+		if msg.Type != msgHeartbeat {
+			f.status.AppliedSeq = msg.Seq
+		}
+		f.updateLeaderSeq(msg.Seq)
+		f.mut.Unlock()
+	}
+}
+
+// updateLeaderSeq must be called with mut held.
+func (f *Follower) updateLeaderSeq(seq uint64) {
+	f.status.LastContact = time.Now()
+	if seq > f.status.LeaderSeq {
+		f.status.LeaderSeq = seq
+	}
+	f.status.Lag = 0
+	if f.status.LeaderSeq > f.status.AppliedSeq {
+		f.status.Lag = f.status.LeaderSeq - f.status.AppliedSeq
+	}
+}
+
+func nonNil(object []byte) []byte {
+	if object == nil {
+		return []byte{}
+	}
+	return object
+}
@@ -0,0 +1,148 @@
+package replication
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/go-chi/chi"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of mutations queued for a follower before
+// it is disconnected as too slow.
+const followerBuffer = 1024
+
+// Leader streams contents and mutations of storage to followers.
+type Leader struct {
+	storage   *storage.ObservableStorage
+	heartbeat time.Duration
+	mut       sync.Mutex
+	replicas  map[*ReplicaStatus]struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewLeader(dataStorage *storage.ObservableStorage) *Leader {
+	return &Leader{
+		storage:   dataStorage,
+		heartbeat: HeartbeatInterval,
+		replicas:  make(map[*ReplicaStatus]struct{}),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Handler returns handler serving replication stream and status,
+// to be mounted under Url.
+func (l *Leader) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get(StreamPath, l.serveStream)
+	router.Get(StatusPath, l.serveStatus)
+	return router
+}
+
+// Close disconnects all followers.
+// Should be called when server shuts down, since streams
+// never finish on their own.
+func (l *Leader) Close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+}
+
+// Status returns current replication state.
+func (l *Leader) Status() LeaderStatus {
+	seq := l.storage.Seq()
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	status := LeaderStatus{Role: "leader", Seq: seq, Followers: []ReplicaStatus{}}
+	for replica := range l.replicas {
+		replicaStatus := *replica
+		if seq > replicaStatus.SentSeq {
+			replicaStatus.Lag = seq - replicaStatus.SentSeq
+		}
+		status.Followers = append(status.Followers, replicaStatus)
+	}
+	sort.Slice(status.Followers, func(i, j int) bool {
+		return status.Followers[i].ConnectedSince.Before(status.Followers[j].ConnectedSince)
+	})
+	return status
+}
+
+// serveStream writes snapshot of storage followed by
+// subsequent mutations, until follower disconnects,
+// falls behind or storage contents are replaced.
+func (l *Leader) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.Internal, "streaming not supported")
+		return
+	}
+
+	snapshot, seq, subscription := l.storage.SubscribeWithSnapshot(followerBuffer)
+	defer subscription.Close()
+
+	replica := &ReplicaStatus{Address: r.RemoteAddr, ConnectedSince: time.Now(), SentSeq: seq}
+	l.mut.Lock()
+	l.replicas[replica] = struct{}{}
+	l.mut.Unlock()
+	defer func() {
+		l.mut.Lock()
+		delete(l.replicas, replica)
+		l.mut.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(message{Type: msgSnapshot, Seq: seq, Count: len(snapshot)}); err != nil {
+		return
+	}
+	for key, data := range snapshot {
+		entry := message{Type: msgEntry, Key: key, ContentType: data.ContentType, Object: data.Object}
+		if err := enc.Encode(entry); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(l.heartbeat)
+	defer ticker.Stop()
+	for {
+		var msg message
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			msg = message{Seq: event.Seq, Key: event.Key}
+			if event.Op == storage.OpPut {
+				msg.Type = msgPut
+				msg.ContentType = event.Data.ContentType
+				msg.Object = event.Data.Object
+			} else {
+				msg.Type = msgDelete
+			}
+		case <-ticker.C:
+			msg = message{Type: msgHeartbeat, Seq: l.storage.Seq()}
+		case <-r.Context().Done():
+			return
+		case <-l.closed:
+			return
+		}
+		if err := enc.Encode(msg); err != nil {
+			return
+		}
+		flusher.Flush()
+		if msg.Type != msgHeartbeat {
+			l.mut.Lock()
+			replica.SentSeq = msg.Seq
+			l.mut.Unlock()
+		}
+	}
+}
+
+func (l *Leader) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJson(w, http.StatusOK, l.Status())
+}
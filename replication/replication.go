@@ -0,0 +1,62 @@
+package replication
+
+import (
+	"time"
+)
+
+const (
+	Url               = "/api/replication"
+	StreamPath        = "/stream"
+	StatusPath        = "/status"
+	HeartbeatInterval = 1 * time.Second
+)
+
+// Message types sent from leader to followers.
+// Stream starts with msgSnapshot, followed by Count msgEntry
+// messages holding leader storage contents at Seq.
+// Further messages are mutations and heartbeats.
+const (
+	msgSnapshot  = "snapshot"
+	msgEntry     = "entry"
+	msgPut       = "put"
+	msgDelete    = "delete"
+	msgHeartbeat = "heartbeat"
+)
+
+// message is a single line of replication stream.
+type message struct {
+	Type        string `json:"type"`
+	Seq         uint64 `json:"seq,omitempty"`
+	Count       int    `json:"count,omitempty"`
+	Key         string `json:"key,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Object      []byte `json:"object,omitempty"`
+}
+
+// ReplicaStatus describes a follower connected to a leader.
+type ReplicaStatus struct {
+	Address        string    `json:"address"`
+	ConnectedSince time.Time `json:"connectedSince"`
+	SentSeq        uint64    `json:"sentSeq"`
+	Lag            uint64    `json:"lag"`
+}
+
+// LeaderStatus describes replication state of a leader.
+type LeaderStatus struct {
+	Role      string          `json:"role"`
+	Seq       uint64          `json:"seq"`
+	Followers []ReplicaStatus `json:"followers"`
+}
+
+// FollowerStatus describes replication state of a follower.
+// Lag is the number of leader mutations not yet applied.
+type FollowerStatus struct {
+	Role        string    `json:"role"`
+	Leader      string    `json:"leader"`
+	Connected   bool      `json:"connected"`
+	AppliedSeq  uint64    `json:"appliedSeq"`
+	LeaderSeq   uint64    `json:"leaderSeq"`
+	Lag         uint64    `json:"lag"`
+	LastContact time.Time `json:"lastContact"`
+	LastError   string    `json:"lastError,omitempty"`
+}
@@ -0,0 +1,226 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cluster is a leader and a follower, each served by its own httptest.Server.
+type cluster struct {
+	leaderStorage   *storage.ObservableStorage
+	followerStorage *storage.ObservableStorage
+	leader          *Leader
+	follower        *Follower
+	leaderServer    *httptest.Server
+	followerServer  *httptest.Server
+	stop            context.CancelFunc
+}
+
+func newCluster(t *testing.T) *cluster {
+	c := &cluster{
+		leaderStorage:   storage.NewObservableStorage(storage.NewStorage()),
+		followerStorage: storage.NewObservableStorage(storage.NewStorage()),
+	}
+	c.leaderStorage.Put("initial", []byte{1}, "type")
+	c.followerStorage.Put("stale", []byte{}, "")
+
+	leaderRouter := router.NewRouter(c.leaderStorage)
+	c.leader = NewLeader(c.leaderStorage)
+	c.leader.heartbeat = 10 * time.Millisecond
+	leaderRouter.Mount(Url, c.leader.Handler())
+	c.leaderServer = httptest.NewServer(leaderRouter)
+
+	followerRouter := router.NewRouter(c.followerStorage)
+	c.follower = NewFollower(c.leaderServer.URL, c.followerStorage)
+	c.follower.heartbeat = 10 * time.Millisecond
+	followerRouter.Mount(Url, c.follower.Handler())
+	c.followerServer = httptest.NewServer(c.follower.RedirectWrites(followerRouter))
+
+	var ctx context.Context
+	ctx, c.stop = context.WithCancel(context.Background())
+	go c.follower.Run(ctx)
+	return c
+}
+
+func (c *cluster) close() {
+	c.stop()
+	c.leader.Close()
+	c.followerServer.Close()
+	c.leaderServer.Close()
+}
+
+// waitFor polls condition until it holds or a second passes.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (c *cluster) waitForSync(t *testing.T) {
+	waitFor(t, func() bool {
+		return reflect.DeepEqual(c.leaderStorage.Snapshot(), c.followerStorage.Snapshot())
+	})
+}
+
+func TestReplication(t *testing.T) {
+	c := newCluster(t)
+	defer c.close()
+
+	c.waitForSync(t)
+
+	c.leaderStorage.Put("key", []byte{1, 2, 3}, "type")
+	c.leaderStorage.Put("empty", []byte{}, "")
+	if err := c.leaderStorage.Delete("initial"); err != nil {
+		t.Fatal(err)
+	}
+	c.waitForSync(t)
+
+	c.leaderStorage.Restore(map[string]storage.Data{"restored": {Object: []byte{4}, ContentType: "type"}})
+	c.waitForSync(t)
+
+	waitFor(t, func() bool {
+		status := c.follower.Status()
+		return status.Connected && status.Lag == 0 && status.AppliedSeq == c.leaderStorage.Seq()
+	})
+	waitFor(t, func() bool {
+		status := c.leader.Status()
+		return len(status.Followers) == 1 && status.Followers[0].Lag == 0
+	})
+}
+
+// adminToken accepts only itself, as a token of an admin.
+type adminToken string
+
+func (a adminToken) Verify(token string) (*auth.Identity, error) {
+	if token != string(a) {
+		return nil, errors.New("invalid token")
+	}
+	return &auth.Identity{Name: "admin", Admin: true}, nil
+}
+
+func TestFollowerAuthenticates(t *testing.T) {
+	leaderStorage := storage.NewObservableStorage(storage.NewStorage())
+	leaderStorage.Put("initial", []byte{1}, "type")
+	leaderRouter := router.NewRouter(leaderStorage)
+	leader := NewLeader(leaderStorage)
+	defer leader.Close()
+	leaderRouter.Mount(Url, leader.Handler())
+	leaderServer := httptest.NewServer(auth.NewAuthenticator(adminToken("secret")).Middleware(leaderRouter))
+	defer leaderServer.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	anonymous := NewFollower(leaderServer.URL, storage.NewObservableStorage(storage.NewStorage()))
+	go anonymous.Run(ctx)
+	followerStorage := storage.NewObservableStorage(storage.NewStorage())
+	follower := NewFollower(leaderServer.URL, followerStorage)
+	follower.UseToken("secret")
+	go follower.Run(ctx)
+
+	waitFor(t, func() bool {
+		return reflect.DeepEqual(leaderStorage.Snapshot(), followerStorage.Snapshot())
+	})
+	waitFor(t, func() bool {
+		return strings.Contains(anonymous.Status().LastError, "401")
+	})
+	if anonymous.Status().Connected {
+		t.Error("follower without token connected")
+	}
+}
+
+func TestFollowerServesReads(t *testing.T) {
+	c := newCluster(t)
+	defer c.close()
+	c.waitForSync(t)
+
+	response, err := http.Get(c.followerServer.URL + router.ObjectsUrl + "/initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("wrong response code: %v", response.StatusCode)
+	}
+}
+
+func TestFollowerRedirectsWrites(t *testing.T) {
+	c := newCluster(t)
+	defer c.close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	request, _ := http.NewRequest(http.MethodPut, c.followerServer.URL+router.ObjectsUrl+"/key", bytes.NewReader([]byte{1}))
+	request.Header.Set("Content-Type", "type")
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("wrong response code: %v", response.StatusCode)
+	}
+	if location := response.Header.Get("Location"); location != c.leaderServer.URL+router.ObjectsUrl+"/key" {
+		t.Errorf("wrong location: %v", location)
+	}
+
+	// Default client follows the redirect, resending the body.
+	request, _ = http.NewRequest(http.MethodPut, c.followerServer.URL+router.ObjectsUrl+"/key", bytes.NewReader([]byte{1}))
+	request.Header.Set("Content-Type", "type")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		t.Errorf("wrong response code: %v", response.StatusCode)
+	}
+	c.waitForSync(t)
+}
+
+func TestStatusEndpoints(t *testing.T) {
+	c := newCluster(t)
+	defer c.close()
+	c.waitForSync(t)
+
+	var leaderStatus LeaderStatus
+	getJson(t, c.leaderServer.URL+Url+StatusPath, &leaderStatus)
+	if leaderStatus.Role != "leader" || leaderStatus.Seq != c.leaderStorage.Seq() {
+		t.Errorf("wrong leader status: %v", leaderStatus)
+	}
+
+	var followerStatus FollowerStatus
+	getJson(t, c.followerServer.URL+Url+StatusPath, &followerStatus)
+	if followerStatus.Role != "follower" || followerStatus.Leader != c.leaderServer.URL {
+		t.Errorf("wrong follower status: %v", followerStatus)
+	}
+}
+
+func getJson(t *testing.T, url string, value interface{}) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response code: %v", response.StatusCode)
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatal(err)
+	}
+}
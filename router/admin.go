@@ -0,0 +1,111 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/archive"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+const (
+	AdminUrl          = "/api/admin"
+	SnapshotMediaType = "application/x-ndjson"
+)
+
+// getBackup(snapshotter) writes a point in time snapshot of storage
+// into body as an archive.
+func getBackup(snapshotter storage.Snapshotter) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		snapshot := snapshotter.Snapshot()
+		keys := make([]string, 0, len(snapshot))
+		for key := range snapshot {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		w.Header().Set("Content-Type", SnapshotMediaType)
+		w.Header().Set("Content-Disposition", `attachment; filename="backup.ndjson"`)
+		writer := archive.NewWriter(w)
+		for _, key := range keys {
+			data := snapshot[key]
+			if err := writer.Write(archive.Entry{Key: key, ContentType: data.ContentType, Object: data.Object}); err != nil {
+				panic(err)
+			}
+		}
+	})
+}
+
+// bodyReader remembers errors of reading request's body,
+// to tell them apart from malformed entries.
+type bodyReader struct {
+	io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// postRestore(snapshotter, maxSize) replaces storage contents with
+// a snapshot read from request's body.
+// Snapshot is validated before the swap. If it contains
+// malformed entries, invalid keys, duplicate keys or too big
+// objects, writes code http.StatusBadRequest with code
+// apierror.BadRequest, describing the first invalid entry,
+// and leaves storage unchanged. If the body exceeds maxSize
+// bytes, writes code http.StatusRequestEntityTooLarge
+// with code apierror.BadRequest. If reading the body fails
+// otherwise, e.g. it is cut short, writes code
+// http.StatusBadRequest with code apierror.BadRequest.
+// Writes code http.StatusNoContent otherwise.
+func postRestore(snapshotter storage.Snapshotter, maxSize int64) http.HandlerFunc {
+	regex := regexp.MustCompile(KeyPattern)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := make(map[string]storage.Data)
+		body := &bodyReader{Reader: http.MaxBytesReader(w, r.Body, maxSize)}
+		reader := archive.NewReader(body)
+		for {
+			entry, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if tooLarge := new(http.MaxBytesError); errors.As(body.err, &tooLarge) {
+				apierror.WriteDetails(w, r, http.StatusRequestEntityTooLarge, apierror.BadRequest,
+					fmt.Sprintf("snapshot must not exceed %d bytes", maxSize), map[string]int64{"maxSize": maxSize})
+				return
+			} else if body.err != nil {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "reading snapshot failed: "+body.err.Error())
+				return
+			} else if err != nil {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, err.Error())
+				return
+			}
+			var problem string
+			if _, duplicate := values[entry.Key]; duplicate {
+				problem = "duplicate key"
+			} else if !regex.MatchString(entry.Key) {
+				problem = "key must match " + KeyPattern
+			} else if len(entry.Object) > MaxObjectSize {
+				problem = fmt.Sprintf("object must not exceed %d bytes", MaxObjectSize)
+			}
+			if problem != "" {
+				apierror.WriteDetails(w, r, http.StatusBadRequest, apierror.BadRequest, problem, map[string]string{"key": entry.Key})
+				return
+			}
+			if entry.Object == nil {
+				entry.Object = []byte{}
+			}
+			values[entry.Key] = storage.Data{Object: entry.Object, ContentType: entry.ContentType}
+		}
+		snapshotter.Restore(values)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
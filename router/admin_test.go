@@ -0,0 +1,134 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEndpointBackupRestore(t *testing.T) {
+	keySets := [][]string{
+		{},
+		{"key"},
+		{"alpha", "beta", "gamma"},
+	}
+
+	for i, keySet := range keySets {
+		t.Run(fmt.Sprint("set ", i), func(t *testing.T) {
+			original := prepopulatedStorage(keySet)
+			original.Put("object", []byte{1, 2, 3}, "type")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", AdminUrl+"/backup", nil)
+			NewRouter(original).ServeHTTP(w, r)
+			assertCodesEqual(t, w, http.StatusOK)
+			assertContentTypeEqual(t, w, SnapshotMediaType)
+
+			restored := prepopulatedStorage([]string{"stale"})
+			w2 := httptest.NewRecorder()
+			r = httptest.NewRequest("POST", AdminUrl+"/restore", bytes.NewReader(w.Body.Bytes()))
+			NewRouter(restored).ServeHTTP(w2, r)
+			assertCodesEqual(t, w2, http.StatusNoContent)
+
+			originalKeys := original.Keys()
+			restoredKeys := restored.Keys()
+			sort.Strings(originalKeys)
+			sort.Strings(restoredKeys)
+			if !reflect.DeepEqual(originalKeys, restoredKeys) {
+				t.Fatalf("keys differ: %v", restoredKeys)
+			}
+			for _, key := range originalKeys {
+				originalData, _ := original.Get(key)
+				restoredData, _ := restored.Get(key)
+				if !reflect.DeepEqual(originalData, restoredData) {
+					t.Errorf("data differs: %v", restoredData)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointRestoreInvalid(t *testing.T) {
+	bigObject := fmt.Sprintf(`{"key":"big","contentType":"","object":"%s"}`,
+		strings.Repeat("A", (MaxObjectSize/3+1)*4))
+	snapshots := []string{
+		`{"key":"a-b","contentType":"","object":""}`,
+		`{"key":"a","contentType":"","object":""}` + "\n" + `{"key":"a","contentType":"","object":""}`,
+		`{"key":"a","contentType":""`,
+		bigObject,
+	}
+
+	for i, snapshot := range snapshots {
+		t.Run(fmt.Sprint("snapshot ", i), func(t *testing.T) {
+			dataStorage := prepopulatedStorage([]string{"key"})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", AdminUrl+"/restore", strings.NewReader(snapshot))
+			NewRouter(dataStorage).ServeHTTP(w, r)
+
+			assertCodesEqual(t, w, http.StatusBadRequest)
+			if keys := dataStorage.Keys(); !reflect.DeepEqual(keys, []string{"key"}) {
+				t.Errorf("invalid storage state: %v", keys)
+			}
+		})
+	}
+}
+
+func TestEndpointRestoreTooLarge(t *testing.T) {
+	dataStorage := prepopulatedStorage([]string{"key"})
+	snapshot := `{"key":"a","contentType":"","object":""}` + "\n" + `{"key":"b","contentType":"","object":""}`
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", AdminUrl+"/restore", strings.NewReader(snapshot))
+	NewRouterWithRestoreLimit(dataStorage, int64(len(snapshot)-1)).ServeHTTP(w, r)
+	assertCodesEqual(t, w, http.StatusRequestEntityTooLarge)
+	if keys := dataStorage.Keys(); !reflect.DeepEqual(keys, []string{"key"}) {
+		t.Errorf("invalid storage state: %v", keys)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", AdminUrl+"/restore", strings.NewReader(snapshot))
+	NewRouterWithRestoreLimit(dataStorage, int64(len(snapshot))).ServeHTTP(w, r)
+	assertCodesEqual(t, w, http.StatusNoContent)
+}
+
+func TestEndpointRestoreBrokenBody(t *testing.T) {
+	dataStorage := prepopulatedStorage([]string{"key"})
+	snapshot := `{"key":"a","contentType":"","object":""}` + "\n"
+	body := io.MultiReader(strings.NewReader(snapshot), iotest.ErrReader(io.ErrUnexpectedEOF))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", AdminUrl+"/restore", body)
+	NewRouter(dataStorage).ServeHTTP(w, r)
+	assertCodesEqual(t, w, http.StatusBadRequest)
+	if keys := dataStorage.Keys(); !reflect.DeepEqual(keys, []string{"key"}) {
+		t.Errorf("invalid storage state: %v", keys)
+	}
+}
+
+func TestEndpointBackupConcurrent(t *testing.T) {
+	dataStorage := storage.NewStorage()
+	handler := NewRouter(dataStorage)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			dataStorage.Put(fmt.Sprint("key", i), []byte{byte(i)}, "type")
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", AdminUrl+"/backup", nil))
+		assertCodesEqual(t, w, http.StatusOK)
+	}
+	<-done
+}
@@ -2,12 +2,16 @@ package router
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tracing"
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
 )
 
 const (
@@ -16,30 +20,57 @@ const (
 	ObjectsUrl    = "/api/objects"
 )
 
+// DefaultMaxRestoreSize is the default limit of restored snapshots, in bytes.
+const DefaultMaxRestoreSize = 256 << 20
+
 func NewRouter(dataStorage storage.Storage) *chi.Mux {
+	return NewRouterWithRestoreLimit(dataStorage, DefaultMaxRestoreSize)
+}
+
+// NewRouterWithRestoreLimit works like NewRouter, accepting restored
+// snapshots of at most maxRestoreSize bytes, which are held in memory.
+func NewRouterWithRestoreLimit(dataStorage storage.Storage, maxRestoreSize int64) *chi.Mux {
 	router := chi.NewRouter()
 
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
-
-	router.Route(ObjectsUrl, func(router chi.Router) {
-		router.Get("/", getAllObjects(dataStorage))
-		router.Route("/{key}", func(router chi.Router) {
-			router.Use(checkKey)
-			router.With(
-				requireContentTypeHeader,
-				limitBodySize,
-			).Put("/", putObject(dataStorage))
-			router.Get("/", getObject(dataStorage))
-			router.Delete("/", deleteObject(dataStorage))
+	router.Use(apierror.Recoverer)
+	router.NotFound(apierror.NotFoundHandler)
+	router.MethodNotAllowed(apierror.MethodNotAllowedHandler)
+
+	router.Mount(ObjectsUrl, ObjectsHandler(dataStorage))
+
+	if snapshotter, ok := dataStorage.(storage.Snapshotter); ok {
+		router.Route(AdminUrl, func(router chi.Router) {
+			router.Get("/backup", getBackup(snapshotter))
+			router.Post("/restore", postRestore(snapshotter, maxRestoreSize))
 		})
-	})
+	}
 
 	return router
 }
 
+// ObjectsHandler returns handler of objects in storage,
+// to be mounted under ObjectsUrl or another path.
+func ObjectsHandler(dataStorage storage.Storage) http.Handler {
+	router := chi.NewRouter()
+	// Set here too, since the handler may be mounted
+	// behind handlers other than chi routers.
+	router.NotFound(apierror.NotFoundHandler)
+	router.MethodNotAllowed(apierror.MethodNotAllowedHandler)
+	router.Get("/", getAllObjects(dataStorage))
+	router.Route("/{key}", func(router chi.Router) {
+		router.Use(checkKey)
+		router.With(
+			requireContentTypeHeader,
+			limitBodySize,
+		).Put("/", putObject(dataStorage))
+		router.Get("/", getObject(dataStorage))
+		router.Delete("/", deleteObject(dataStorage))
+	})
+	return router
+}
+
 // checkKey stops requests without valid key parameter,
-// writing code http.StatusBadRequest.
+// writing code http.StatusBadRequest with code apierror.InvalidKey.
 func checkKey(next http.Handler) http.Handler {
 	regex := regexp.MustCompile(KeyPattern)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -47,17 +78,18 @@ func checkKey(next http.Handler) http.Handler {
 		if match := regex.MatchString(key); match {
 			next.ServeHTTP(w, r)
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
+			apierror.WriteDetails(w, r, http.StatusBadRequest, apierror.InvalidKey,
+				"key must match "+KeyPattern, map[string]string{"key": key})
 		}
 	})
 }
 
 // requireContentTypeHeader stops requests without Content-Type header,
-// writing code http.StatusBadRequest.
+// writing code http.StatusBadRequest with code apierror.MissingContentType.
 func requireContentTypeHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if ct := r.Header.Get("Content-Type"); ct == "" {
-			w.WriteHeader(http.StatusBadRequest)
+			apierror.Write(w, r, http.StatusBadRequest, apierror.MissingContentType, "Content-Type header is required")
 		} else {
 			next.ServeHTTP(w, r)
 		}
@@ -76,17 +108,26 @@ func limitBodySize(next http.Handler) http.Handler {
 
 // putObject(storage) places request's body Content-Type header
 // in storage under request's key parameter.
-// If request's body is too big, writes code http.StatusRequestEntityTooLarge.
+// If request's body is too big, writes code http.StatusRequestEntityTooLarge
+// with code apierror.ObjectTooLarge.
+// If storage rejects the write, writes error chosen by writeStorageError.
 // Writes code http.StatusCreated otherwise.
 func putObject(dataStorage storage.Storage) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if object, err := ioutil.ReadAll(r.Body); err == nil {
 			key := chi.URLParam(r, "key")
 			contentType := r.Header.Get("Content-Type")
-			dataStorage.Put(key, object, contentType)
-			w.WriteHeader(http.StatusCreated)
+			err := traced(r, "Put", key, func() error {
+				return dataStorage.Put(key, object, contentType)
+			})
+			if err == nil {
+				w.WriteHeader(http.StatusCreated)
+			} else {
+				writeStorageError(w, r, err, key)
+			}
 		} else {
-			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			apierror.WriteDetails(w, r, http.StatusRequestEntityTooLarge, apierror.ObjectTooLarge,
+				fmt.Sprintf("object must not exceed %d bytes", MaxObjectSize), map[string]int{"maxSize": MaxObjectSize})
 		}
 	})
 }
@@ -96,17 +137,45 @@ func putObject(dataStorage storage.Storage) http.HandlerFunc {
 // On successful retrieve, writes Object part of the data
 // into body and sets Content-Type header to
 // ContentType part of the data.
-// Writes code http.StatusNotFound otherwise.
+// Writes error chosen by writeStorageError otherwise.
+// If storage is a storage.Watcher, VersionHeader is set
+// to version of the key and the query may block as described
+// in waitForChange. Writes code http.StatusBadRequest
+// with code apierror.BadRequest if its parameters are invalid.
 func getObject(dataStorage storage.Storage) http.HandlerFunc {
+	watcher, watchable := dataStorage.(storage.Watcher)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		key := chi.URLParam(r, "key")
-		if val, err := dataStorage.Get(key); err == nil {
+		var val storage.Data
+		var err error
+		if watchable {
+			if err := traced(r, "Wait", key, func() error {
+				return waitForChange(watcher, key, r)
+			}); err != nil {
+				apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, err.Error())
+				return
+			}
+			var version uint64
+			err = traced(r, "Get", key, func() error {
+				var err error
+				val, version, err = watcher.GetWithVersion(key)
+				return err
+			})
+			w.Header().Set(VersionHeader, strconv.FormatUint(version, 10))
+		} else {
+			err = traced(r, "Get", key, func() error {
+				var err error
+				val, err = dataStorage.Get(key)
+				return err
+			})
+		}
+		if err == nil {
 			w.Header().Set("Content-Type", val.ContentType)
 			if _, err := w.Write(val.Object); err != nil {
 				panic(err)
 			}
 		} else {
-			w.WriteHeader(http.StatusNotFound)
+			writeStorageError(w, r, err, key)
 		}
 	})
 }
@@ -114,23 +183,67 @@ func getObject(dataStorage storage.Storage) http.HandlerFunc {
 // deleteObject(storage) deletes data stored in storage
 // under request's key parameter.
 // On successful delete, writes code http.StatusNoContent.
-// Writes code http.StatusNotFound otherwise.
+// Writes error chosen by writeStorageError otherwise.
 func deleteObject(dataStorage storage.Storage) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		key := chi.URLParam(r, "key")
-		if err := dataStorage.Delete(key); err == nil {
+		err := traced(r, "Delete", key, func() error {
+			return dataStorage.Delete(key)
+		})
+		if err == nil {
 			w.WriteHeader(http.StatusNoContent)
 		} else {
-			w.WriteHeader(http.StatusNotFound)
+			writeStorageError(w, r, err, key)
 		}
 	})
 }
 
+// writeStorageError writes error response for an error returned
+// by storage for key: http.StatusNotFound for storage.KeyAbsentError,
+// http.StatusServiceUnavailable for storage.UnavailableError,
+// http.StatusInsufficientStorage for storage.QuotaExceededError
+// and http.StatusInternalServerError for others, which are logged.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error, key string) {
+	details := map[string]string{"key": key}
+	switch err {
+	case storage.KeyAbsentError:
+		apierror.WriteDetails(w, r, http.StatusNotFound, apierror.KeyNotFound, err.Error(), details)
+	case storage.UnavailableError:
+		apierror.WriteDetails(w, r, http.StatusServiceUnavailable, apierror.Unavailable, err.Error(), details)
+	case storage.QuotaExceededError:
+		apierror.WriteDetails(w, r, http.StatusInsufficientStorage, apierror.QuotaExceeded, err.Error(), details)
+	default:
+		logging.Annotate(r.Context(), logging.Fields{"error": err})
+		apierror.WriteDetails(w, r, http.StatusInternalServerError, apierror.Internal, "internal server error", details)
+	}
+}
+
+// traced runs storage operation op on key (empty if it has none)
+// inside a span, child of request's span.
+// Absent keys are not recorded as errors.
+func traced(r *http.Request, op, key string, fn func() error) error {
+	_, span := tracing.Start(r.Context(), "storage."+op)
+	defer span.End()
+	if key != "" {
+		span.SetAttribute("gwp.key", key)
+	}
+	err := fn()
+	if err != storage.KeyAbsentError {
+		span.SetError(err)
+	}
+	return err
+}
+
 // getAllObjects(storage) writes keys present in storage into
 // body in JSON format.
 func getAllObjects(dataStorage storage.Storage) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		if keys, err := json.Marshal(dataStorage.Keys()); err == nil {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var keys []string
+		_ = traced(r, "Keys", "", func() error {
+			keys = dataStorage.Keys()
+			return nil
+		})
+		if keys, err := json.Marshal(keys); err == nil {
 			w.Header().Set("Content-Type", "application/json")
 			if _, err := w.Write(keys); err != nil {
 				panic(err)
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
 	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
 	"github.com/go-chi/chi"
 	"io/ioutil"
@@ -65,6 +66,16 @@ func assertBodyEmpty(t *testing.T, w *httptest.ResponseRecorder) {
 	assertBodiesEqual(t, w, []byte{})
 }
 
+func assertError(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	var envelope apierror.Envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("invalid error body %s: %v", w.Body.String(), err)
+	}
+	if envelope.Error.Code != code || envelope.Error.Status != w.Code || envelope.Error.Message == "" {
+		t.Errorf("expected error code %s, got %s", code, w.Body.String())
+	}
+}
+
 func TestCheckKey(t *testing.T) {
 	allValidChars := "1234567890qwertyuiopasdfghjklzxcvbnmQWERTYUIOPASDFGHJKLZXCVBNM"
 	ofLength1 := "A"
@@ -274,7 +285,7 @@ func TestDeleteObject(t *testing.T) {
 				}
 			} else {
 				assertCodesEqual(t, w, http.StatusNotFound)
-				assertBodyEmpty(t, w)
+				assertError(t, w, apierror.KeyNotFound)
 				if len(dataStorage.Keys()) != len(dataSet.keys) {
 					t.Errorf("invalid storage state: %v", dataStorage.Keys())
 				}
@@ -338,7 +349,7 @@ func TestEndpointPut(t *testing.T) {
 
 			if len(dataSet.object) > MaxObjectSize {
 				assertCodesEqual(t, w, http.StatusRequestEntityTooLarge)
-				assertBodyEmpty(t, w)
+				assertError(t, w, apierror.ObjectTooLarge)
 				if _, err := dataStorage.Get(dataSet.key); err == nil {
 					t.Errorf("object added to storage")
 				}
@@ -369,7 +380,7 @@ func TestEndpointPut(t *testing.T) {
 		handler.ServeHTTP(w, r)
 
 		assertCodesEqual(t, w, http.StatusBadRequest)
-		assertBodyEmpty(t, w)
+		assertError(t, w, apierror.InvalidKey)
 	})
 
 	t.Run("no Content-Type header", func(t *testing.T) {
@@ -381,7 +392,7 @@ func TestEndpointPut(t *testing.T) {
 		handler.ServeHTTP(w, r)
 
 		assertCodesEqual(t, w, http.StatusBadRequest)
-		assertBodyEmpty(t, w)
+		assertError(t, w, apierror.MissingContentType)
 	})
 }
 
@@ -430,7 +441,7 @@ func TestEndpointGet(t *testing.T) {
 			handler.ServeHTTP(w, r)
 
 			assertCodesEqual(t, w, http.StatusNotFound)
-			assertBodyEmpty(t, w)
+			assertError(t, w, apierror.KeyNotFound)
 		})
 	}
 
@@ -443,7 +454,7 @@ func TestEndpointGet(t *testing.T) {
 		handler.ServeHTTP(w, r)
 
 		assertCodesEqual(t, w, http.StatusBadRequest)
-		assertBodyEmpty(t, w)
+		assertError(t, w, apierror.InvalidKey)
 	})
 }
 
@@ -473,7 +484,7 @@ func TestEndpointDelete(t *testing.T) {
 				assertBodyEmpty(t, w)
 			} else {
 				assertCodesEqual(t, w, http.StatusNotFound)
-				assertBodyEmpty(t, w)
+				assertError(t, w, apierror.KeyNotFound)
 			}
 		})
 	}
@@ -487,7 +498,7 @@ func TestEndpointDelete(t *testing.T) {
 		handler.ServeHTTP(w, r)
 
 		assertCodesEqual(t, w, http.StatusBadRequest)
-		assertBodyEmpty(t, w)
+		assertError(t, w, apierror.InvalidKey)
 	})
 }
 
@@ -519,3 +530,49 @@ func TestEndpointGetAll(t *testing.T) {
 		})
 	}
 }
+
+// unavailableStorage rejects all operations with storage.UnavailableError.
+type unavailableStorage struct{}
+
+func (unavailableStorage) Put(string, []byte, string) error {
+	return storage.UnavailableError
+}
+
+func (unavailableStorage) Get(string) (storage.Data, error) {
+	return storage.Data{}, storage.UnavailableError
+}
+
+func (unavailableStorage) Delete(string) error {
+	return storage.UnavailableError
+}
+
+func (unavailableStorage) Keys() []string {
+	return []string{}
+}
+
+func TestEndpointsStorageUnavailable(t *testing.T) {
+	for _, method := range []string{"PUT", "GET", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(method, ObjectsUrl+"/key", bytes.NewBuffer([]byte{}))
+			r.Header.Set("Content-Type", "type")
+			handler := NewRouter(unavailableStorage{})
+			handler.ServeHTTP(w, r)
+
+			assertCodesEqual(t, w, http.StatusServiceUnavailable)
+		})
+	}
+}
+
+func TestPutObjectQuotaExceeded(t *testing.T) {
+	dataStorage := storage.NewQuotaStorage(storage.NewStorage())
+	dataStorage.SetQuotas([]storage.Quota{{Prefix: "key", MaxBytes: 4}})
+	for object, code := range map[string]int{"data": http.StatusCreated, "data1": http.StatusInsufficientStorage} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", ObjectsUrl+"/key", bytes.NewBufferString(object))
+		r.Header.Set("Content-Type", "type")
+		NewRouter(dataStorage).ServeHTTP(w, r)
+
+		assertCodesEqual(t, w, code)
+	}
+}
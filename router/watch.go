@@ -0,0 +1,53 @@
+package router
+
+import (
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	VersionHeader = "X-GWP-Version" // version of the key returned with its value
+	MaxWait       = 5 * time.Minute // maximal wait of a blocking query
+)
+
+var InvalidWaitError = errors.New("invalid wait or after parameter")
+
+// waitForChange blocks a query with wait parameter until key
+// has a version greater than after parameter, wait elapses
+// or the client goes away. Without after parameter, waits for
+// the next change of key. Queries without wait return immediately.
+// Wait is limited to MaxWait.
+func waitForChange(watcher storage.Watcher, key string, r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("wait") == "" {
+		return nil
+	}
+	wait, err := time.ParseDuration(query.Get("wait"))
+	if err != nil || wait < 0 {
+		return InvalidWaitError
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	var after uint64
+	if query.Get("after") == "" {
+		_, after, _ = watcher.GetWithVersion(key)
+	} else if after, err = strconv.ParseUint(query.Get("after"), 10, 64); err != nil {
+		return InvalidWaitError
+	}
+
+	changed, release := watcher.Watch(key, after)
+	defer release()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-changed:
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	return nil
+}
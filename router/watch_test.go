@@ -0,0 +1,99 @@
+package router
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func assertVersionEqual(t *testing.T, w *httptest.ResponseRecorder, version string) {
+	if responseVersion := w.Header().Get(VersionHeader); responseVersion != version {
+		t.Errorf("wrong version: %v", responseVersion)
+	}
+}
+
+func TestEndpointGetVersion(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	dataStorage.Put("key", []byte{1}, "type")
+	dataStorage.Put("key", []byte{2}, "type")
+	handler := NewRouter(dataStorage)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/key", nil))
+	assertCodesEqual(t, w, http.StatusOK)
+	assertBodiesEqual(t, w, []byte{2})
+	assertVersionEqual(t, w, "2")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/absent", nil))
+	assertCodesEqual(t, w, http.StatusNotFound)
+	assertVersionEqual(t, w, "0")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/key?wait=1m&after=1", nil))
+	assertCodesEqual(t, w, http.StatusOK)
+	assertVersionEqual(t, w, "2")
+}
+
+func TestEndpointGetWait(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	dataStorage.Put("key", []byte{1}, "type")
+	handler := NewRouter(dataStorage)
+
+	for _, url := range []string{"/key?wait=10s&after=1", "/key?wait=10s"} {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+url, nil))
+			done <- w
+		}()
+		select {
+		case <-done:
+			t.Fatalf("%v returned before change", url)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		dataStorage.Put("other", []byte{}, "")
+		dataStorage.Put("key", []byte{2}, "type2")
+		w := <-done
+		assertCodesEqual(t, w, http.StatusOK)
+		assertBodiesEqual(t, w, []byte{2})
+		assertContentTypeEqual(t, w, "type2")
+
+		dataStorage.Delete("other")
+		dataStorage.Put("key", []byte{1}, "type")
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/key?wait=10s&after=9", nil))
+			done <- w
+		}()
+		dataStorage.Delete("key")
+		w := <-done
+		assertCodesEqual(t, w, http.StatusNotFound)
+		assertVersionEqual(t, w, "10")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/key?wait=20ms&after=10", nil))
+		assertCodesEqual(t, w, http.StatusNotFound)
+		assertVersionEqual(t, w, "10")
+	})
+}
+
+func TestEndpointGetWaitInvalid(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	handler := NewRouter(dataStorage)
+
+	for _, query := range []string{"?wait=soon", "?wait=-1s", "?wait=1s&after=x", "?wait=1s&after=-1"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", ObjectsUrl+"/key"+query, nil))
+		assertCodesEqual(t, w, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/health"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/limit"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/metrics"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/openapi"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/partition"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/replication"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/socket"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/webhook"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// features holds handlers of features of the server, mounted next
+// to objects. Handlers of features which are not enabled are nil.
+type features struct {
+	metrics     http.Handler
+	status      http.Handler
+	openapi     http.Handler
+	events      http.Handler
+	sockets     http.Handler
+	cluster     http.Handler
+	replication http.Handler
+	webhooks    http.Handler
+	namespaces  http.Handler
+	quotas      http.Handler
+	keys        http.Handler
+}
+
+// mount mounts handlers of enabled features on router under their URLs.
+func (f *features) mount(router chi.Router) {
+	routes := []struct {
+		url     string
+		handler http.Handler
+	}{
+		{metrics.Url, f.metrics},
+		{health.StatusUrl, f.status},
+		{openapi.Url, f.openapi},
+		{events.Url, f.events},
+		{socket.Url, f.sockets},
+		{partition.Url, f.cluster},
+		{replication.Url, f.replication},
+		{webhook.Url, f.webhooks},
+		{namespace.Url, f.namespaces},
+		{limit.Url, f.quotas},
+		{auth.Url, f.keys},
+	}
+	for _, route := range routes {
+		if route.handler != nil {
+			router.Mount(route.url, route.handler)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/health"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/limit"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/metrics"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/namespace"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/openapi"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/partition"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/persistence"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/replication"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/socket"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/webhook"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newServerRouter builds router with all features enabled.
+func newServerRouter(t *testing.T, dbName string) *chi.Mux {
+	quotas := storage.NewQuotaStorage(storage.NewStorage())
+	dataStorage := storage.NewObservableStorage(quotas)
+	serverHealth, err := health.New("test", dataStorage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher, err := webhook.NewDispatcher(dataStorage, persistence.NewMetaStore(dbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces, err := namespace.NewManager(persistence.NewNamespaceStore(dbName), quotas, dataStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.NewKeyStore(persistence.NewMetaStore(dbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := router.NewRouter(dataStorage)
+	mounted := features{
+		metrics:     metrics.New().Handler(),
+		status:      serverHealth.StatusHandler(),
+		openapi:     openapi.Handler(openapi.Spec("test")),
+		events:      events.NewFeed(dataStorage, 10).Handler(),
+		sockets:     socket.NewServer(dataStorage, false).Handler(),
+		cluster:     partition.New("http://127.0.0.1:8080", "secret", dataStorage).Handler(),
+		replication: replication.NewLeader(dataStorage).Handler(),
+		webhooks:    dispatcher.Handler(),
+		namespaces:  namespaces.Handler(),
+		quotas:      limit.Handler(quotas),
+		keys:        keys.Handler(),
+	}
+	// Features added later must be covered too.
+	features := reflect.ValueOf(mounted)
+	for i := 0; i < features.NumField(); i++ {
+		if features.Field(i).IsNil() {
+			t.Fatalf("feature %s not enabled", features.Type().Field(i).Name)
+		}
+	}
+	mounted.mount(r)
+	return r
+}
+
+// route is a route of the router, with path without trailing slash.
+// Wildcard routes are mounted handlers which are not routers
+// and accept requests with any method under path.
+type route struct {
+	method   string
+	path     string
+	wildcard bool
+}
+
+func (r route) covers(method, path string) bool {
+	if r.wildcard {
+		return path == r.path || strings.HasPrefix(path, r.path+"/")
+	}
+	return r.method == strings.ToUpper(method) && r.path == path
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "GWP_openapi_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r := newServerRouter(t, filepath.Join(dir, "test.db"))
+	spec := openapi.Spec("test")
+
+	var routes []route
+	err = chi.Walk(r, func(method, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		wildcard := strings.HasSuffix(pattern, "/*")
+		routes = append(routes, route{
+			method:   method,
+			path:     strings.TrimSuffix(strings.TrimSuffix(pattern, "/*"), "/"),
+			wildcard: wildcard,
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range routes {
+		covered := false
+		for path, item := range spec.Paths {
+			for method := range item {
+				if route.covers(method, path) {
+					covered = true
+				}
+			}
+		}
+		if !covered {
+			t.Errorf("route %s %s not described in the spec", route.method, route.path)
+		}
+	}
+	for path, item := range spec.Paths {
+		if path == health.HealthUrl || path == health.ReadyUrl {
+			// Served by probes wrapping the router.
+			continue
+		}
+		for method := range item {
+			routed := false
+			for _, route := range routes {
+				if route.covers(method, path) {
+					routed = true
+				}
+			}
+			if !routed {
+				t.Errorf("operation %s %s has no route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/router"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Url          = "/api/socket"
+	PingInterval = 30 * time.Second
+)
+
+const (
+	// Number of mutations queued for a client before it is
+	// disconnected as too slow.
+	clientBuffer = 256
+	// Number of results queued before requests of a client
+	// stop being read.
+	resultBuffer = 16
+	writeTimeout = 10 * time.Second
+	// Objects are base64 encoded in messages.
+	maxMessageSize = 2*router.MaxObjectSize + 1024
+)
+
+// Message types sent by clients.
+// Every request is answered with msgResult carrying its Id.
+const (
+	msgSubscribe   = "subscribe"
+	msgUnsubscribe = "unsubscribe"
+	msgGet         = "get"
+	msgPut         = "put"
+	msgDelete      = "delete"
+)
+
+// Message types sent by server. Clients receive msgEvent for every
+// mutation of subscribed keys and msgReset when storage contents
+// were replaced, after which subscribed keys should be read again.
+const (
+	msgResult = "result"
+	msgEvent  = "event"
+	msgReset  = "reset"
+)
+
+// request is a message sent by a client.
+// Subscriptions cover a single Key or, if it is empty,
+// all keys starting with Prefix.
+type request struct {
+	Type        string `json:"type"`
+	Id          string `json:"id,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Object      []byte `json:"object,omitempty"`
+}
+
+// message is a message sent by server.
+// Status of a result is the code an equivalent HTTP request
+// would be answered with.
+type message struct {
+	Type        string     `json:"type"`
+	Id          string     `json:"id,omitempty"`
+	Status      int        `json:"status,omitempty"`
+	Key         string     `json:"key,omitempty"`
+	Op          storage.Op `json:"op,omitempty"`
+	ContentType string     `json:"contentType,omitempty"`
+	Object      []byte     `json:"object,omitempty"`
+	Version     uint64     `json:"version,omitempty"`
+	Time        *time.Time `json:"time,omitempty"`
+}
+
+// Server serves WebSocket connections, over which clients
+// subscribe to mutations of storage and access it.
+type Server struct {
+	storage      *storage.ObservableStorage
+	upgrader     websocket.Upgrader
+	keyRegex     *regexp.Regexp
+	readOnly     bool
+	buffer       int
+	pingInterval time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewServer creates a server for storage. If readOnly, put and delete
+// requests are rejected with status http.StatusMethodNotAllowed,
+// as storage must not be modified directly, e.g. on a follower.
+func NewServer(dataStorage *storage.ObservableStorage, readOnly bool) *Server {
+	return &Server{
+		storage:      dataStorage,
+		readOnly:     readOnly,
+		keyRegex:     regexp.MustCompile(router.KeyPattern),
+		buffer:       clientBuffer,
+		pingInterval: PingInterval,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Handler returns handler accepting WebSocket connections,
+// to be mounted under Url.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.serve)
+}
+
+// Close disconnects all clients.
+// Should be called when server shuts down, since WebSocket
+// connections are not closed by http.Server.Shutdown.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// conn is a single client connection.
+// Requests are authorized with identity carried by ctx.
+type conn struct {
+	server   *Server
+	ws       *websocket.Conn
+	ctx      context.Context
+	results  chan message
+	mut      sync.Mutex
+	keys     map[string]struct{}
+	prefixes map[string]struct{}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader has already responded.
+		return
+	}
+	c := &conn{
+		server:   s,
+		ws:       ws,
+		ctx:      r.Context(),
+		results:  make(chan message, resultBuffer),
+		keys:     make(map[string]struct{}),
+		prefixes: make(map[string]struct{}),
+	}
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		c.readLoop(writerDone)
+		close(readerDone)
+	}()
+	c.writeLoop(readerDone)
+	close(writerDone)
+	ws.Close()
+}
+
+// readLoop handles requests until the connection fails.
+func (c *conn) readLoop(writerDone <-chan struct{}) {
+	c.ws.SetReadLimit(maxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * c.server.pingInterval))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(2 * c.server.pingInterval))
+	})
+	for {
+		_, body, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		var result message
+		if err := json.Unmarshal(body, &req); err == nil {
+			result = c.handle(req)
+		} else {
+			result = message{Status: http.StatusBadRequest}
+		}
+		result.Type = msgResult
+		result.Id = req.Id
+		select {
+		case c.results <- result:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// handle performs a single request, returning its result.
+func (c *conn) handle(req request) message {
+	switch req.Type {
+	case msgSubscribe, msgUnsubscribe:
+		return c.subscribe(req)
+	case msgGet:
+		return c.get(req)
+	case msgPut, msgDelete:
+		if c.server.readOnly {
+			return message{Status: http.StatusMethodNotAllowed}
+		}
+		if req.Type == msgPut {
+			return c.put(req)
+		}
+		return c.delete(req)
+	default:
+		return message{Status: http.StatusBadRequest}
+	}
+}
+
+func (c *conn) subscribe(req request) message {
+	if req.Key != "" && !c.server.keyRegex.MatchString(req.Key) {
+		return message{Status: http.StatusBadRequest}
+	}
+	set, value := c.prefixes, req.Prefix
+	if req.Key != "" {
+		set, value = c.keys, req.Key
+	}
+	if req.Type == msgSubscribe && !auth.Allowed(c.ctx, auth.Read, value) {
+		return message{Status: http.StatusForbidden}
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if req.Type == msgSubscribe {
+		set[value] = struct{}{}
+	} else {
+		delete(set, value)
+	}
+	return message{Status: http.StatusOK}
+}
+
+func (c *conn) get(req request) message {
+	if !c.server.keyRegex.MatchString(req.Key) {
+		return message{Status: http.StatusBadRequest}
+	}
+	if !auth.Allowed(c.ctx, auth.Read, req.Key) {
+		return message{Status: http.StatusForbidden}
+	}
+	data, version, err := c.server.storage.GetWithVersion(req.Key)
+	if err != nil {
+		return message{Status: statusCode(err), Key: req.Key, Version: version}
+	}
+	return message{
+		Status:      http.StatusOK,
+		Key:         req.Key,
+		ContentType: data.ContentType,
+		Object:      data.Object,
+		Version:     version,
+	}
+}
+
+func (c *conn) put(req request) message {
+	if !c.server.keyRegex.MatchString(req.Key) || req.ContentType == "" {
+		return message{Status: http.StatusBadRequest}
+	}
+	if !auth.Allowed(c.ctx, auth.Write, req.Key) {
+		return message{Status: http.StatusForbidden}
+	}
+	if len(req.Object) > router.MaxObjectSize {
+		return message{Status: http.StatusRequestEntityTooLarge}
+	}
+	if err := c.server.storage.Put(req.Key, req.Object, req.ContentType); err != nil {
+		return message{Status: statusCode(err)}
+	}
+	return message{Status: http.StatusCreated}
+}
+
+func (c *conn) delete(req request) message {
+	if !c.server.keyRegex.MatchString(req.Key) {
+		return message{Status: http.StatusBadRequest}
+	}
+	if !auth.Allowed(c.ctx, auth.Delete, req.Key) {
+		return message{Status: http.StatusForbidden}
+	}
+	if err := c.server.storage.Delete(req.Key); err != nil {
+		return message{Status: statusCode(err)}
+	}
+	return message{Status: http.StatusNoContent}
+}
+
+// subscribed reports whether client is subscribed to key.
+func (c *conn) subscribed(key string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if _, ok := c.keys[key]; ok {
+		return true
+	}
+	for prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeLoop sends results and events until the connection fails,
+// client falls behind or server is closed.
+func (c *conn) writeLoop(readerDone <-chan struct{}) {
+	subscription := c.server.storage.Subscribe(c.server.buffer)
+	defer func() {
+		subscription.Close()
+	}()
+	ticker := time.NewTicker(c.server.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		var msg message
+		select {
+		case event, ok := <-subscription.Events():
+			if ok && !c.subscribed(event.Key) {
+				continue
+			}
+			if ok {
+				msg = message{
+					Type:        msgEvent,
+					Key:         event.Key,
+					Op:          event.Op,
+					ContentType: event.Data.ContentType,
+					Object:      event.Data.Object,
+					Version:     event.Seq,
+					Time:        &event.Time,
+				}
+			} else if subscription.Err() == storage.RestoredError {
+				subscription = c.server.storage.Subscribe(c.server.buffer)
+				msg = message{Type: msgReset}
+			} else {
+				c.close(websocket.CloseTryAgainLater, subscription.Err().Error())
+				return
+			}
+		case msg = <-c.results:
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+			continue
+		case <-readerDone:
+			return
+		case <-c.server.closed:
+			c.close(websocket.CloseGoingAway, "server shutting down")
+			return
+		}
+		_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := c.ws.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// close sends a close message to client.
+func (c *conn) close(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	_ = c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+}
+
+// statusCode returns result status for an error returned by storage.
+func statusCode(err error) int {
+	switch err {
+	case storage.KeyAbsentError:
+		return http.StatusNotFound
+	case storage.UnavailableError:
+		return http.StatusServiceUnavailable
+	case storage.QuotaExceededError:
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,234 @@
+package socket
+
+import (
+	"bytes"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/auth"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer(readOnly bool) (*storage.ObservableStorage, *Server, *httptest.Server) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	server := NewServer(dataStorage, readOnly)
+	return dataStorage, server, httptest.NewServer(server.Handler())
+}
+
+func dial(t *testing.T, httpServer *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func receive(t *testing.T, ws *websocket.Conn) message {
+	var msg message
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// call sends req and returns its result.
+func call(t *testing.T, ws *websocket.Conn, req request) message {
+	if err := ws.WriteJSON(req); err != nil {
+		t.Fatal(err)
+	}
+	result := receive(t, ws)
+	if result.Type != msgResult || result.Id != req.Id {
+		t.Fatalf("wrong result: %+v", result)
+	}
+	return result
+}
+
+func TestSocket_Requests(t *testing.T) {
+	dataStorage, server, httpServer := newServer(false)
+	defer httpServer.Close()
+	defer server.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+
+	requests := []struct {
+		req    request
+		status int
+	}{
+		{request{Type: msgPut, Id: "1", Key: "key", ContentType: "type", Object: []byte{1, 2}}, http.StatusCreated},
+		{request{Type: msgPut, Id: "2", Key: "key", Object: []byte{1, 2}}, http.StatusBadRequest},
+		{request{Type: msgPut, Id: "3", Key: "key-", ContentType: "type"}, http.StatusBadRequest},
+		{request{Type: msgPut, Id: "4", Key: "key", ContentType: "type", Object: make([]byte, 1000001)}, http.StatusRequestEntityTooLarge},
+		{request{Type: msgGet, Id: "5", Key: "absent"}, http.StatusNotFound},
+		{request{Type: msgDelete, Id: "6", Key: "absent"}, http.StatusNotFound},
+		{request{Type: "unknown", Id: "7"}, http.StatusBadRequest},
+	}
+	for _, request := range requests {
+		if result := call(t, ws, request.req); result.Status != request.status {
+			t.Errorf("wrong status for %v: %v", request.req.Id, result.Status)
+		}
+	}
+
+	result := call(t, ws, request{Type: msgGet, Id: "8", Key: "key"})
+	if result.Status != http.StatusOK || result.ContentType != "type" || !bytes.Equal(result.Object, []byte{1, 2}) || result.Version != 1 {
+		t.Errorf("wrong get result: %+v", result)
+	}
+	if result := call(t, ws, request{Type: msgDelete, Id: "9", Key: "key"}); result.Status != http.StatusNoContent {
+		t.Errorf("wrong delete result: %+v", result)
+	}
+	if _, err := dataStorage.Get("key"); err != storage.KeyAbsentError {
+		t.Error("key not deleted")
+	}
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if result := receive(t, ws); result.Type != msgResult || result.Status != http.StatusBadRequest {
+		t.Errorf("wrong result of malformed request: %+v", result)
+	}
+}
+
+func TestSocket_ReadOnly(t *testing.T) {
+	dataStorage, server, httpServer := newServer(true)
+	defer httpServer.Close()
+	defer server.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+	dataStorage.Put("key", []byte{}, "type")
+
+	if result := call(t, ws, request{Type: msgPut, Id: "1", Key: "key", ContentType: "type"}); result.Status != http.StatusMethodNotAllowed {
+		t.Errorf("wrong put result: %+v", result)
+	}
+	if result := call(t, ws, request{Type: msgDelete, Id: "2", Key: "key"}); result.Status != http.StatusMethodNotAllowed {
+		t.Errorf("wrong delete result: %+v", result)
+	}
+	if result := call(t, ws, request{Type: msgGet, Id: "3", Key: "key"}); result.Status != http.StatusOK {
+		t.Errorf("wrong get result: %+v", result)
+	}
+}
+
+func TestSocket_Authorization(t *testing.T) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	server := NewServer(dataStorage, false)
+	defer server.Close()
+	identity := &auth.Identity{Grants: []auth.Grant{
+		{Prefix: "ab", Permissions: []auth.Permission{auth.Read}},
+		{Prefix: "abc", Permissions: []auth.Permission{auth.Write}},
+	}}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Handler().ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	}))
+	defer httpServer.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+	dataStorage.Put("abc", []byte{}, "type")
+
+	requests := []struct {
+		req    request
+		status int
+	}{
+		{request{Type: msgSubscribe, Id: "1", Prefix: "a"}, http.StatusForbidden},
+		{request{Type: msgSubscribe, Id: "3", Key: "xyz"}, http.StatusForbidden},
+		{request{Type: msgGet, Id: "4", Key: "abc"}, http.StatusOK},
+		{request{Type: msgGet, Id: "5", Key: "xyz"}, http.StatusForbidden},
+		{request{Type: msgPut, Id: "6", Key: "abc", ContentType: "type"}, http.StatusCreated},
+		{request{Type: msgPut, Id: "7", Key: "abd", ContentType: "type"}, http.StatusForbidden},
+		{request{Type: msgDelete, Id: "8", Key: "abc"}, http.StatusForbidden},
+		{request{Type: msgSubscribe, Id: "2", Prefix: "abc"}, http.StatusOK},
+	}
+	for _, request := range requests {
+		if result := call(t, ws, request.req); result.Status != request.status {
+			t.Errorf("wrong status for %v: %v", request.req.Id, result.Status)
+		}
+	}
+}
+
+func TestSocket_Subscribe(t *testing.T) {
+	dataStorage, server, httpServer := newServer(false)
+	defer httpServer.Close()
+	defer server.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+
+	call(t, ws, request{Type: msgSubscribe, Id: "1", Key: "key"})
+	call(t, ws, request{Type: msgSubscribe, Id: "2", Prefix: "ab"})
+
+	dataStorage.Put("key", []byte{1}, "type")
+	dataStorage.Put("keys", []byte{}, "")
+	dataStorage.Put("abc", []byte{}, "")
+	dataStorage.Delete("key")
+
+	event := receive(t, ws)
+	if event.Type != msgEvent || event.Key != "key" || event.Op != storage.OpPut || event.ContentType != "type" ||
+		!bytes.Equal(event.Object, []byte{1}) || event.Version != 1 || event.Time == nil {
+		t.Errorf("wrong event: %+v", event)
+	}
+	if event := receive(t, ws); event.Key != "abc" || event.Version != 3 {
+		t.Errorf("wrong event: %+v", event)
+	}
+	if event := receive(t, ws); event.Key != "key" || event.Op != storage.OpDelete || event.Version != 4 {
+		t.Errorf("wrong event: %+v", event)
+	}
+
+	call(t, ws, request{Type: msgUnsubscribe, Id: "3", Key: "key"})
+	dataStorage.Put("key", []byte{}, "")
+	dataStorage.Put("abd", []byte{}, "")
+	if event := receive(t, ws); event.Key != "abd" {
+		t.Errorf("wrong event: %+v", event)
+	}
+
+	dataStorage.Restore(map[string]storage.Data{})
+	if msg := receive(t, ws); msg.Type != msgReset {
+		t.Errorf("wrong message: %+v", msg)
+	}
+	dataStorage.Put("abe", []byte{}, "")
+	if event := receive(t, ws); event.Key != "abe" {
+		t.Errorf("wrong event: %+v", event)
+	}
+}
+
+func TestSocket_SlowClient(t *testing.T) {
+	dataStorage, server, httpServer := newServer(false)
+	server.buffer = 1
+	defer httpServer.Close()
+	defer server.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+	call(t, ws, request{Type: msgSubscribe, Id: "1"})
+
+	// Client does not read, so the connection fills up.
+	object := make([]byte, 100000)
+	for i := 0; i < 200; i++ {
+		dataStorage.Put("key", object, "type")
+	}
+
+	for {
+		_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+		var msg message
+		err := ws.ReadJSON(&msg)
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Errorf("wrong error: %v", err)
+		}
+		break
+	}
+}
+
+func TestSocket_Close(t *testing.T) {
+	_, server, httpServer := newServer(false)
+	defer httpServer.Close()
+	ws := dial(t, httpServer)
+	defer ws.Close()
+
+	server.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -9,13 +9,14 @@ type CmapStorage struct {
 	mut    sync.RWMutex
 }
 
-func (m CmapStorage) Put(key string, object []byte, contentType string) {
+func (m *CmapStorage) Put(key string, object []byte, contentType string) error {
 	m.mut.Lock()
 	m.values[key] = Data{object, contentType}
 	m.mut.Unlock()
+	return nil
 }
 
-func (m CmapStorage) Get(key string) (Data, error) {
+func (m *CmapStorage) Get(key string) (Data, error) {
 	m.mut.RLock()
 	val, exists := m.values[key]
 	m.mut.RUnlock()
@@ -26,7 +27,7 @@ func (m CmapStorage) Get(key string) (Data, error) {
 	return val, err
 }
 
-func (m CmapStorage) Delete(key string) error {
+func (m *CmapStorage) Delete(key string) error {
 	m.mut.Lock()
 	_, existed := m.values[key]
 	delete(m.values, key)
@@ -38,7 +39,7 @@ func (m CmapStorage) Delete(key string) error {
 	}
 }
 
-func (m CmapStorage) Keys() []string {
+func (m *CmapStorage) Keys() []string {
 	m.mut.RLock()
 	keys := make([]string, len(m.values))
 	i := 0
@@ -50,6 +51,26 @@ func (m CmapStorage) Keys() []string {
 	return keys
 }
 
-func NewCmapStorage() CmapStorage {
-	return CmapStorage{make(map[string]Data), sync.RWMutex{}}
+// Snapshot returns a copy of storage contents
+// from a single point in time.
+func (m *CmapStorage) Snapshot() map[string]Data {
+	m.mut.RLock()
+	values := make(map[string]Data, len(m.values))
+	for key, data := range m.values {
+		values[key] = data
+	}
+	m.mut.RUnlock()
+	return values
+}
+
+// Restore atomically replaces storage contents with values.
+// Storage takes ownership of values.
+func (m *CmapStorage) Restore(values map[string]Data) {
+	m.mut.Lock()
+	m.values = values
+	m.mut.Unlock()
+}
+
+func NewCmapStorage() *CmapStorage {
+	return &CmapStorage{values: make(map[string]Data)}
 }
@@ -146,3 +146,28 @@ func TestCmapStorage_Keys(t *testing.T) {
 		t.Fatalf("extracted keys differ: %v", extractedKeys)
 	}
 }
+
+func TestCmapStorage_Snapshot(t *testing.T) {
+	dataStorage := NewCmapStorage()
+	dataStorage.values["key1"] = Data{[]byte{1}, "type"}
+
+	snapshot := dataStorage.Snapshot()
+	dataStorage.values["key2"] = Data{[]byte{2}, "type"}
+	delete(dataStorage.values, "key1")
+
+	if !reflect.DeepEqual(snapshot, map[string]Data{"key1": {[]byte{1}, "type"}}) {
+		t.Fatalf("snapshot changed with storage: %v", snapshot)
+	}
+}
+
+func TestCmapStorage_Restore(t *testing.T) {
+	dataStorage := NewCmapStorage()
+	dataStorage.values["key1"] = Data{[]byte{1}, "type"}
+
+	values := map[string]Data{"key2": {[]byte{2}, "type"}}
+	dataStorage.Restore(values)
+
+	if !reflect.DeepEqual(dataStorage.values, values) {
+		t.Fatalf("storage not restored: %v", dataStorage.values)
+	}
+}
@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Op is a kind of mutation applied to storage.
+type Op string
+
+const (
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+
+	// OpCreate and OpUpdate tell apart puts of absent
+	// and present keys in notifications which need it.
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+)
+
+// Event describes a single mutation applied to storage.
+type Event struct {
+	Seq  uint64 // position of the mutation in storage history, starting from 1
+	Op   Op
+	Key  string
+	Data Data // for OpPut only
+	// Created tells whether the key was absent before, for OpPut only.
+	Created bool
+	Time    time.Time
+}
+
+var (
+	OverflowError = errors.New("subscriber too slow")
+	RestoredError = errors.New("storage contents replaced")
+	ClosedError   = errors.New("subscription closed")
+)
+
+// Subscription delivers events in the order they were applied.
+type Subscription struct {
+	events  chan Event
+	err     error
+	storage *ObservableStorage
+}
+
+// Events returns channel receiving the events.
+// Channel is closed when the subscription ends,
+// Err tells why it ended.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns reason of closing the subscription:
+// OverflowError if subscriber did not keep up with mutations,
+// RestoredError if storage contents were replaced, ClosedError
+// if subscription was closed with Close.
+// Returns nil while subscription is active.
+func (s *Subscription) Err() error {
+	s.storage.mut.Lock()
+	defer s.storage.mut.Unlock()
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.storage.mut.Lock()
+	s.storage.unsubscribe(s, ClosedError)
+	s.storage.mut.Unlock()
+}
+
+// ObservableStorage is a Storage notifying subscribers
+// about every mutation. It also implements Watcher.
+// All mutations must go through ObservableStorage,
+// otherwise they will not be observed.
+type ObservableStorage struct {
+	storage     Storage
+	mut         sync.Mutex
+	seq         uint64
+	subscribers map[*Subscription]struct{}
+
+	// Versions of present keys put since the last restore.
+	// Other present keys have version restored. Keys deleted
+	// since the last restore have the version of their delete,
+	// kept in deleted. Other absent keys have version floor,
+	// raised only when deleted is pruned.
+	versions map[string]uint64
+	deleted  map[string]uint64
+	restored uint64
+	floor    uint64
+	watches  map[string]map[chan struct{}]struct{}
+}
+
+// maxDeleted limits number of versions of deleted keys
+// kept by ObservableStorage. Pruning them raises version
+// of all absent keys, so their watchers may wake up spuriously.
+const maxDeleted = 1024
+
+func NewObservableStorage(storage Storage) *ObservableStorage {
+	return &ObservableStorage{
+		storage:     storage,
+		subscribers: make(map[*Subscription]struct{}),
+		versions:    make(map[string]uint64),
+		deleted:     make(map[string]uint64),
+		watches:     make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+func (o *ObservableStorage) Put(key string, object []byte, contentType string) error {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	_, err := o.storage.Get(key)
+	created := err == KeyAbsentError
+	if err := o.storage.Put(key, object, contentType); err != nil {
+		return err
+	}
+	o.publish(OpPut, key, Data{object, contentType}, created)
+	return nil
+}
+
+func (o *ObservableStorage) Get(key string) (Data, error) {
+	return o.storage.Get(key)
+}
+
+func (o *ObservableStorage) GetWithVersion(key string) (Data, uint64, error) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	data, err := o.storage.Get(key)
+	return data, o.version(key), err
+}
+
+func (o *ObservableStorage) Watch(key string, after uint64) (<-chan struct{}, func()) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	changed := make(chan struct{})
+	if o.version(key) > after {
+		close(changed)
+		return changed, func() {}
+	}
+	if o.watches[key] == nil {
+		o.watches[key] = make(map[chan struct{}]struct{})
+	}
+	o.watches[key][changed] = struct{}{}
+	return changed, func() {
+		o.mut.Lock()
+		defer o.mut.Unlock()
+		if watches, ok := o.watches[key]; ok {
+			delete(watches, changed)
+			if len(watches) == 0 {
+				delete(o.watches, key)
+			}
+		}
+	}
+}
+
+func (o *ObservableStorage) Delete(key string) error {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if err := o.storage.Delete(key); err != nil {
+		return err
+	}
+	o.publish(OpDelete, key, Data{}, false)
+	return nil
+}
+
+func (o *ObservableStorage) Keys() []string {
+	return o.storage.Keys()
+}
+
+// Total returns number of objects in storage and their total size,
+// tracked by the wrapped storage if it is a Counter.
+func (o *ObservableStorage) Total() (objects, bytes int64) {
+	return Total(o.storage)
+}
+
+// Snapshot returns a copy of storage contents
+// from a single point in time.
+func (o *ObservableStorage) Snapshot() map[string]Data {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.snapshot()
+}
+
+// Restore atomically replaces storage contents with values.
+// All subscriptions are closed with RestoredError,
+// since their subscribers have no way to learn the new contents
+// from events.
+func (o *ObservableStorage) Restore(values map[string]Data) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if snapshotter, ok := o.storage.(Snapshotter); ok {
+		snapshotter.Restore(values)
+	} else {
+		for _, key := range o.storage.Keys() {
+			_ = o.storage.Delete(key)
+		}
+		for key, data := range values {
+			_ = o.storage.Put(key, data.Object, data.ContentType)
+		}
+	}
+	o.seq++
+	for subscription := range o.subscribers {
+		o.unsubscribe(subscription, RestoredError)
+	}
+	o.versions = make(map[string]uint64)
+	o.deleted = make(map[string]uint64)
+	o.restored = o.seq
+	o.floor = o.seq
+	for _, watches := range o.watches {
+		for changed := range watches {
+			close(changed)
+		}
+	}
+	o.watches = make(map[string]map[chan struct{}]struct{})
+}
+
+// Seq returns sequence number of the last mutation.
+func (o *ObservableStorage) Seq() uint64 {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.seq
+}
+
+// Subscribe starts a subscription receiving events of mutations
+// applied after the call. Up to buffer events are queued for
+// a slow subscriber, then the subscription is closed
+// with OverflowError.
+func (o *ObservableStorage) Subscribe(buffer int) *Subscription {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.subscribe(buffer)
+}
+
+// SubscribeWithSeq works like Subscribe, additionally returning
+// sequence number of the last mutation from the moment
+// subscription started.
+func (o *ObservableStorage) SubscribeWithSeq(buffer int) (uint64, *Subscription) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.seq, o.subscribe(buffer)
+}
+
+// SubscribeWithSnapshot works like Subscribe, additionally returning
+// storage contents and sequence number of the last mutation
+// from the moment subscription started.
+func (o *ObservableStorage) SubscribeWithSnapshot(buffer int) (map[string]Data, uint64, *Subscription) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.snapshot(), o.seq, o.subscribe(buffer)
+}
+
+func (o *ObservableStorage) subscribe(buffer int) *Subscription {
+	subscription := &Subscription{events: make(chan Event, buffer), storage: o}
+	o.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// unsubscribe removes subscription, closing it with err.
+// Must be called with mut held.
+func (o *ObservableStorage) unsubscribe(subscription *Subscription, err error) {
+	if _, ok := o.subscribers[subscription]; ok {
+		delete(o.subscribers, subscription)
+		subscription.err = err
+		close(subscription.events)
+	}
+}
+
+// version must be called with mut held.
+func (o *ObservableStorage) version(key string) uint64 {
+	if version, ok := o.versions[key]; ok {
+		return version
+	}
+	if version, ok := o.deleted[key]; ok {
+		return version
+	}
+	if _, err := o.storage.Get(key); err == nil {
+		return o.restored
+	}
+	return o.floor
+}
+
+// snapshot must be called with mut held.
+func (o *ObservableStorage) snapshot() map[string]Data {
+	if snapshotter, ok := o.storage.(Snapshotter); ok {
+		return snapshotter.Snapshot()
+	}
+	values := make(map[string]Data)
+	for _, key := range o.storage.Keys() {
+		if data, err := o.storage.Get(key); err == nil {
+			values[key] = data
+		}
+	}
+	return values
+}
+
+// publish must be called with mut held.
+func (o *ObservableStorage) publish(op Op, key string, data Data, created bool) {
+	o.seq++
+	event := Event{Seq: o.seq, Op: op, Key: key, Data: data, Created: created, Time: time.Now()}
+	if op == OpDelete {
+		delete(o.versions, key)
+		o.deleted[key] = o.seq
+		if len(o.deleted) > maxDeleted {
+			for _, version := range o.deleted {
+				if version > o.floor {
+					o.floor = version
+				}
+			}
+			o.deleted = make(map[string]uint64)
+		}
+	} else {
+		delete(o.deleted, key)
+		o.versions[key] = o.seq
+	}
+	for changed := range o.watches[key] {
+		close(changed)
+	}
+	delete(o.watches, key)
+	for subscription := range o.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			o.unsubscribe(subscription, OverflowError)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestObservableStorage_Subscribe(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("before", []byte{}, "")
+
+	subscription := dataStorage.Subscribe(10)
+	dataStorage.Put("key", []byte{1, 2}, "type")
+	dataStorage.Put("before", []byte{1}, "")
+	if err := dataStorage.Delete("absent"); err != KeyAbsentError {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := dataStorage.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	put := <-subscription.Events()
+	if put.Seq != 2 || put.Op != OpPut || put.Key != "key" || !put.Created || !reflect.DeepEqual(put.Data, Data{[]byte{1, 2}, "type"}) {
+		t.Errorf("wrong put event: %v", put)
+	}
+	if update := <-subscription.Events(); update.Seq != 3 || update.Op != OpPut || update.Key != "before" || update.Created {
+		t.Errorf("wrong update event: %v", update)
+	}
+	del := <-subscription.Events()
+	if del.Seq != 4 || del.Op != OpDelete || del.Key != "key" {
+		t.Errorf("wrong delete event: %v", del)
+	}
+	if seq := dataStorage.Seq(); seq != 4 {
+		t.Errorf("wrong seq: %v", seq)
+	}
+
+	subscription.Close()
+	if _, ok := <-subscription.Events(); ok {
+		t.Error("events channel not closed")
+	}
+	if err := subscription.Err(); err != ClosedError {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestObservableStorage_SubscribeWithSnapshot(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("key", []byte{1}, "type")
+
+	snapshot, seq, subscription := dataStorage.SubscribeWithSnapshot(1)
+	if seq != 1 {
+		t.Errorf("wrong seq: %v", seq)
+	}
+	if !reflect.DeepEqual(snapshot, map[string]Data{"key": {[]byte{1}, "type"}}) {
+		t.Errorf("wrong snapshot: %v", snapshot)
+	}
+
+	dataStorage.Put("key2", []byte{}, "")
+	if event := <-subscription.Events(); event.Seq != 2 {
+		t.Errorf("wrong event: %v", event)
+	}
+	subscription.Close()
+}
+
+func TestObservableStorage_SubscribeWithSeq(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("key", []byte{1}, "type")
+
+	seq, subscription := dataStorage.SubscribeWithSeq(1)
+	if seq != 1 {
+		t.Errorf("wrong seq: %v", seq)
+	}
+	dataStorage.Delete("key")
+	if event := <-subscription.Events(); event.Seq != 2 || event.Op != OpDelete {
+		t.Errorf("wrong event: %v", event)
+	}
+	subscription.Close()
+}
+
+func TestObservableStorage_Overflow(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	subscription := dataStorage.Subscribe(1)
+	dataStorage.Put("key1", []byte{}, "")
+	dataStorage.Put("key2", []byte{}, "")
+
+	if event, ok := <-subscription.Events(); !ok || event.Key != "key1" {
+		t.Errorf("wrong event: %v", event)
+	}
+	if _, ok := <-subscription.Events(); ok {
+		t.Error("events channel not closed")
+	}
+	if err := subscription.Err(); err != OverflowError {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestObservableStorage_Restore(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("key", []byte{}, "")
+	subscription := dataStorage.Subscribe(1)
+
+	values := map[string]Data{"key2": {[]byte{2}, "type"}}
+	dataStorage.Restore(values)
+
+	if !reflect.DeepEqual(dataStorage.Snapshot(), values) {
+		t.Errorf("storage not restored: %v", dataStorage.Snapshot())
+	}
+	if _, ok := <-subscription.Events(); ok {
+		t.Error("events channel not closed")
+	}
+	if err := subscription.Err(); err != RestoredError {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestObservableStorage_Watch(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("key", []byte{1}, "type")
+	dataStorage.Put("other", []byte{}, "")
+
+	data, version, err := dataStorage.GetWithVersion("key")
+	if err != nil || version != 1 || !reflect.DeepEqual(data, Data{[]byte{1}, "type"}) {
+		t.Errorf("wrong result: %v %v %v", data, version, err)
+	}
+	if _, version, err := dataStorage.GetWithVersion("absent"); err != KeyAbsentError || version != 0 {
+		t.Errorf("wrong result for absent key: %v %v", version, err)
+	}
+
+	changed, release := dataStorage.Watch("key", 0)
+	select {
+	case <-changed:
+	default:
+		t.Error("watch of outdated version not triggered")
+	}
+	release()
+
+	changed, release = dataStorage.Watch("key", 1)
+	defer release()
+	dataStorage.Put("other", []byte{}, "")
+	select {
+	case <-changed:
+		t.Fatal("watch triggered by other key")
+	default:
+	}
+	dataStorage.Delete("key")
+	select {
+	case <-changed:
+	default:
+		t.Error("watch not triggered by delete")
+	}
+	if _, version, err := dataStorage.GetWithVersion("key"); err != KeyAbsentError || version != 4 {
+		t.Errorf("wrong result for deleted key: %v %v", version, err)
+	}
+
+	changed, release = dataStorage.Watch("absent", 0)
+	defer release()
+	dataStorage.Restore(map[string]Data{})
+	select {
+	case <-changed:
+	default:
+		t.Error("watch not triggered by restore")
+	}
+	if _, version, _ := dataStorage.GetWithVersion("key"); version != 5 {
+		t.Errorf("wrong version after restore: %v", version)
+	}
+}
+
+func TestObservableStorage_VersionsPruned(t *testing.T) {
+	dataStorage := NewObservableStorage(NewStorage())
+	dataStorage.Restore(map[string]Data{"restored": {[]byte{}, "type"}})
+	for i := 0; i <= maxDeleted; i++ {
+		key := fmt.Sprint("key", i)
+		dataStorage.Put(key, []byte{}, "type")
+		dataStorage.Delete(key)
+	}
+	if len(dataStorage.versions) != 0 || len(dataStorage.deleted) != 0 {
+		t.Errorf("versions of deleted keys kept: %v %v", dataStorage.versions, dataStorage.deleted)
+	}
+	if _, version, err := dataStorage.GetWithVersion("key0"); err != KeyAbsentError || version != 2*maxDeleted+3 {
+		t.Errorf("wrong result for deleted key: %v %v", version, err)
+	}
+	if _, version, err := dataStorage.GetWithVersion("restored"); err != nil || version != 1 {
+		t.Errorf("wrong result for restored key: %v %v", version, err)
+	}
+	changed, release := dataStorage.Watch("key0", 2)
+	defer release()
+	select {
+	case <-changed:
+	default:
+		t.Error("watch of deleted key not triggered")
+	}
+}
+
+func TestObservableStorage_WatchAbsent(t *testing.T) {
+	dataStorage := NewObservableStorage(NewCmapStorage())
+	dataStorage.Put("other", []byte{}, "")
+
+	_, version, err := dataStorage.GetWithVersion("absent")
+	if err != KeyAbsentError || version != 0 {
+		t.Errorf("wrong result for absent key: %v %v", version, err)
+	}
+	changed, release := dataStorage.Watch("absent", version)
+	defer release()
+	dataStorage.Delete("other")
+	select {
+	case <-changed:
+		t.Fatal("watch triggered by delete of other key")
+	default:
+	}
+	if _, version, _ := dataStorage.GetWithVersion("absent"); version != 0 {
+		t.Errorf("version changed by delete of other key: %v", version)
+	}
+	changed, release = dataStorage.Watch("absent", 0)
+	defer release()
+	select {
+	case <-changed:
+		t.Fatal("watch after delete of other key triggered")
+	default:
+	}
+
+	dataStorage.Put("absent", []byte{}, "")
+	dataStorage.Delete("absent")
+	select {
+	case <-changed:
+	default:
+		t.Error("watch not triggered by put")
+	}
+	if _, version, err := dataStorage.GetWithVersion("absent"); err != KeyAbsentError || version != 4 {
+		t.Errorf("wrong result for deleted key: %v %v", version, err)
+	}
+}
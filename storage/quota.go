@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Quota limits total size of objects and number of keys
+// of a tenant, the keys starting with Prefix. Zero limits
+// are not enforced.
+type Quota struct {
+	Prefix     string `json:"prefix"`
+	MaxBytes   int64  `json:"maxBytes"`
+	MaxObjects int64  `json:"maxObjects"`
+}
+
+// Usage describes storage used by a tenant.
+type Usage struct {
+	Quota
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// QuotaStorage is a Storage enforcing quotas of tenants.
+// Key belongs to the tenant with the longest prefix of the key,
+// keys of no tenant are not limited. Usage of the whole storage
+// is tracked too, making QuotaStorage a Counter.
+type QuotaStorage struct {
+	storage Storage
+	mut     sync.Mutex
+	usage   []*Usage // sorted by descending prefix length
+	total   Usage
+}
+
+// NewQuotaStorage wraps storage, initially without quotas.
+func NewQuotaStorage(storage Storage) *QuotaStorage {
+	q := &QuotaStorage{storage: storage}
+	q.count()
+	return q
+}
+
+// SetQuotas replaces quotas, counting current usage of tenants.
+// Tenants already exceeding their quotas can only shrink.
+func (q *QuotaStorage) SetQuotas(quotas []Quota) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.usage = make([]*Usage, len(quotas))
+	for i, quota := range quotas {
+		q.usage[i] = &Usage{Quota: quota}
+	}
+	sort.SliceStable(q.usage, func(i, j int) bool {
+		return len(q.usage[i].Prefix) > len(q.usage[j].Prefix)
+	})
+	q.count()
+}
+
+// Usage returns usage of all tenants, sorted by prefix.
+func (q *QuotaStorage) Usage() []Usage {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	usage := make([]Usage, len(q.usage))
+	for i, tenant := range q.usage {
+		usage[i] = *tenant
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Prefix < usage[j].Prefix
+	})
+	return usage
+}
+
+// Total returns number of objects in storage and their total size.
+func (q *QuotaStorage) Total() (objects, bytes int64) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return q.total.Objects, q.total.Bytes
+}
+
+// Put returns QuotaExceededError if the write would grow tenant
+// of the key over its quota.
+func (q *QuotaStorage) Put(key string, object []byte, contentType string) error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	tenant := q.tenant(key)
+	var oldBytes, newObjects int64 = 0, 1
+	if old, err := q.storage.Get(key); err == nil {
+		oldBytes, newObjects = int64(len(old.Object)), 0
+	}
+	if tenant != nil {
+		bytes := tenant.Bytes - oldBytes + int64(len(object))
+		if tenant.MaxBytes > 0 && bytes > tenant.MaxBytes && bytes > tenant.Bytes {
+			return QuotaExceededError
+		}
+		if tenant.MaxObjects > 0 && newObjects > 0 && tenant.Objects >= tenant.MaxObjects {
+			return QuotaExceededError
+		}
+	}
+	if err := q.storage.Put(key, object, contentType); err != nil {
+		return err
+	}
+	q.total.Bytes += int64(len(object)) - oldBytes
+	q.total.Objects += newObjects
+	if tenant != nil {
+		tenant.Bytes += int64(len(object)) - oldBytes
+		tenant.Objects += newObjects
+	}
+	return nil
+}
+
+func (q *QuotaStorage) Get(key string) (Data, error) {
+	return q.storage.Get(key)
+}
+
+func (q *QuotaStorage) Delete(key string) error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	old, err := q.storage.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := q.storage.Delete(key); err != nil {
+		return err
+	}
+	q.total.Bytes -= int64(len(old.Object))
+	q.total.Objects--
+	if tenant := q.tenant(key); tenant != nil {
+		tenant.Bytes -= int64(len(old.Object))
+		tenant.Objects--
+	}
+	return nil
+}
+
+func (q *QuotaStorage) Keys() []string {
+	return q.storage.Keys()
+}
+
+// Snapshot returns a copy of storage contents
+// from a single point in time.
+func (q *QuotaStorage) Snapshot() map[string]Data {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if snapshotter, ok := q.storage.(Snapshotter); ok {
+		return snapshotter.Snapshot()
+	}
+	values := make(map[string]Data)
+	for _, key := range q.storage.Keys() {
+		if data, err := q.storage.Get(key); err == nil {
+			values[key] = data
+		}
+	}
+	return values
+}
+
+// Restore atomically replaces storage contents with values,
+// regardless of quotas.
+func (q *QuotaStorage) Restore(values map[string]Data) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if snapshotter, ok := q.storage.(Snapshotter); ok {
+		snapshotter.Restore(values)
+	} else {
+		for _, key := range q.storage.Keys() {
+			_ = q.storage.Delete(key)
+		}
+		for key, data := range values {
+			_ = q.storage.Put(key, data.Object, data.ContentType)
+		}
+	}
+	q.count()
+}
+
+// tenant returns usage of key's tenant, nil if there is none.
+// Must be called with mut held.
+func (q *QuotaStorage) tenant(key string) *Usage {
+	for _, tenant := range q.usage {
+		if strings.HasPrefix(key, tenant.Prefix) {
+			return tenant
+		}
+	}
+	return nil
+}
+
+// count computes usage of tenants and the whole storage
+// from storage contents. Must be called with mut held.
+func (q *QuotaStorage) count() {
+	q.total.Bytes, q.total.Objects = 0, 0
+	for _, tenant := range q.usage {
+		tenant.Bytes, tenant.Objects = 0, 0
+	}
+	for _, key := range q.storage.Keys() {
+		data, err := q.storage.Get(key)
+		if err != nil {
+			continue
+		}
+		q.total.Bytes += int64(len(data.Object))
+		q.total.Objects++
+		if tenant := q.tenant(key); tenant != nil {
+			tenant.Bytes += int64(len(data.Object))
+			tenant.Objects++
+		}
+	}
+}
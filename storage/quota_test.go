@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuotaStorage(t *testing.T) {
+	dataStorage := NewQuotaStorage(NewStorage())
+	if err := dataStorage.Put("ab0", make([]byte, 8), "type"); err != nil {
+		t.Fatal(err)
+	}
+	dataStorage.SetQuotas([]Quota{
+		{Prefix: "a", MaxObjects: 2},
+		{Prefix: "ab", MaxBytes: 10},
+	})
+
+	dataSets := []struct {
+		key  string
+		size int
+		err  error
+	}{
+		{"ab1", 3, QuotaExceededError}, // 11 bytes
+		{"ab1", 2, nil},
+		{"ab0", 9, QuotaExceededError},
+		{"ab0", 1, nil},
+		{"ac0", 100, nil},
+		{"ac1", 1, nil},
+		{"ac2", 1, QuotaExceededError}, // 3 objects
+		{"ac1", 5, nil},
+		{"b", 100, nil},
+	}
+	for i, dataSet := range dataSets {
+		if err := dataStorage.Put(dataSet.key, make([]byte, dataSet.size), "type"); err != dataSet.err {
+			t.Errorf("wrong result of put %d: %v", i, err)
+		}
+	}
+	expected := []Usage{
+		{Quota{Prefix: "a", MaxObjects: 2}, 105, 2},
+		{Quota{Prefix: "ab", MaxBytes: 10}, 3, 2},
+	}
+	if usage := dataStorage.Usage(); !reflect.DeepEqual(usage, expected) {
+		t.Errorf("wrong usage: %v", usage)
+	}
+	if objects, bytes := dataStorage.Total(); objects != 5 || bytes != 208 {
+		t.Errorf("wrong total: %d objects, %d bytes", objects, bytes)
+	}
+
+	if err := dataStorage.Delete("ac0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dataStorage.Delete("ac0"); err != KeyAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := dataStorage.Put("ac2", []byte{}, "type"); err != nil {
+		t.Error(err)
+	}
+	if objects, bytes := dataStorage.Total(); objects != 5 || bytes != 108 {
+		t.Errorf("wrong total after delete: %d objects, %d bytes", objects, bytes)
+	}
+
+	dataStorage.Restore(map[string]Data{"ab": {make([]byte, 20), "type"}})
+	expected = []Usage{
+		{Quota{Prefix: "a", MaxObjects: 2}, 0, 0},
+		{Quota{Prefix: "ab", MaxBytes: 10}, 20, 1},
+	}
+	if usage := dataStorage.Usage(); !reflect.DeepEqual(usage, expected) {
+		t.Errorf("wrong usage after restore: %v", usage)
+	}
+	if objects, bytes := Total(NewObservableStorage(dataStorage)); objects != 1 || bytes != 20 {
+		t.Errorf("wrong total after restore: %d objects, %d bytes", objects, bytes)
+	}
+	// Tenant over its quota can shrink.
+	if err := dataStorage.Put("ab", make([]byte, 15), "type"); err != nil {
+		t.Error(err)
+	}
+}
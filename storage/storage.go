@@ -10,22 +10,77 @@ type Data struct {
 
 type Storage interface {
 	// Put places data in storage under given key.
-	Put(key string, object []byte, contentType string)
+	// Returns UnavailableError if storage cannot accept
+	// writes at the moment and QuotaExceededError if
+	// the write would exceed a quota.
+	Put(key string, object []byte, contentType string) error
 
 	// Get retrieves from storage data under given key.
 	// Returns KeyAbsentError if the key is not present.
 	Get(key string) (Data, error)
 
 	// Delete removes from storage data under given key.
-	// Returns KeyAbsentError if the key is not present.
+	// Returns KeyAbsentError if the key is not present
+	// and UnavailableError if storage cannot accept
+	// writes at the moment.
 	Delete(key string) error
 
 	// Keys lists keys present in storage.
 	Keys() []string
 }
 
-var KeyAbsentError = errors.New("key not in storage")
+// Counter is implemented by storages tracking their size,
+// so that it need not be computed from all objects.
+type Counter interface {
+	// Total returns number of objects in storage and their total size.
+	Total() (objects, bytes int64)
+}
+
+// Total returns number of objects in storage and their total size,
+// as tracked by storage if it is a Counter.
+func Total(storage Storage) (objects, bytes int64) {
+	if counter, ok := storage.(Counter); ok {
+		return counter.Total()
+	}
+	for _, key := range storage.Keys() {
+		if data, err := storage.Get(key); err == nil {
+			objects++
+			bytes += int64(len(data.Object))
+		}
+	}
+	return objects, bytes
+}
+
+// Snapshotter is implemented by storages able to copy
+// and replace their whole contents atomically.
+type Snapshotter interface {
+	// Snapshot returns a copy of storage contents
+	// from a single point in time.
+	Snapshot() map[string]Data
+
+	// Restore atomically replaces storage contents with values.
+	Restore(values map[string]Data)
+}
+
+// Watcher is implemented by storages versioning their keys.
+// Version of a key is the sequence number of its last mutation.
+type Watcher interface {
+	// GetWithVersion works like Get, additionally returning
+	// version of the key, also when it is not present.
+	GetWithVersion(key string) (Data, uint64, error)
+
+	// Watch returns a channel closed once version of key
+	// is greater than after, and a function releasing the watch.
+	// The function must be called when the channel is no longer needed.
+	Watch(key string, after uint64) (<-chan struct{}, func())
+}
+
+var (
+	KeyAbsentError     = errors.New("key not in storage")
+	UnavailableError   = errors.New("storage unavailable")
+	QuotaExceededError = errors.New("storage quota exceeded")
+)
 
-func NewStorage() CmapStorage {
+func NewStorage() *CmapStorage {
 	return NewCmapStorage()
 }
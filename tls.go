@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tlsconfig"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// startTLS configures server to serve certificate from certFile
+// and keyFile, verifying client certificates against clientCAFile
+// if it is not empty. Certificate is reloaded when its files change
+// or on SIGHUP, until ctx is done.
+func startTLS(ctx context.Context, server *http.Server, certFile, keyFile, clientCAFile string) error {
+	reloader, err := tlsconfig.NewReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	config, err := tlsconfig.Config(reloader, clientCAFile)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = config
+	go reloader.Watch(ctx, tlsconfig.WatchInterval)
+	go func() {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		defer signal.Stop(reload)
+		for {
+			select {
+			case <-reload:
+				if err := reloader.Reload(); err == nil {
+					logger.Info("Reloaded TLS certificate", logging.Fields{"cert": certFile})
+				} else {
+					logger.Error("Failed to reload TLS certificate", logging.Fields{"cert": certFile, "error": err})
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
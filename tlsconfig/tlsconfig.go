@@ -0,0 +1,127 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Interval of checking certificate files for changes.
+const WatchInterval = 10 * time.Second
+
+// Reloader serves a certificate loaded from files,
+// reloading it when they change.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	mut      sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// NewReloader loads certificate and key from PEM files.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate,
+// to be used as tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads certificate and key from files again.
+// On failure, the previous certificate is kept.
+func (r *Reloader) Reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mut.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mut.Unlock()
+	return nil
+}
+
+// Watch reloads certificate whenever its files are modified,
+// checking them every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			modTime, err := r.lastModified()
+			r.mut.RLock()
+			changed := err == nil && !modTime.Equal(r.modTime)
+			r.mut.RUnlock()
+			if !changed {
+				continue
+			}
+			// Files may be in the middle of replacement,
+			// so failure is retried on the next check.
+			if err := r.Reload(); err == nil {
+				log.Println("Reloaded TLS certificate")
+			} else {
+				log.Printf("Failed to reload TLS certificate: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// lastModified returns the later modification time of the files.
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, fileName := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Config returns server configuration serving certificate of reloader.
+// If clientCAFile is not empty, clients must present certificates
+// signed by one of CAs from this PEM file.
+func Config(reloader *Reloader, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		contents, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/tracing"
+	"io"
+	"os"
+)
+
+// startTracing exports spans of service to OTLP/HTTP endpoint, or to file
+// ("-" meaning standard output) if endpoint is empty. Returned function
+// exports remaining spans and stops tracing.
+func startTracing(endpoint, file, service string) (func(), error) {
+	var exporter tracing.Exporter
+	var out io.WriteCloser
+	if endpoint != "" {
+		exporter = tracing.NewOTLPExporter(endpoint, service)
+	} else if file == "-" {
+		exporter = tracing.NewWriterExporter(os.Stdout, service)
+	} else {
+		var err error
+		if out, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
+			return nil, err
+		}
+		exporter = tracing.NewWriterExporter(out, service)
+	}
+	tracer := tracing.NewTracer(exporter)
+	tracing.SetTracer(tracer)
+	return func() {
+		tracing.SetTracer(nil)
+		tracer.Close()
+		if out != nil {
+			if err := out.Close(); err != nil {
+				logger.Error("Failed to close trace file", logging.Fields{"file": file, "error": err})
+			}
+		}
+	}, nil
+}
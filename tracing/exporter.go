@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Path of OTLP/HTTP endpoint receiving traces.
+	tracesPath    = "/v1/traces"
+	clientTimeout = 10 * time.Second
+)
+
+// OTLP status codes.
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector
+// with OTLP/HTTP, encoded in JSON.
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter creates exporter sending spans of service to endpoint,
+// e.g. http://collector:4318. Endpoint may also include the traces path.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, tracesPath) {
+		url += tracesPath
+	}
+	return &OTLPExporter{url: url, service: service, client: &http.Client{Timeout: clientTimeout}}
+}
+
+func (o *OTLPExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(encodeSpans(o.service, spans))
+	if err != nil {
+		return err
+	}
+	response, err := o.client.Post(o.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %s", response.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes each batch of spans as a line holding
+// OTLP/HTTP JSON request, for files and standard output.
+type WriterExporter struct {
+	mut     sync.Mutex
+	out     io.Writer
+	service string
+}
+
+func NewWriterExporter(out io.Writer, service string) *WriterExporter {
+	return &WriterExporter{out: out, service: service}
+}
+
+func (w *WriterExporter) Export(spans []SpanData) error {
+	line, err := json.Marshal(encodeSpans(w.service, spans))
+	if err != nil {
+		return err
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	_, err = w.out.Write(append(line, '\n'))
+	return err
+}
+
+// OTLP JSON messages, with IDs in hex and 64-bit integers in strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceId           string          `json:"traceId"`
+		SpanId            string          `json:"spanId"`
+		ParentSpanId      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+func encodeSpans(service string, spans []SpanData) otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceId:           span.TraceId.String(),
+			SpanId:            span.SpanId.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if span.Parent != (SpanId{}) {
+			encoded[i].ParentSpanId = span.Parent.String()
+		}
+		if span.Error != "" {
+			encoded[i].Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes(map[string]interface{}{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: service}, Spans: encoded}},
+	}}}
+}
+
+// encodeAttributes encodes attributes sorted by key.
+func encodeAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded[i] = otlpAttribute{Key: key, Value: value}
+	}
+	return encoded
+}
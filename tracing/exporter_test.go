@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testSpans() []SpanData {
+	start := time.Unix(1, 5)
+	return []SpanData{{
+		Name:       "GET /api/objects/{key}",
+		Kind:       Server,
+		TraceId:    TraceId{0x4b, 0xf9},
+		SpanId:     SpanId{0x01},
+		Parent:     SpanId{0x02},
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]interface{}{"http.status_code": 500, "gwp.key": "abc", "ok": false, "ratio": 0.5},
+		Error:      "Internal Server Error",
+	}, {
+		Name:    "bolt.View",
+		Kind:    Internal,
+		TraceId: TraceId{0x01},
+		SpanId:  SpanId{0x03},
+		Start:   start,
+		End:     start,
+	}}
+}
+
+func checkEncoded(t *testing.T, body []byte) {
+	var request otlpRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("invalid request %s: %v", body, err)
+	}
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("invalid request %s", body)
+	}
+	resource := request.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value["stringValue"] != "gwp" {
+		t.Errorf("invalid resource %+v", resource)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.TraceId != "4bf90000000000000000000000000000" || span.SpanId != "0100000000000000" ||
+		span.ParentSpanId != "0200000000000000" || span.Kind != Server {
+		t.Errorf("invalid span %+v", span)
+	}
+	if span.StartTimeUnixNano != "1000000005" || span.EndTimeUnixNano != "2000000005" {
+		t.Errorf("invalid times %s %s", span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	if span.Status.Code != otlpStatusError || span.Status.Message != "Internal Server Error" {
+		t.Errorf("invalid status %+v", span.Status)
+	}
+	expected := []otlpAttribute{
+		{"gwp.key", map[string]interface{}{"stringValue": "abc"}},
+		{"http.status_code", map[string]interface{}{"intValue": "500"}},
+		{"ok", map[string]interface{}{"boolValue": false}},
+		{"ratio", map[string]interface{}{"doubleValue": 0.5}},
+	}
+	if len(span.Attributes) != len(expected) {
+		t.Fatalf("expected attributes %v, got %v", expected, span.Attributes)
+	}
+	for i, attribute := range expected {
+		if span.Attributes[i].Key != attribute.Key {
+			t.Errorf("expected attribute %s, got %s", attribute.Key, span.Attributes[i].Key)
+		}
+		for name, value := range attribute.Value {
+			if span.Attributes[i].Value[name] != value {
+				t.Errorf("attribute %s: expected %v, got %v", attribute.Key, attribute.Value, span.Attributes[i].Value)
+			}
+		}
+	}
+	if spans[1].ParentSpanId != "" || spans[1].Status.Code != otlpStatusUnset {
+		t.Errorf("invalid span %+v", spans[1])
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewWriterExporter(&buf, "gwp")
+	if err := exporter.Export(testSpans()); err != nil {
+		t.Fatal(err)
+	}
+	line, err := buf.ReadBytes('\n')
+	if err != nil || buf.Len() != 0 {
+		t.Fatalf("expected single line, got %q", buf.String())
+	}
+	checkEncoded(t, line)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	for _, endpoint := range []string{server.URL, server.URL + "/", server.URL + "/v1/traces"} {
+		body = nil
+		if err := NewOTLPExporter(endpoint, "gwp").Export(testSpans()); err != nil {
+			t.Fatalf("%s: %v", endpoint, err)
+		}
+		checkEncoded(t, body)
+	}
+
+	status = http.StatusBadRequest
+	if err := NewOTLPExporter(server.URL, "gwp").Export(testSpans()); err == nil {
+		t.Error("rejected export succeeded")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestWriterExporterError(t *testing.T) {
+	if err := NewWriterExporter(failingWriter{}, "gwp").Export(testSpans()); err == nil {
+		t.Error("failed write not reported")
+	}
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"net/http"
+)
+
+// Middleware traces each request with a server span, continuing trace
+// from TraceparentHeader if the request has a valid one. Span is named
+// after request method and chi route pattern. Trace ID is added to
+// the access log entry of the request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := ParseTraceparent(r.Header.Get(TraceparentHeader))
+		ctx, span := start(r.Context(), r.Method, Server, parent)
+		defer span.End()
+		if span.recording() {
+			logging.Annotate(ctx, logging.Fields{"trace_id": span.Context().TraceId.String()})
+		}
+		response := logging.Serve(next, w, r.WithContext(ctx))
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("http.status_code", response.Status)
+		if response.Route != "" {
+			span.SetName(r.Method + " " + response.Route)
+			span.SetAttribute("http.route", response.Route)
+		}
+		if response.Status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(response.Status)))
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"bytes"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/logging"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := chi.NewRouter()
+	router.Route("/api/objects", func(router chi.Router) {
+		router.Get("/{key}", func(w http.ResponseWriter, r *http.Request) {
+			_, span := Start(r.Context(), "storage.Get")
+			span.End()
+			w.Write([]byte("data"))
+		})
+		router.Delete("/{key}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	})
+	handler := Middleware(router)
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	spans := traceWith(func() {
+		r := httptest.NewRequest("GET", "/api/objects/abc?wait=1", nil)
+		r.Header.Set(TraceparentHeader, parent)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/api/objects/abc", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/absent", nil))
+	})
+
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	storageSpan, get, del, absent := spans[0], spans[1], spans[2], spans[3]
+	if get.TraceId.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || get.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("trace not continued: %+v", get)
+	}
+	if storageSpan.TraceId != get.TraceId || storageSpan.Parent != get.SpanId {
+		t.Errorf("handler span %+v not child of %+v", storageSpan, get)
+	}
+	if get.Name != "GET /api/objects/{key}" || get.Kind != Server || get.Error != "" {
+		t.Errorf("invalid span %+v", get)
+	}
+	expected := map[string]interface{}{
+		"http.method": "GET", "http.target": "/api/objects/abc?wait=1",
+		"http.route": "/api/objects/{key}", "http.status_code": 200,
+	}
+	for name, value := range expected {
+		if get.Attributes[name] != value {
+			t.Errorf("attribute %s: expected %v, got %v", name, value, get.Attributes[name])
+		}
+	}
+	if del.TraceId == get.TraceId || del.Parent != (SpanId{}) || del.Error == "" {
+		t.Errorf("invalid span %+v", del)
+	}
+	if absent.Name != "GET" || absent.Attributes["http.status_code"] != 404 {
+		t.Errorf("invalid span %+v", absent)
+	}
+}
+
+func TestMiddlewareAnnotates(t *testing.T) {
+	var traceId string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ := SpanFrom(r.Context())
+		traceId = span.Context().TraceId.String()
+	}))
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logging.Info)
+	traceWith(func() {
+		logger.Middleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	if traceId == "" || !strings.Contains(buf.String(), `"trace_id":"`+traceId+`"`) {
+		t.Errorf("trace ID %s not logged: %s", traceId, buf.String())
+	}
+}
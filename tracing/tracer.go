@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of finished spans queued for export. Further ones are dropped.
+	queueSize = 4096
+	// Maximal number of spans exported at once.
+	batchSize = 512
+	// Interval of exporting queued spans.
+	ExportInterval = 5 * time.Second
+)
+
+// Exporter sends finished spans to their destination.
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// Tracer records spans and exports them in batches,
+// so that traced operations are not slowed by exports.
+type Tracer struct {
+	exporter Exporter
+	now      func() time.Time
+
+	queue     chan SpanData
+	mut       sync.Mutex
+	dropped   int
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		now:      time.Now,
+		queue:    make(chan SpanData, queueSize),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) enqueue(span SpanData) {
+	select {
+	case t.queue <- span:
+	default:
+		t.mut.Lock()
+		t.dropped++
+		t.mut.Unlock()
+	}
+}
+
+// run exports queued spans every interval or when a batch is full,
+// until Close.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(ExportInterval)
+	defer ticker.Stop()
+	var batch []SpanData
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				batch = t.export(batch)
+			}
+		case <-ticker.C:
+			batch = t.export(batch)
+		case <-t.closed:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// export exports batch, returning an empty one.
+func (t *Tracer) export(batch []SpanData) []SpanData {
+	t.mut.Lock()
+	dropped := t.dropped
+	t.dropped = 0
+	t.mut.Unlock()
+	if dropped > 0 {
+		log.Printf("Dropped %d spans, export queue full", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := t.exporter.Export(batch); err != nil {
+		log.Printf("Failed to export %d spans: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// Close exports remaining spans and stops the tracer.
+// Spans ended afterwards are dropped.
+func (t *Tracer) Close() {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+	})
+	<-t.done
+}
@@ -0,0 +1,28 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTracerBatches(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(exporter)
+	SetTracer(tracer)
+	defer SetTracer(nil)
+	for i := 0; i < batchSize+1; i++ {
+		_, span := Start(context.Background(), "span")
+		span.End()
+	}
+	tracer.Close()
+
+	if len(exporter.spans) != batchSize+1 {
+		t.Errorf("expected %d spans, got %d", batchSize+1, len(exporter.spans))
+	}
+	_, span := Start(context.Background(), "late")
+	span.End()
+	if len(exporter.spans) != batchSize+1 {
+		t.Error("span exported after close")
+	}
+	tracer.Close()
+}
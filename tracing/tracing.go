@@ -0,0 +1,240 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries span context as defined by W3C Trace Context.
+const TraceparentHeader = "traceparent"
+
+type TraceId [16]byte
+
+type SpanId [8]byte
+
+func (t TraceId) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanId) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext identifies a span across processes.
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+}
+
+// Valid reports whether trace and span IDs are set.
+func (s SpanContext) Valid() bool {
+	return s.TraceId != TraceId{} && s.SpanId != SpanId{}
+}
+
+// Traceparent formats span context as value of TraceparentHeader.
+func (s SpanContext) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceId, s.SpanId, flags)
+}
+
+// ParseTraceparent parses value of TraceparentHeader.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var s SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	// Future versions may append fields.
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return s, false
+	}
+	version, err1 := hex.DecodeString(parts[0])
+	traceId, err2 := hex.DecodeString(parts[1])
+	spanId, err3 := hex.DecodeString(parts[2])
+	flags, err4 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(version) != 1 ||
+		len(traceId) != len(s.TraceId) || len(spanId) != len(s.SpanId) || len(flags) != 1 ||
+		strings.ToLower(value) != value {
+		return SpanContext{}, false
+	}
+	copy(s.TraceId[:], traceId)
+	copy(s.SpanId[:], spanId)
+	s.Sampled = flags[0]&1 == 1
+	return s, s.Valid()
+}
+
+// Kind describes relation of a span to other processes.
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+// SpanData is a finished span.
+type SpanData struct {
+	Name       string
+	Kind       Kind
+	TraceId    TraceId
+	SpanId     SpanId
+	Parent     SpanId // zero for root spans
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string // empty if the operation succeeded
+}
+
+// Span is an operation being traced. Spans of unsampled traces
+// are not recorded, but still propagate their context.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	mut     sync.Mutex
+	data    SpanData
+	ended   bool
+}
+
+// Context returns span context of span.
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+func (s *Span) recording() bool {
+	return s.tracer != nil && s.context.Sampled
+}
+
+// SetName replaces name of span.
+func (s *Span) SetName(name string) {
+	if s.recording() {
+		s.mut.Lock()
+		s.data.Name = name
+		s.mut.Unlock()
+	}
+}
+
+// SetAttribute sets attribute of span. Values should be strings,
+// integers, floats or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s.recording() {
+		s.mut.Lock()
+		s.data.Attributes[key] = value
+		s.mut.Unlock()
+	}
+}
+
+// SetError marks span as failed with err, if it is not nil.
+func (s *Span) SetError(err error) {
+	if err != nil && s.recording() {
+		s.mut.Lock()
+		s.data.Error = err.Error()
+		s.mut.Unlock()
+	}
+}
+
+// End finishes span, passing it to exporter of its tracer.
+// Further calls have no effect.
+func (s *Span) End() {
+	if !s.recording() {
+		return
+	}
+	s.mut.Lock()
+	if s.ended {
+		s.mut.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mut.Unlock()
+	s.tracer.enqueue(data)
+}
+
+var (
+	globalMut    sync.RWMutex
+	globalTracer *Tracer
+)
+
+// SetTracer sets tracer used by Start, nil disabling tracing.
+func SetTracer(tracer *Tracer) {
+	globalMut.Lock()
+	globalTracer = tracer
+	globalMut.Unlock()
+}
+
+func currentTracer() *Tracer {
+	globalMut.RLock()
+	defer globalMut.RUnlock()
+	return globalTracer
+}
+
+type contextKey struct{}
+
+// SpanFrom returns span carried by ctx, if any.
+func SpanFrom(ctx context.Context) (*Span, bool) {
+	span, ok := ctx.Value(contextKey{}).(*Span)
+	return span, ok
+}
+
+// Start starts an internal span, child of span carried by ctx,
+// returning context carrying the new span. Span must be ended with End.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	var parent SpanContext
+	if span, ok := SpanFrom(ctx); ok {
+		parent = span.context
+	}
+	return start(ctx, name, Internal, parent)
+}
+
+// start starts span of kind, child of parent if it is valid.
+func start(ctx context.Context, name string, kind Kind, parent SpanContext) (context.Context, *Span) {
+	tracer := currentTracer()
+	if tracer == nil {
+		return ctx, &Span{}
+	}
+	span := &Span{tracer: tracer}
+	if parent.Valid() {
+		span.context.TraceId = parent.TraceId
+		span.context.Sampled = parent.Sampled
+	} else {
+		span.context.TraceId = newTraceId()
+		span.context.Sampled = true
+	}
+	span.context.SpanId = newSpanId()
+	if span.recording() {
+		span.data = SpanData{
+			Name:       name,
+			Kind:       kind,
+			TraceId:    span.context.TraceId,
+			SpanId:     span.context.SpanId,
+			Parent:     parent.SpanId,
+			Start:      tracer.now(),
+			Attributes: make(map[string]interface{}),
+		}
+	}
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+func newTraceId() TraceId {
+	var id TraceId
+	randomize(id[:])
+	return id
+}
+
+func newSpanId() SpanId {
+	var id SpanId
+	randomize(id[:])
+	return id
+}
+
+func randomize(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type memoryExporter struct {
+	mut   sync.Mutex
+	spans []SpanData
+}
+
+func (m *memoryExporter) Export(spans []SpanData) error {
+	m.mut.Lock()
+	m.spans = append(m.spans, spans...)
+	m.mut.Unlock()
+	return nil
+}
+
+// traceWith sets tracer exporting to a memory exporter for duration of fn,
+// returning exported spans.
+func traceWith(fn func()) []SpanData {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(exporter)
+	SetTracer(tracer)
+	fn()
+	SetTracer(nil)
+	tracer.Close()
+	return exporter.spans
+}
+
+func TestParseTraceparent(t *testing.T) {
+	dataSets := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+	for _, dataSet := range dataSets {
+		sc, ok := ParseTraceparent(dataSet.value)
+		if ok != dataSet.ok {
+			t.Errorf("%q: expected ok %v, got %v", dataSet.value, dataSet.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if sc.Sampled != dataSet.sampled {
+			t.Errorf("%q: expected sampled %v", dataSet.value, dataSet.sampled)
+		}
+		if sc.TraceId.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanId.String() != "00f067aa0ba902b7" {
+			t.Errorf("%q: invalid IDs %s %s", dataSet.value, sc.TraceId, sc.SpanId)
+		}
+		if dataSet.value[:2] == "00" && sc.Traceparent() != dataSet.value {
+			t.Errorf("%q: formatted as %q", dataSet.value, sc.Traceparent())
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	var root, child SpanContext
+	spans := traceWith(func() {
+		ctx, span := Start(context.Background(), "root")
+		root = span.Context()
+		_, childSpan := Start(ctx, "child")
+		childSpan.SetAttribute("key", "value")
+		childSpan.SetError(context.Canceled)
+		child = childSpan.Context()
+		childSpan.End()
+		childSpan.End()
+		span.End()
+	})
+
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if !root.Valid() || !root.Sampled {
+		t.Errorf("invalid root context %+v", root)
+	}
+	if child.TraceId != root.TraceId || child.SpanId == root.SpanId {
+		t.Errorf("child context %+v not in trace of %+v", child, root)
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "child" || c.Parent != root.SpanId || c.Kind != Internal {
+		t.Errorf("invalid child span %+v", c)
+	}
+	if c.Attributes["key"] != "value" || c.Error != context.Canceled.Error() {
+		t.Errorf("child span attributes or error not recorded: %+v", c)
+	}
+	if r.Name != "root" || r.Parent != (SpanId{}) || r.End.Before(r.Start) {
+		t.Errorf("invalid root span %+v", r)
+	}
+}
+
+func TestStartUnsampled(t *testing.T) {
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	var child SpanContext
+	spans := traceWith(func() {
+		_, span := start(context.Background(), "server", Server, parent)
+		_, childSpan := Start(context.WithValue(context.Background(), contextKey{}, span), "child")
+		child = childSpan.Context()
+		childSpan.End()
+		span.End()
+	})
+
+	if len(spans) != 0 {
+		t.Errorf("unsampled spans exported: %+v", spans)
+	}
+	if child.TraceId != parent.TraceId || child.Sampled {
+		t.Errorf("context %+v not propagated from %+v", child, parent)
+	}
+}
+
+func TestStartWithoutTracer(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttribute("key", "value")
+	span.End()
+	if span.Context().Valid() {
+		t.Error("span without tracer has a valid context")
+	}
+	if ctx != context.Background() {
+		t.Error("context changed without tracer")
+	}
+}
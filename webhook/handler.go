@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/apierror"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+// Maximal size of a registration request.
+const maxRequestSize = 10000
+
+// Valid prefixes of keys watched by webhooks.
+var prefixRegex = regexp.MustCompile("^[0-9a-zA-Z]{0,100}$")
+
+// Handler returns handler managing webhooks and dead letters,
+// to be mounted under Url.
+func (d *Dispatcher) Handler() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/", d.getHooks)
+	router.Post("/", d.postHook)
+	router.Delete("/{id}", d.deleteHook)
+	router.Get("/deadletters", d.getDeadLetters)
+	router.Delete("/deadletters/{id}", d.deleteDeadLetter)
+	return router
+}
+
+// getHooks writes registered webhooks, without secrets,
+// into body in JSON format.
+func (d *Dispatcher) getHooks(w http.ResponseWriter, _ *http.Request) {
+	hooks := d.Hooks()
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Id < hooks[j].Id
+	})
+	apierror.WriteJson(w, http.StatusOK, hooks)
+}
+
+// postHook registers a webhook described by request's body,
+// writing it back with its Id and Secret and code http.StatusCreated.
+// If the description is invalid, writes code http.StatusBadRequest.
+func (d *Dispatcher) postHook(w http.ResponseWriter, r *http.Request) {
+	var hook Hook
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err == nil {
+		err = json.Unmarshal(body, &hook)
+	}
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid webhook description: "+err.Error())
+		return
+	}
+	if !validUrl(hook.Url) {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid webhook URL")
+		return
+	}
+	if !prefixRegex.MatchString(hook.Prefix) {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.BadRequest, "invalid key prefix")
+		return
+	}
+	if hook, err := d.Register(r.Context(), hook); err == nil {
+		apierror.WriteJson(w, http.StatusCreated, hook)
+	} else {
+		panic(err)
+	}
+}
+
+// deleteHook unregisters webhook with request's id parameter,
+// writing code http.StatusNoContent, or http.StatusNotFound
+// if there is no such webhook.
+func (d *Dispatcher) deleteHook(w http.ResponseWriter, r *http.Request) {
+	if err := d.Unregister(r.Context(), chi.URLParam(r, "id")); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+	} else if err == HookAbsentError {
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, err.Error())
+	} else {
+		panic(err)
+	}
+}
+
+// getDeadLetters writes failed deliveries, oldest first,
+// into body in JSON format.
+func (d *Dispatcher) getDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	deadLetters := d.DeadLetters()
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].Time.Before(deadLetters[j].Time)
+	})
+	apierror.WriteJson(w, http.StatusOK, deadLetters)
+}
+
+// deleteDeadLetter discards dead letter with request's id parameter,
+// writing code http.StatusNoContent, or http.StatusNotFound
+// if there is no such dead letter.
+func (d *Dispatcher) deleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if err := d.RemoveDeadLetter(r.Context(), chi.URLParam(r, "id")); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+	} else if err == DeadLetterAbsentError {
+		apierror.Write(w, r, http.StatusNotFound, apierror.NotFound, err.Error())
+	} else {
+		panic(err)
+	}
+}
+
+// validUrl reports whether webhooks can be delivered to rawUrl.
+func validUrl(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEndpoints(t *testing.T) {
+	store := newMemStore()
+	_, dispatcher := newDispatcher(t, store)
+	defer dispatcher.Close()
+	handler := dispatcher.Handler()
+
+	invalid := []string{
+		`{"url": "ftp://example.com"}`,
+		`{"url": "example.com"}`,
+		`{"url": "http://example.com", "prefix": "a-b"}`,
+		`{"url":`,
+	}
+	for _, body := range invalid {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("wrong code for %v: %v", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"url": "http://example.com/hook", "prefix": "ab", "secret": "s"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("wrong code: %v", w.Code)
+	}
+	var hook Hook
+	if err := json.Unmarshal(w.Body.Bytes(), &hook); err != nil {
+		t.Fatal(err)
+	}
+	if hook.Id == "" || hook.Url != "http://example.com/hook" || hook.Prefix != "ab" || hook.Secret != "s" {
+		t.Errorf("wrong hook: %+v", hook)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var hooks []Hook
+	if err := json.Unmarshal(w.Body.Bytes(), &hooks); err != nil {
+		t.Fatal(err)
+	}
+	hook.Secret = ""
+	if len(hooks) != 1 || hooks[0] != hook {
+		t.Errorf("wrong hooks: %v", hooks)
+	}
+
+	for _, code := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/"+hook.Id, nil))
+		if w.Code != code {
+			t.Errorf("wrong code: %v", w.Code)
+		}
+	}
+}
+
+func TestEndpointsDeadLetters(t *testing.T) {
+	store := newMemStore()
+	deadLetter := DeadLetter{Id: "id", Hook: "hook", Time: time.Now().UTC()}
+	record, _ := json.Marshal(deadLetter)
+	store.Put(context.Background(), deadLettersBucket, deadLetter.Id, record)
+	_, dispatcher := newDispatcher(t, store)
+	defer dispatcher.Close()
+	handler := dispatcher.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/deadletters", nil))
+	var deadLetters []DeadLetter
+	if err := json.Unmarshal(w.Body.Bytes(), &deadLetters); err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Id != "id" || !deadLetters[0].Time.Equal(deadLetter.Time) {
+		t.Errorf("wrong dead letters: %v", deadLetters)
+	}
+
+	for _, code := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/deadletters/id", nil))
+		if w.Code != code {
+			t.Errorf("wrong code: %v", w.Code)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Url = "/api/webhooks"
+
+	// SignatureHeader holds HMAC-SHA256 of request body keyed
+	// with secret of the webhook, as "sha256=<hex>".
+	SignatureHeader = "X-GWP-Signature"
+	// DeliveryHeader identifies a delivery, the same for all its attempts.
+	DeliveryHeader = "X-GWP-Delivery"
+
+	MaxAttempts    = 5
+	InitialBackoff = 1 * time.Second
+	MaxBackoff     = 1 * time.Minute
+)
+
+const (
+	hooksBucket       = "GWP_webhooks"
+	deadLettersBucket = "GWP_dead_letters"
+
+	// Number of deliveries queued for a webhook. Further ones
+	// go straight to dead letters.
+	queueSize = 1024
+	// Number of mutations queued for the dispatcher itself.
+	storageBuffer = 4096
+	clientTimeout = 10 * time.Second
+)
+
+var (
+	HookAbsentError       = errors.New("webhook not registered")
+	DeadLetterAbsentError = errors.New("dead letter not found")
+	QueueFullError        = errors.New("delivery queue full")
+	ShutdownError         = errors.New("server shut down before delivery")
+)
+
+// Store persists webhooks and dead letters,
+// implemented by persistence.MetaStore.
+type Store interface {
+	Load(bucketName string) (map[string][]byte, error)
+	Put(ctx context.Context, bucketName, key string, record []byte) error
+	Delete(ctx context.Context, bucketName, key string) error
+}
+
+// Hook is a registered webhook, receiving events
+// of mutations of keys starting with Prefix.
+type Hook struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Prefix string `json:"prefix"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// DeadLetter records a delivery which failed all attempts.
+type DeadLetter struct {
+	Id        string       `json:"id"`
+	Hook      string       `json:"hook"`
+	Url       string       `json:"url"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"lastError"`
+	Time      time.Time    `json:"time"`
+}
+
+// worker delivers events to a single webhook, in order.
+type worker struct {
+	hook   Hook
+	queue  chan events.Event
+	remove chan struct{}
+}
+
+// Dispatcher delivers events of storage mutations to webhooks.
+// Deliveries are asynchronous, so mutations are never slowed
+// by receivers.
+type Dispatcher struct {
+	storage *storage.ObservableStorage
+	store   Store
+	client  *http.Client
+
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mut         sync.Mutex
+	workers     map[string]*worker
+	deadLetters map[string]DeadLetter
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+}
+
+// NewDispatcher loads webhooks and dead letters from store
+// and starts delivering events of storage mutations.
+func NewDispatcher(dataStorage *storage.ObservableStorage, store Store) (*Dispatcher, error) {
+	d := &Dispatcher{
+		storage:        dataStorage,
+		store:          store,
+		client:         &http.Client{Timeout: clientTimeout},
+		attempts:       MaxAttempts,
+		initialBackoff: InitialBackoff,
+		maxBackoff:     MaxBackoff,
+		workers:        make(map[string]*worker),
+		deadLetters:    make(map[string]DeadLetter),
+		closed:         make(chan struct{}),
+	}
+
+	records, err := store.Load(deadLettersBucket)
+	if err != nil {
+		return nil, err
+	}
+	for id, record := range records {
+		var deadLetter DeadLetter
+		if err := json.Unmarshal(record, &deadLetter); err != nil {
+			return nil, fmt.Errorf("dead letter %s: %v", id, err)
+		}
+		d.deadLetters[id] = deadLetter
+	}
+	records, err = store.Load(hooksBucket)
+	if err != nil {
+		return nil, err
+	}
+	for id, record := range records {
+		var hook Hook
+		if err := json.Unmarshal(record, &hook); err != nil {
+			return nil, fmt.Errorf("webhook %s: %v", id, err)
+		}
+		d.start(hook)
+	}
+
+	d.running.Add(1)
+	go d.run(dataStorage.Subscribe(storageBuffer))
+	return d, nil
+}
+
+// Close stops delivering events and waits for deliveries
+// in progress. Queued events are recorded as dead letters.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+	})
+	d.running.Wait()
+}
+
+// Register adds a webhook, generating its Id and, if not given, Secret.
+func (d *Dispatcher) Register(ctx context.Context, hook Hook) (Hook, error) {
+	hook.Id = randomHex(8)
+	if hook.Secret == "" {
+		hook.Secret = randomHex(32)
+	}
+	record, err := json.Marshal(hook)
+	if err != nil {
+		panic(err)
+	}
+	if err := d.store.Put(ctx, hooksBucket, hook.Id, record); err != nil {
+		return Hook{}, err
+	}
+	d.start(hook)
+	return hook, nil
+}
+
+// Unregister removes a webhook. Events already queued for it are dropped.
+// Webhook is removed from store outside of the lock, so that dispatching
+// events does not wait for it, and keeps receiving events until then.
+func (d *Dispatcher) Unregister(ctx context.Context, id string) error {
+	d.mut.Lock()
+	w, ok := d.workers[id]
+	d.mut.Unlock()
+	if !ok {
+		return HookAbsentError
+	}
+	if err := d.store.Delete(ctx, hooksBucket, id); err != nil {
+		return err
+	}
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.workers[id] != w {
+		// Removed by a concurrent call.
+		return HookAbsentError
+	}
+	delete(d.workers, id)
+	close(w.remove)
+	return nil
+}
+
+// Hooks returns registered webhooks, without their secrets.
+func (d *Dispatcher) Hooks() []Hook {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	hooks := make([]Hook, 0, len(d.workers))
+	for _, w := range d.workers {
+		hook := w.hook
+		hook.Secret = ""
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// DeadLetters returns failed deliveries.
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	deadLetters := make([]DeadLetter, 0, len(d.deadLetters))
+	for _, deadLetter := range d.deadLetters {
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	return deadLetters
+}
+
+// RemoveDeadLetter discards a failed delivery. Like in Unregister,
+// it is removed from store outside of the lock.
+func (d *Dispatcher) RemoveDeadLetter(ctx context.Context, id string) error {
+	d.mut.Lock()
+	_, ok := d.deadLetters[id]
+	d.mut.Unlock()
+	if !ok {
+		return DeadLetterAbsentError
+	}
+	if err := d.store.Delete(ctx, deadLettersBucket, id); err != nil {
+		return err
+	}
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if _, ok := d.deadLetters[id]; !ok {
+		return DeadLetterAbsentError
+	}
+	delete(d.deadLetters, id)
+	return nil
+}
+
+func (d *Dispatcher) start(hook Hook) {
+	w := &worker{hook: hook, queue: make(chan events.Event, queueSize), remove: make(chan struct{})}
+	d.mut.Lock()
+	d.workers[hook.Id] = w
+	d.mut.Unlock()
+	d.running.Add(1)
+	go d.work(w)
+}
+
+// run passes events of mutations to workers of matching webhooks.
+func (d *Dispatcher) run(subscription *storage.Subscription) {
+	defer d.running.Done()
+	for {
+		select {
+		case mutation, ok := <-subscription.Events():
+			if !ok {
+				log.Printf("Webhook events lost: %v", subscription.Err())
+				subscription = d.storage.Subscribe(storageBuffer)
+				continue
+			}
+			op := mutation.Op
+			if op == storage.OpPut && mutation.Created {
+				op = storage.OpCreate
+			} else if op == storage.OpPut {
+				op = storage.OpUpdate
+			}
+			event := events.Event{
+				Key:         mutation.Key,
+				Op:          op,
+				ContentType: mutation.Data.ContentType,
+				Version:     mutation.Seq,
+				Time:        mutation.Time,
+			}
+			var failed []DeadLetter
+			d.mut.Lock()
+			for _, w := range d.workers {
+				if !strings.HasPrefix(event.Key, w.hook.Prefix) {
+					continue
+				}
+				if d.isClosed() {
+					// Worker may have already stopped.
+					failed = append(failed, newDeadLetter(w.hook, event, 0, ShutdownError))
+					continue
+				}
+				select {
+				case w.queue <- event:
+				default:
+					failed = append(failed, newDeadLetter(w.hook, event, 0, QueueFullError))
+				}
+			}
+			d.mut.Unlock()
+			d.bury(failed...)
+		case <-d.closed:
+			subscription.Close()
+			return
+		}
+	}
+}
+
+// work delivers queued events until webhook is removed
+// or dispatcher is closed.
+func (d *Dispatcher) work(w *worker) {
+	defer d.running.Done()
+	for {
+		select {
+		case event := <-w.queue:
+			if attempts, err := d.deliver(w, event); err != nil && err != HookAbsentError {
+				d.bury(newDeadLetter(w.hook, event, attempts, err))
+			}
+		case <-w.remove:
+			return
+		case <-d.closed:
+			var failed []DeadLetter
+			for {
+				select {
+				case event := <-w.queue:
+					failed = append(failed, newDeadLetter(w.hook, event, 0, ShutdownError))
+				default:
+					d.bury(failed...)
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts event to webhook, retrying with exponential backoff.
+// Returns number of attempts made and the last error.
+func (d *Dispatcher) deliver(w *worker, event events.Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	signature := Sign(w.hook.Secret, body)
+	delivery := randomHex(8)
+
+	backoff := d.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err = d.post(w.hook.Url, body, signature, delivery)
+		if err == nil || attempt == d.attempts {
+			return attempt, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.remove:
+			return attempt, HookAbsentError
+		case <-d.closed:
+			return attempt, err
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) post(url string, body []byte, signature, delivery string) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, signature)
+	request.Header.Set(DeliveryHeader, delivery)
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = ioutil.ReadAll(response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", url, response.Status)
+	}
+	return nil
+}
+
+func (d *Dispatcher) isClosed() bool {
+	select {
+	case <-d.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func newDeadLetter(hook Hook, event events.Event, attempts int, err error) DeadLetter {
+	return DeadLetter{
+		Id:        randomHex(8),
+		Hook:      hook.Id,
+		Url:       hook.Url,
+		Event:     event,
+		Attempts:  attempts,
+		LastError: err.Error(),
+		Time:      time.Now(),
+	}
+}
+
+// bury records failed deliveries as dead letters. They are saved
+// without mut held, so that dispatching does not wait for the store,
+// and listed only afterwards, so that they cannot be removed before.
+// Must not be called with mut held.
+func (d *Dispatcher) bury(deadLetters ...DeadLetter) {
+	for _, deadLetter := range deadLetters {
+		record, err := json.Marshal(deadLetter)
+		if err != nil {
+			panic(err)
+		}
+		if err := d.store.Put(context.Background(), deadLettersBucket, deadLetter.Id, record); err != nil {
+			log.Printf("Failed to save dead letter %s: %v", deadLetter.Id, err)
+		}
+	}
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	for _, deadLetter := range deadLetters {
+		d.deadLetters[deadLetter.Id] = deadLetter
+	}
+}
+
+// Sign returns value of SignatureHeader for body sent to
+// webhook with secret, for receivers verifying deliveries.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,346 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/events"
+	"github.com/Razz4780/TWljaGHFgi1TbW9sYXJlaw/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a Store keeping records in memory.
+type memStore struct {
+	mut     sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (m *memStore) Load(bucketName string) (map[string][]byte, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	records := make(map[string][]byte)
+	for key, record := range m.buckets[bucketName] {
+		records[key] = record
+	}
+	return records, nil
+}
+
+func (m *memStore) Put(_ context.Context, bucketName, key string, record []byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.buckets[bucketName] == nil {
+		m.buckets[bucketName] = make(map[string][]byte)
+	}
+	m.buckets[bucketName][key] = record
+	return nil
+}
+
+func (m *memStore) Delete(_ context.Context, bucketName, key string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.buckets[bucketName], key)
+	return nil
+}
+
+// slowStore is a memStore saving dead letters only after release is closed.
+type slowStore struct {
+	*memStore
+	release chan struct{}
+}
+
+func (s *slowStore) Put(ctx context.Context, bucketName, key string, record []byte) error {
+	if bucketName == deadLettersBucket {
+		<-s.release
+	}
+	return s.memStore.Put(ctx, bucketName, key, record)
+}
+
+// readOnlyStore is a memStore failing to delete records.
+type readOnlyStore struct {
+	*memStore
+}
+
+func (readOnlyStore) Delete(context.Context, string, string) error {
+	return errors.New("read only")
+}
+
+// blockingStore is a memStore signalling deletes on started
+// and finishing them with errors received from result.
+type blockingStore struct {
+	*memStore
+	started chan struct{}
+	result  chan error
+}
+
+func (b *blockingStore) Delete(context.Context, string, string) error {
+	b.started <- struct{}{}
+	return <-b.result
+}
+
+// delivery is a request received by receiver.
+type delivery struct {
+	event     events.Event
+	body      []byte
+	signature string
+	id        string
+}
+
+// receiver is a webhook receiver failing first failures requests.
+type receiver struct {
+	server     *httptest.Server
+	deliveries chan delivery
+	mut        sync.Mutex
+	failures   int
+}
+
+func newReceiver(failures int) *receiver {
+	r := &receiver{deliveries: make(chan delivery, 100), failures: failures}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mut.Lock()
+		fail := r.failures > 0
+		r.failures--
+		r.mut.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var event events.Event
+		_ = json.Unmarshal(body, &event)
+		r.deliveries <- delivery{event, body, req.Header.Get(SignatureHeader), req.Header.Get(DeliveryHeader)}
+	}))
+	return r
+}
+
+func (r *receiver) receive(t *testing.T) delivery {
+	select {
+	case d := <-r.deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+		return delivery{}
+	}
+}
+
+func newDispatcher(t *testing.T, store Store) (*storage.ObservableStorage, *Dispatcher) {
+	dataStorage := storage.NewObservableStorage(storage.NewStorage())
+	dispatcher, err := NewDispatcher(dataStorage, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.attempts = 3
+	dispatcher.initialBackoff = time.Millisecond
+	return dataStorage, dispatcher
+}
+
+func TestDispatcher_Delivery(t *testing.T) {
+	r := newReceiver(0)
+	defer r.server.Close()
+	dataStorage, dispatcher := newDispatcher(t, newMemStore())
+	defer dispatcher.Close()
+
+	hook, err := dispatcher.Register(context.Background(), Hook{Url: r.server.URL, Prefix: "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.Id == "" || hook.Secret == "" {
+		t.Fatalf("id or secret not generated: %+v", hook)
+	}
+
+	dataStorage.Put("xyz", []byte{}, "")
+	dataStorage.Put("abc", []byte{1}, "type")
+	dataStorage.Put("abc", []byte{2}, "other")
+	dataStorage.Delete("abc")
+
+	put := r.receive(t)
+	if put.event.Key != "abc" || put.event.Op != storage.OpCreate || put.event.ContentType != "type" || put.event.Version != 2 {
+		t.Errorf("wrong event: %+v", put.event)
+	}
+	if put.signature != Sign(hook.Secret, put.body) {
+		t.Errorf("wrong signature: %v", put.signature)
+	}
+	if put.id == "" {
+		t.Error("delivery id not set")
+	}
+	if update := r.receive(t); update.event.Op != storage.OpUpdate || update.event.ContentType != "other" || update.event.Version != 3 {
+		t.Errorf("wrong event: %+v", update.event)
+	}
+	if del := r.receive(t); del.event.Op != storage.OpDelete || del.event.Version != 4 {
+		t.Errorf("wrong event: %+v", del.event)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	r := newReceiver(2)
+	defer r.server.Close()
+	dataStorage, dispatcher := newDispatcher(t, newMemStore())
+	defer dispatcher.Close()
+	if _, err := dispatcher.Register(context.Background(), Hook{Url: r.server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	dataStorage.Put("key", []byte{}, "")
+	if d := r.receive(t); d.event.Key != "key" {
+		t.Errorf("wrong event: %+v", d.event)
+	}
+	if deadLetters := dispatcher.DeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("unexpected dead letters: %v", deadLetters)
+	}
+}
+
+func TestDispatcher_SlowDeadLetters(t *testing.T) {
+	r := newReceiver(3)
+	defer r.server.Close()
+	store := &slowStore{memStore: newMemStore(), release: make(chan struct{})}
+	dataStorage, dispatcher := newDispatcher(t, store)
+	defer dispatcher.Close()
+	if _, err := dispatcher.Register(context.Background(), Hook{Url: r.server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	dataStorage.Put("key", []byte{}, "")
+	time.Sleep(50 * time.Millisecond)
+	// Saving the dead letter must not block the dispatcher.
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Hooks()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatcher blocked by saving dead letter")
+	}
+	if deadLetters := dispatcher.DeadLetters(); len(deadLetters) != 0 {
+		t.Errorf("dead letters listed before saved: %v", deadLetters)
+	}
+
+	close(store.release)
+	for i := 0; i < 100 && len(dispatcher.DeadLetters()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if deadLetters := dispatcher.DeadLetters(); len(deadLetters) != 1 || deadLetters[0].Event.Key != "key" {
+		t.Errorf("wrong dead letters: %v", deadLetters)
+	}
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	r := newReceiver(3)
+	defer r.server.Close()
+	store := newMemStore()
+	dataStorage, dispatcher := newDispatcher(t, store)
+	hook, err := dispatcher.Register(context.Background(), Hook{Url: r.server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataStorage.Put("key1", []byte{}, "")
+	dataStorage.Put("key2", []byte{}, "")
+	if d := r.receive(t); d.event.Key != "key2" {
+		t.Errorf("wrong event: %+v", d.event)
+	}
+	deadLetters := dispatcher.DeadLetters()
+	if len(deadLetters) != 1 {
+		t.Fatalf("wrong dead letters: %v", deadLetters)
+	}
+	deadLetter := deadLetters[0]
+	if deadLetter.Hook != hook.Id || deadLetter.Event.Key != "key1" || deadLetter.Attempts != 3 || deadLetter.LastError == "" {
+		t.Errorf("wrong dead letter: %+v", deadLetter)
+	}
+	dispatcher.Close()
+
+	// Webhooks and dead letters survive restart.
+	_, dispatcher = newDispatcher(t, store)
+	defer dispatcher.Close()
+	if hooks := dispatcher.Hooks(); len(hooks) != 1 || hooks[0].Id != hook.Id || hooks[0].Secret != "" {
+		t.Errorf("wrong hooks: %v", hooks)
+	}
+	if deadLetters := dispatcher.DeadLetters(); len(deadLetters) != 1 || deadLetters[0].Id != deadLetter.Id {
+		t.Errorf("wrong dead letters: %v", deadLetters)
+	}
+
+	if err := dispatcher.RemoveDeadLetter(context.Background(), deadLetter.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.RemoveDeadLetter(context.Background(), deadLetter.Id); err != DeadLetterAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := dispatcher.Unregister(context.Background(), hook.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Unregister(context.Background(), hook.Id); err != HookAbsentError {
+		t.Errorf("wrong error: %v", err)
+	}
+	for _, bucketName := range []string{hooksBucket, deadLettersBucket} {
+		if records, _ := store.Load(bucketName); len(records) != 0 {
+			t.Errorf("records left in %v: %v", bucketName, records)
+		}
+	}
+}
+
+func TestDispatcher_FailedRemoval(t *testing.T) {
+	store := readOnlyStore{newMemStore()}
+	deadLetter := DeadLetter{Id: "id", Event: events.Event{Key: "key"}}
+	record, _ := json.Marshal(deadLetter)
+	if err := store.Put(context.Background(), deadLettersBucket, deadLetter.Id, record); err != nil {
+		t.Fatal(err)
+	}
+	_, dispatcher := newDispatcher(t, store)
+	defer dispatcher.Close()
+	hook, err := dispatcher.Register(context.Background(), Hook{Url: "http://127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dispatcher.Unregister(context.Background(), hook.Id); err == nil {
+		t.Error("no error")
+	}
+	if hooks := dispatcher.Hooks(); len(hooks) != 1 || hooks[0].Id != hook.Id {
+		t.Errorf("wrong hooks: %v", hooks)
+	}
+	if err := dispatcher.RemoveDeadLetter(context.Background(), deadLetter.Id); err == nil {
+		t.Error("no error")
+	}
+	if deadLetters := dispatcher.DeadLetters(); len(deadLetters) != 1 || deadLetters[0].Id != deadLetter.Id {
+		t.Errorf("wrong dead letters: %v", deadLetters)
+	}
+}
+
+func TestDispatcher_DeliveryDuringRemoval(t *testing.T) {
+	r := newReceiver(0)
+	defer r.server.Close()
+	store := &blockingStore{memStore: newMemStore(), started: make(chan struct{}), result: make(chan error)}
+	dataStorage, dispatcher := newDispatcher(t, store)
+	defer dispatcher.Close()
+	hook, err := dispatcher.Register(context.Background(), Hook{Url: r.server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unregistered := make(chan error)
+	go func() {
+		unregistered <- dispatcher.Unregister(context.Background(), hook.Id)
+	}()
+	<-store.started
+	// Webhook is not removed until it is deleted from store.
+	dataStorage.Put("key", []byte{}, "")
+	if d := r.receive(t); d.event.Key != "key" {
+		t.Errorf("wrong event: %+v", d.event)
+	}
+	store.result <- errors.New("failed")
+	if err := <-unregistered; err == nil {
+		t.Error("no error")
+	}
+	if hooks := dispatcher.Hooks(); len(hooks) != 1 {
+		t.Errorf("wrong hooks: %v", hooks)
+	}
+}